@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"talodu/i18n"
 	"talodu/models"
 
 	"time"
@@ -100,6 +101,20 @@ func GetAuthUser(c *gin.Context) (*AuthUser, error) {
 	}, nil
 }
 
+// SessionHeader carries the session id of anonymous clients, a random
+// string they generate and keep until they sign in
+const SessionHeader = "X-Session-ID"
+
+// SessionID returns the anonymous session id of the request, "" when it has
+// none or an invalid one
+func SessionID(c *gin.Context) string {
+	id := strings.TrimSpace(c.GetHeader(SessionHeader))
+	if len(id) < 16 || len(id) > 64 {
+		return ""
+	}
+	return id
+}
+
 func convertToRoles(roles interface{}) []string {
 	var result []string
 	if roles != nil {
@@ -328,6 +343,13 @@ func Login(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// What the client did before signing in now belongs to the account
+		if sessionID := SessionID(c); sessionID != "" {
+			if err := models.MergeProductViews(db, sessionID, user.ID); err != nil {
+				log.Printf("Failed to merge the product views of session %s: %v", sessionID, err)
+			}
+		}
+
 		user.Pin = user.ID
 
 		c.JSON(http.StatusOK, gin.H{
@@ -553,6 +575,8 @@ func RegisterUser(db *gorm.DB) gin.HandlerFunc {
 			IsVerified:   false,
 			VerifyToken:  verifyToken,
 			VerifyExpiry: verifyExpiry,
+			// Notifications and emails use the language the user signed up in
+			PreferredLanguage: i18n.Language(c),
 		}
 
 		// Assign roles
@@ -597,7 +621,7 @@ func RegisterUser(db *gorm.DB) gin.HandlerFunc {
 
 		//verificationLink = host_url + verificationLink
 
-		lang := getPreferredLanguage(c)
+		lang := getPreferredLanguage(c, &user)
 
 		if err := SendVerificationEmail(user.Email, verificationLink, lang); err != nil {
 			log.Printf("Failed to send verification email: %v", err)
@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"talodu/i18n"
 	"talodu/models"
 	"time"
 
@@ -17,18 +18,17 @@ import (
 	"gorm.io/gorm"
 )
 
-func getPreferredLanguage(c *gin.Context) string {
-	// Check Accept-Language header first
-	acceptLang := c.GetHeader("Accept-Language") // This shows en-US
-	lang := strings.ToLower(strings.TrimSpace(c.Query("lang")))
-	if acceptLang != "" {
-
+// getPreferredLanguage returns the language of the emails sent to user: the
+// one asked by the request, else the preferred language of the user, else the
+// language negotiated for the request, see i18n.Language
+func getPreferredLanguage(c *gin.Context, user *User) string {
+	if lang := i18n.QueryLanguage(c); lang != "" {
 		return lang
-
 	}
-
-	// Default to English
-	return "en"
+	if i18n.IsSupported(user.PreferredLanguage) {
+		return user.PreferredLanguage
+	}
+	return i18n.Language(c)
 }
 
 // mail.go
@@ -155,7 +155,7 @@ func ResendVerificationEmail(db *gorm.DB) gin.HandlerFunc {
 		)
 
 		// Send verification email
-		lang := getPreferredLanguage(c)
+		lang := getPreferredLanguage(c, &user)
 		err := SendVerificationEmail(user.Email, verificationLink, lang)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
@@ -343,7 +343,7 @@ func InitiatePasswordReset(db *gorm.DB) gin.HandlerFunc {
 			user.Email,
 		)
 
-		lang := getPreferredLanguage(c)
+		lang := getPreferredLanguage(c, &user)
 
 		err := SendPasswordResetEmail(user.Email, resetLink, lang)
 		if err != nil {
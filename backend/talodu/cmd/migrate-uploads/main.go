@@ -0,0 +1,169 @@
+// Command migrate-uploads copies the files referenced by the legacy url
+// columns of product_images, site_images and site_logos into the configured
+// storage backend and records their object keys.
+//
+//	go run ./cmd/migrate-uploads [-dry-run] [-source .]
+//
+// Rows that already have a key are skipped, so the command can be run again
+// after a failure. Objects already present in the store are not copied, which
+// makes the migration a no-op for files when the local driver keeps ./uploads.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	s "talodu/settings"
+	"talodu/storage"
+
+	"gorm.io/gorm"
+)
+
+// legacyColumns maps the url columns of each table to the key columns replacing them
+var legacyColumns = []struct {
+	table   string
+	columns map[string]string
+}{
+	{"product_images", map[string]string{
+		"url":           "key",
+		"thumbnail_url": "thumbnail_key",
+		"medium_url":    "medium_key",
+		"large_url":     "large_key",
+		"webp_url":      "webp_key",
+	}},
+	{"site_images", map[string]string{
+		"url":           "key",
+		"thumbnail_url": "thumbnail_key",
+		"medium_url":    "medium_key",
+		"large_url":     "large_key",
+		"webp_url":      "webp_key",
+	}},
+	{"site_logos", map[string]string{
+		"url": "key",
+	}},
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report what would be migrated without copying files or updating rows")
+	source := flag.String("source", ".", "directory the legacy /uploads URLs are relative to")
+	flag.Parse()
+
+	s.ConnectDB()
+	if err := storage.Init(); err != nil {
+		log.Fatalf("Failed to initialize file storage: %v", err)
+	}
+
+	ctx := context.Background()
+	failed := 0
+	for _, legacy := range legacyColumns {
+		migrated, errs := migrateTable(ctx, s.DB, legacy.table, legacy.columns, *source, *dryRun)
+		for _, err := range errs {
+			log.Printf("%s: %v", legacy.table, err)
+		}
+		failed += len(errs)
+		log.Printf("%s: %d rows migrated, %d errors", legacy.table, migrated, len(errs))
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func migrateTable(ctx context.Context, db *gorm.DB, table string, columns map[string]string, source string, dryRun bool) (int, []error) {
+	var urlColumns []string
+	for urlColumn, keyColumn := range columns {
+		if !db.Migrator().HasColumn(table, urlColumn) {
+			continue
+		}
+		if !db.Migrator().HasColumn(table, keyColumn) {
+			return 0, []error{fmt.Errorf("column %s is missing, start the API once to migrate the schema", keyColumn)}
+		}
+		urlColumns = append(urlColumns, urlColumn)
+	}
+	if len(urlColumns) == 0 {
+		return 0, nil
+	}
+
+	var rows []map[string]interface{}
+	if err := db.Table(table).
+		Select(append([]string{"id"}, urlColumns...)).
+		Where("(key IS NULL OR key = '') AND url IS NOT NULL AND url <> ''").
+		Find(&rows).Error; err != nil {
+		return 0, []error{err}
+	}
+
+	migrated := 0
+	var errs []error
+	for _, row := range rows {
+		updates := make(map[string]interface{})
+		for _, urlColumn := range urlColumns {
+			url, _ := row[urlColumn].(string)
+			if url == "" {
+				continue
+			}
+			key, err := copyFile(ctx, url, source, dryRun)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("row %v: %s: %w", row["id"], url, err))
+				continue
+			}
+			updates[columns[urlColumn]] = key
+		}
+
+		if len(updates) == 0 {
+			continue
+		}
+		if dryRun {
+			log.Printf("%s %v: %v", table, row["id"], updates)
+			migrated++
+			continue
+		}
+		if err := db.Table(table).Where("id = ?", row["id"]).Updates(updates).Error; err != nil {
+			errs = append(errs, fmt.Errorf("row %v: %w", row["id"], err))
+			continue
+		}
+		migrated++
+	}
+	return migrated, errs
+}
+
+// copyFile puts the file behind a legacy /uploads/... URL in the store and returns its key
+func copyFile(ctx context.Context, url, source string, dryRun bool) (string, error) {
+	key, err := storage.CleanKey(strings.TrimPrefix(strings.TrimPrefix(url, "/"), "uploads/"))
+	if err != nil {
+		return "", err
+	}
+
+	if existing, err := storage.Default.Get(ctx, key); err == nil {
+		existing.Close()
+		return key, nil
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return "", err
+	}
+
+	file, err := os.Open(filepath.Join(source, filepath.FromSlash(strings.TrimPrefix(url, "/"))))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if dryRun {
+		return key, nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	contentType := mime.TypeByExtension(strings.ToLower(filepath.Ext(key)))
+	if err := storage.Default.Put(ctx, key, file, info.Size(), contentType); err != nil {
+		return "", err
+	}
+	return key, nil
+}
@@ -0,0 +1,80 @@
+// Package currency has the rounding rules of ISO 4217 currencies: amounts
+// are rounded to the minor unit of their currency, e.g. cents for EUR and
+// whole francs for XAF.
+package currency
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// minorDigits are the currencies whose minor unit isn't the cent
+var minorDigits = map[string]int{
+	// No decimals
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	// Three decimals
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// Normalize uppercases a currency code: "xaf" is "XAF"
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Valid tells whether code looks like an ISO 4217 code, three letters
+func Valid(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Decimals returns the number of digits of the minor unit of code
+func Decimals(code string) int {
+	if digits, ok := minorDigits[Normalize(code)]; ok {
+		return digits
+	}
+	return 2
+}
+
+// Round rounds amount to the minor unit of code, halves away from zero. The
+// decimal point is moved on the shortest decimal form of amount: in binary
+// floating point 12.345*100 is 1234.4999..., which would round down.
+func Round(amount float64, code string) float64 {
+	decimals := Decimals(code)
+	whole, fraction, _ := strings.Cut(strconv.FormatFloat(math.Abs(amount), 'f', -1, 64), ".")
+	fraction += strings.Repeat("0", decimals)
+	shifted, err := strconv.ParseFloat(whole+fraction[:decimals]+"."+fraction[decimals:], 64)
+	if err != nil {
+		return amount // NaN or infinite
+	}
+	return math.Copysign(math.Round(shifted)/math.Pow10(decimals), amount)
+}
+
+// ScaleSQL is an SQL expression of the number of minor units in a major unit
+// of the currency in column, to compare amounts stored in minor units with
+// amounts in major units
+func ScaleSQL(column string) string {
+	codes := make([]string, 0, len(minorDigits))
+	for code := range minorDigits {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	var b strings.Builder
+	b.WriteString("(CASE " + column)
+	for _, code := range codes {
+		fmt.Fprintf(&b, " WHEN '%s' THEN %d", code, int64(math.Pow10(minorDigits[code])))
+	}
+	b.WriteString(" ELSE 100 END)")
+	return b.String()
+}
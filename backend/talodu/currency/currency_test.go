@@ -0,0 +1,90 @@
+package currency
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestDecimals(t *testing.T) {
+	tests := []struct {
+		code string
+		want int
+	}{
+		{"XAF", 0},
+		{"xaf", 0},
+		{" XOF ", 0},
+		{"JPY", 0},
+		{"EUR", 2},
+		{"USD", 2},
+		{"KWD", 3},
+		{"TND", 3},
+		{"", 2}, // Unknown currencies have cents
+		{"ZZZ", 2},
+	}
+	for _, tt := range tests {
+		if got := Decimals(tt.code); got != tt.want {
+			t.Errorf("Decimals(%q) = %d, want %d", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		amount float64
+		code   string
+		want   float64
+	}{
+		{1499.4, "XAF", 1499},
+		{1499.5, "XAF", 1500},
+		{0.5, "XAF", 1},
+		{-0.5, "XAF", -1},
+		{-1499.5, "XAF", -1500},
+		{655.957, "XAF", 656},
+		{12.344, "EUR", 12.34},
+		{12.345, "EUR", 12.35}, // 1234.4999... in binary
+		{1.005, "EUR", 1.01},
+		{-1.005, "EUR", -1.01},
+		{0.125, "EUR", 0.13},
+		{19.99, "EUR", 19.99},
+		{1.0005, "KWD", 1.001},
+		{1.2344, "KWD", 1.234},
+		{-2.0625, "KWD", -2.063},
+		{0, "EUR", 0},
+		{1e15, "EUR", 1e15},
+	}
+	for _, tt := range tests {
+		if got := Round(tt.amount, tt.code); got != tt.want {
+			t.Errorf("Round(%v, %s) = %v, want %v", tt.amount, tt.code, got, tt.want)
+		}
+	}
+
+	if got := Round(math.Inf(1), "EUR"); !math.IsInf(got, 1) {
+		t.Errorf("Round(+Inf) = %v", got)
+	}
+	if got := Round(math.NaN(), "EUR"); !math.IsNaN(got) {
+		t.Errorf("Round(NaN) = %v", got)
+	}
+}
+
+func TestScaleSQLMatchesDecimals(t *testing.T) {
+	sql := ScaleSQL("products.currency")
+	if !strings.HasPrefix(sql, "(CASE products.currency ") || !strings.HasSuffix(sql, " ELSE 100 END)") {
+		t.Fatalf("ScaleSQL = %s", sql)
+	}
+	for code := range minorDigits {
+		when := fmt.Sprintf(" WHEN '%s' THEN %d ", code, int64(math.Pow10(Decimals(code))))
+		if !strings.Contains(sql, when) {
+			t.Errorf("ScaleSQL has no %q", when)
+		}
+	}
+	if n := strings.Count(sql, " WHEN "); n != len(minorDigits) {
+		t.Errorf("ScaleSQL has %d cases, want one per currency without cents: %d", n, len(minorDigits))
+	}
+	for _, code := range []string{"EUR", "USD", "GBP"} {
+		if strings.Contains(sql, "'"+code+"'") {
+			t.Errorf("ScaleSQL lists %s, currencies with cents fall back to 100", code)
+		}
+	}
+}
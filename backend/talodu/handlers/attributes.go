@@ -0,0 +1,589 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"talodu/i18n"
+	"talodu/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Categories define typed attributes (see models.AttributeDefinition) and
+// products carry values for the attributes of their categories. Values are
+// sent with the product as [{"attribute_id": 3, "value": 6.1}], they are
+// validated against the definitions and replace the previous ones.
+//
+// Lists filter on attributes by code: ?attr[ram]=8GB,16GB matches any of the
+// values, ?attr[screen_size]=6..7 a range of numbers (either bound optional).
+
+var attributeCodePattern = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
+// loadProductAttributes loads the attribute values of a product, in the order
+// of their definitions, translated for lang
+func loadProductAttributes(db *gorm.DB, productID uint, lang string) ([]models.ProductAttributeValue, error) {
+	values := []models.ProductAttributeValue{}
+	err := db.Preload("Attribute.Translations").Preload("Translations").
+		Joins("JOIN attribute_definitions ad ON ad.id = product_attribute_values.attribute_definition_id").
+		Where("product_attribute_values.product_id = ?", productID).
+		Order("ad.position ASC, ad.id ASC").
+		Find(&values).Error
+	for i := range values {
+		values[i].Localize(lang)
+	}
+	return values, err
+}
+
+// productAttributeInput is an attribute value sent with a product
+type productAttributeInput struct {
+	AttributeID  uint              `json:"attribute_id" binding:"required"`
+	Value        interface{}       `json:"value"`
+	Translations map[string]string `json:"translations"` // Text values only, by language
+}
+
+// attributeValidationError is a value that doesn't match its definition, a 400
+type attributeValidationError struct {
+	Message string
+}
+
+func (e *attributeValidationError) Error() string {
+	return e.Message
+}
+
+// validateProductAttributes checks the values against the attributes of the
+// categories and returns them ready to be saved. Every required attribute
+// must have a value.
+func validateProductAttributes(db *gorm.DB, categoryIDs []uint, inputs []productAttributeInput) ([]models.ProductAttributeValue, error) {
+	var definitions []models.AttributeDefinition
+	if len(categoryIDs) > 0 {
+		if err := db.Where("category_id IN ?", categoryIDs).Find(&definitions).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[uint]models.AttributeDefinition, len(definitions))
+	for _, definition := range definitions {
+		byID[definition.ID] = definition
+	}
+
+	values := make([]models.ProductAttributeValue, 0, len(inputs))
+	seen := make(map[uint]bool)
+	for _, input := range inputs {
+		definition, ok := byID[input.AttributeID]
+		if !ok {
+			return nil, &attributeValidationError{fmt.Sprintf("attribute %d is not an attribute of the product categories", input.AttributeID)}
+		}
+		if seen[definition.ID] {
+			return nil, &attributeValidationError{fmt.Sprintf("attribute %s is set twice", definition.Code)}
+		}
+		seen[definition.ID] = true
+		if input.Value == nil || input.Value == "" {
+			continue // No value, same as leaving it out
+		}
+
+		value := models.ProductAttributeValue{AttributeDefinitionID: definition.ID}
+		invalid := func(expected string) error {
+			return &attributeValidationError{fmt.Sprintf("attribute %s must be %s", definition.Code, expected)}
+		}
+
+		switch definition.Type {
+		case models.AttributeTypeNumber:
+			number, ok := input.Value.(float64)
+			if !ok {
+				return nil, invalid("a number")
+			}
+			value.NumberValue = &number
+			value.Value = strconv.FormatFloat(number, 'f', -1, 64)
+		case models.AttributeTypeBoolean:
+			boolean, ok := input.Value.(bool)
+			if !ok {
+				return nil, invalid("true or false")
+			}
+			value.Value = strconv.FormatBool(boolean)
+		case models.AttributeTypeEnum:
+			option, ok := input.Value.(string)
+			if !ok || !containsString(definition.Options, option) {
+				return nil, invalid("one of: " + strings.Join(definition.Options, ", "))
+			}
+			value.Value = option
+		default:
+			text, ok := input.Value.(string)
+			if !ok || len(text) > 255 {
+				return nil, invalid("a text of at most 255 characters")
+			}
+			value.Value = strings.TrimSpace(text)
+			for lang, translation := range input.Translations {
+				if !importLanguages[lang] || len(translation) > 255 {
+					return nil, invalid("translated in en, fr or es, in at most 255 characters")
+				}
+				value.Translations = append(value.Translations, models.ProductAttributeValueTranslation{Language: lang, Value: strings.TrimSpace(translation)})
+			}
+		}
+		values = append(values, value)
+	}
+
+	for _, definition := range definitions {
+		if !definition.Required {
+			continue
+		}
+		found := false
+		for _, value := range values {
+			found = found || value.AttributeDefinitionID == definition.ID
+		}
+		if !found {
+			return nil, &attributeValidationError{fmt.Sprintf("attribute %s is required", definition.Code)}
+		}
+	}
+	return values, nil
+}
+
+// saveProductAttributes replaces the attribute values of a product
+func saveProductAttributes(tx *gorm.DB, productID uint, values []models.ProductAttributeValue) error {
+	if err := tx.Where("product_id = ?", productID).Delete(&models.ProductAttributeValue{}).Error; err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	for i := range values {
+		values[i].ProductID = productID
+	}
+	return tx.Create(&values).Error
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// applyAttributeFilters restricts a product query to the ?attr[code]= filters
+func applyAttributeFilters(query *gorm.DB, filters map[string]string) (*gorm.DB, error) {
+	codes := make([]string, 0, len(filters))
+	for code := range filters {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		filter := strings.TrimSpace(filters[code])
+		if filter == "" {
+			continue
+		}
+		if !attributeCodePattern.MatchString(code) {
+			return nil, fmt.Errorf("invalid attribute code %q", code)
+		}
+
+		exists := `EXISTS (SELECT 1 FROM product_attribute_values pav
+			JOIN attribute_definitions ad ON ad.id = pav.attribute_definition_id
+			WHERE pav.product_id = products.id AND ad.code = ?`
+		if low, high, isRange := strings.Cut(filter, ".."); isRange {
+			conditions := []string{exists}
+			args := []interface{}{code}
+			for _, bound := range []struct {
+				value    string
+				operator string
+			}{{low, ">="}, {high, "<="}} {
+				if bound.value == "" {
+					continue
+				}
+				number, err := strconv.ParseFloat(strings.TrimSpace(bound.value), 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid range for attribute %s, expected min..max", code)
+				}
+				conditions = append(conditions, "pav.number_value "+bound.operator+" ?")
+				args = append(args, number)
+			}
+			query = query.Where(strings.Join(conditions, " AND ")+")", args...)
+			continue
+		}
+
+		var values []string
+		for _, value := range strings.Split(filter, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		query = query.Where(exists+" AND pav.value IN ?)", code, values)
+	}
+	return query, nil
+}
+
+// GET /categories/:id/attributes?lang=fr - Attribute definitions of a
+// category, untranslated unless a language is requested as they are edited
+// from this list
+func ListCategoryAttributes(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lang := i18n.QueryLanguage(c)
+
+		var definitions []models.AttributeDefinition
+		if err := db.Preload("Translations").
+			Where("category_id = ?", c.Param("id")).
+			Order("position ASC, id ASC").
+			Find(&definitions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attributes"})
+			return
+		}
+		for i := range definitions {
+			definitions[i].Localize(lang)
+		}
+
+		c.JSON(http.StatusOK, definitions)
+	}
+}
+
+// attributeDefinitionInput is the body of the create and update endpoints
+type attributeDefinitionInput struct {
+	Code       string               `json:"code" binding:"required"`
+	Name       string               `json:"name" binding:"required,max=100"`
+	Type       models.AttributeType `json:"type" binding:"required,oneof=text number boolean enum"`
+	Unit       string               `json:"unit" binding:"max=20"`
+	Options    []string             `json:"options"`
+	Required   bool                 `json:"required"`
+	Filterable *bool                `json:"filterable"`
+	Position   int                  `json:"position"`
+}
+
+// apply validates the input and copies it to the definition
+func (input attributeDefinitionInput) apply(definition *models.AttributeDefinition) error {
+	if !attributeCodePattern.MatchString(input.Code) {
+		return errors.New("code must be made of lowercase letters, digits and underscores")
+	}
+	options := []string{}
+	for _, option := range input.Options {
+		if option = strings.TrimSpace(option); option != "" && !containsString(options, option) {
+			options = append(options, option)
+		}
+	}
+	if input.Type == models.AttributeTypeEnum && len(options) == 0 {
+		return errors.New("an enum attribute needs options")
+	}
+	if input.Type != models.AttributeTypeEnum {
+		options = []string{}
+	}
+	if input.Type != models.AttributeTypeNumber && input.Unit != "" {
+		return errors.New("only number attributes have a unit")
+	}
+
+	definition.Code = input.Code
+	definition.Name = strings.TrimSpace(input.Name)
+	definition.Type = input.Type
+	definition.Unit = input.Unit
+	definition.Options = options
+	definition.Required = input.Required
+	definition.Filterable = input.Filterable == nil || *input.Filterable
+	definition.Position = input.Position
+	return nil
+}
+
+// POST /categories/:id/attributes - Define an attribute for the products of a category
+func CreateCategoryAttribute(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var category models.Category
+		if err := db.First(&category, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Category not found")})
+			return
+		}
+
+		var input attributeDefinitionInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		definition := models.AttributeDefinition{CategoryID: category.ID}
+		if err := input.apply(&definition); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var count int64
+		db.Model(&models.AttributeDefinition{}).Where("category_id = ? AND code = ?", category.ID, definition.Code).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "The category already has an attribute with this code"})
+			return
+		}
+		if err := db.Create(&definition).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create attribute"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, definition)
+	}
+}
+
+// PUT /categories/:id/attributes/:attributeId - Update an attribute definition.
+// Values no longer valid (removed enum options) are deleted.
+func UpdateCategoryAttribute(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var definition models.AttributeDefinition
+		if err := db.Where("category_id = ?", c.Param("id")).First(&definition, c.Param("attributeId")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Attribute not found")})
+			return
+		}
+
+		var input attributeDefinitionInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		previousType := definition.Type
+		if err := input.apply(&definition); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var count int64
+		db.Model(&models.AttributeDefinition{}).Where("category_id = ? AND code = ? AND id <> ?", definition.CategoryID, definition.Code, definition.ID).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "The category already has an attribute with this code"})
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&definition).Error; err != nil {
+				return err
+			}
+			values := tx.Where("attribute_definition_id = ?", definition.ID)
+			switch {
+			case definition.Type != previousType:
+				// Values of another type can't be converted
+				return values.Delete(&models.ProductAttributeValue{}).Error
+			case definition.Type == models.AttributeTypeEnum:
+				return values.Where("value NOT IN ?", []string(definition.Options)).Delete(&models.ProductAttributeValue{}).Error
+			}
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update attribute"})
+			return
+		}
+
+		c.JSON(http.StatusOK, definition)
+	}
+}
+
+// DELETE /categories/:id/attributes/:attributeId - Delete an attribute and its product values
+func DeleteCategoryAttribute(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var definition models.AttributeDefinition
+		if err := db.Where("category_id = ?", c.Param("id")).First(&definition, c.Param("attributeId")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Attribute not found")})
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("attribute_definition_id = ?", definition.ID).Delete(&models.ProductAttributeValue{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("attribute_definition_id = ?", definition.ID).Delete(&models.AttributeDefinitionTranslation{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&definition).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attribute"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Attribute deleted"})
+	}
+}
+
+// PUT /categories/:id/attributes/:attributeId/translations - Create or update
+// the translation of an attribute name and of its enum options
+func UpsertAttributeTranslation(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var definition models.AttributeDefinition
+		if err := db.Where("category_id = ?", c.Param("id")).First(&definition, c.Param("attributeId")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Attribute not found")})
+			return
+		}
+
+		var input struct {
+			Language     string            `json:"language" binding:"required"`
+			Name         string            `json:"name" binding:"max=100"`
+			OptionLabels map[string]string `json:"option_labels"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		input.Language = strings.ToLower(strings.TrimSpace(input.Language))
+		if !importLanguages[input.Language] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "language must be en, fr or es"})
+			return
+		}
+		labels := make(map[string]string)
+		for option, label := range input.OptionLabels {
+			if !containsString(definition.Options, option) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%q is not an option of the attribute", option)})
+				return
+			}
+			labels[option] = label
+		}
+
+		translation := models.AttributeDefinitionTranslation{
+			AttributeDefinitionID: definition.ID,
+			Language:              input.Language,
+			Name:                  input.Name,
+			OptionLabels:          datatypes.NewJSONType(labels),
+		}
+		if err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "attribute_definition_id"}, {Name: "language"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "option_labels", "updated_at"}),
+		}).Create(&translation).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save translation"})
+			return
+		}
+
+		c.JSON(http.StatusOK, translation)
+	}
+}
+
+// attributeFacet is a filterable attribute with the values of the matching products
+type attributeFacet struct {
+	AttributeID uint                 `json:"attribute_id"`
+	Code        string               `json:"code"`
+	Name        string               `json:"name"`
+	Type        models.AttributeType `json:"type"`
+	Unit        string               `json:"unit,omitempty"`
+	Values      []facetValue         `json:"values,omitempty"` // Text, enum and boolean attributes
+	Min         *float64             `json:"min,omitempty"`    // Number attributes
+	Max         *float64             `json:"max,omitempty"`
+	Count       int64                `json:"count"` // Products with a value
+}
+
+type facetValue struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+	Count int64  `json:"count"`
+}
+
+// GET /products/facets?category_id=1&search=...&attr[ram]=8GB - The
+// filterable attributes of a category with the values of the visible products
+// matching the filters, and how many products have each value. The filter of
+// an attribute doesn't apply to its own counts.
+func GetProductFacets(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lang := i18n.Language(c)
+		categoryID, err := strconv.ParseUint(c.Query("category_id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "category_id is required"})
+			return
+		}
+
+		var definitions []models.AttributeDefinition
+		if err := db.Preload("Translations").
+			Where("category_id = ? AND filterable = ?", categoryID, true).
+			Order("position ASC, id ASC").
+			Find(&definitions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attributes"})
+			return
+		}
+
+		// The visible products of the category matching the search and the
+		// attribute filters
+		filters := c.QueryMap("attr")
+		matching := func(filters map[string]string) (*gorm.DB, error) {
+			products := db.Model(&models.Product{}).Select("products.id").
+				Where("is_visible = ?", true).
+				Where("products.id IN (SELECT product_id FROM product_categories WHERE category_id = ?)", categoryID)
+			products = applyProductSearch(db, products, c.Query("search"), lang)
+			return applyAttributeFilters(products, filters)
+		}
+		if _, err := matching(filters); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// An attribute is counted without its own filter, so the other values
+		// of a filtered attribute keep the counts selecting them would give.
+		// The attributes without a filter share the query with all the filters.
+		type facetCount struct {
+			AttributeDefinitionID uint
+			Value                 string
+			Count                 int64
+			Min                   *float64
+			Max                   *float64
+		}
+		var counts []facetCount
+		groups := map[string][]uint{}
+		for _, definition := range definitions {
+			code := ""
+			if strings.TrimSpace(filters[definition.Code]) != "" {
+				code = definition.Code
+			}
+			groups[code] = append(groups[code], definition.ID)
+		}
+		for code, ids := range groups {
+			others := filters
+			if code != "" {
+				others = make(map[string]string, len(filters))
+				for other, filter := range filters {
+					if other != code {
+						others[other] = filter
+					}
+				}
+			}
+			products, _ := matching(others)
+			var rows []facetCount
+			if err := db.Table("product_attribute_values").
+				Select("attribute_definition_id, value, COUNT(DISTINCT product_id) AS count, MIN(number_value) AS min, MAX(number_value) AS max").
+				Where("attribute_definition_id IN ? AND product_id IN (?)", ids, products).
+				Group("attribute_definition_id, value").
+				Order("count DESC, value ASC").
+				Scan(&rows).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute facets"})
+				return
+			}
+			counts = append(counts, rows...)
+		}
+
+		facets := make([]attributeFacet, 0, len(definitions))
+		for _, definition := range definitions {
+			definition.Localize(lang)
+			facet := attributeFacet{
+				AttributeID: definition.ID,
+				Code:        definition.Code,
+				Name:        definition.Name,
+				Type:        definition.Type,
+				Unit:        definition.Unit,
+			}
+			for _, row := range counts {
+				if row.AttributeDefinitionID != definition.ID {
+					continue
+				}
+				facet.Count += row.Count
+				if definition.Type == models.AttributeTypeNumber {
+					if row.Min != nil && (facet.Min == nil || *row.Min < *facet.Min) {
+						facet.Min = row.Min
+					}
+					if row.Max != nil && (facet.Max == nil || *row.Max > *facet.Max) {
+						facet.Max = row.Max
+					}
+					continue
+				}
+				label := row.Value
+				if translated := definition.OptionLabels[row.Value]; translated != "" {
+					label = translated
+				}
+				facet.Values = append(facet.Values, facetValue{Value: row.Value, Label: label, Count: row.Count})
+			}
+			if facet.Count > 0 {
+				facets = append(facets, facet)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"category_id": categoryID, "facets": facets})
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"talodu/i18n"
+	"talodu/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Bundles ("phone + case + charger") are sold at their own price, their
+// stock is the stock of their components: ordering a bundle takes the
+// components out of the stock, see takeFromStock.
+
+// loadBundleComponents loads the components of a bundle with their products
+func loadBundleComponents(db *gorm.DB, product *models.Product) error {
+	if !product.IsBundle() {
+		return nil
+	}
+	return db.Preload("Component").
+		Preload("Component.Translations").
+		Where("bundle_id = ?", product.ID).
+		Order("id ASC").
+		Find(&product.BundleComponents).Error
+}
+
+// takeFromStock takes the ordered units out of the stock, those of the
+// components for a bundle, and returns the breakdown of a bundle. It fails
+// with models.ErrInsufficientStock when a product runs out.
+func takeFromStock(tx *gorm.DB, product *models.Product, quantity int) ([]models.OrderItemComponent, error) {
+	if !product.IsBundle() {
+		if err := models.DecrementStock(tx, product.ID, quantity); err != nil {
+			return nil, stockError(err, product.Name)
+		}
+		return nil, nil
+	}
+
+	if len(product.BundleComponents) == 0 {
+		return nil, stockError(models.ErrInsufficientStock, product.Name)
+	}
+	components := make([]models.OrderItemComponent, 0, len(product.BundleComponents))
+	for _, component := range product.BundleComponents {
+		if component.Component == nil {
+			// A deleted component
+			return nil, stockError(models.ErrInsufficientStock, product.Name)
+		}
+		units := component.Quantity * quantity
+		if err := models.DecrementStock(tx, component.ComponentID, units); err != nil {
+			return nil, stockError(err, component.Component.Name)
+		}
+		components = append(components, models.OrderItemComponent{
+			ProductID: component.ComponentID,
+			Name:      component.Component.Name,
+			SKU:       component.Component.SKU,
+			Quantity:  units,
+		})
+	}
+	return components, nil
+}
+
+// stockError names the product that ran out of stock
+func stockError(err error, productName string) error {
+	if errors.Is(err, models.ErrInsufficientStock) {
+		return fmt.Errorf("%w for product %s", err, productName)
+	}
+	return err
+}
+
+// PUT /products/:id/bundle - Make a product a bundle of other products of its
+// shop, or a simple product again when there are no components
+func SetProductBundle(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Components []struct {
+				ProductID uint `json:"product_id" binding:"required"`
+				Quantity  int  `json:"quantity" binding:"required,min=1"`
+			} `json:"components" binding:"dive"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		product, _, ok := loadManagedProduct(c, db)
+		if !ok {
+			return
+		}
+
+		var parents int64
+		db.Model(&models.BundleComponent{}).Where("component_id = ?", product.ID).Count(&parents)
+		if parents > 0 && len(input.Components) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "The product is a component of a bundle, it can't be a bundle itself"})
+			return
+		}
+
+		components := make([]models.BundleComponent, 0, len(input.Components))
+		seen := make(map[uint]bool)
+		for _, component := range input.Components {
+			if component.ProductID == product.ID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "A bundle can't contain itself"})
+				return
+			}
+			if seen[component.ProductID] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Product %d is listed twice", component.ProductID)})
+				return
+			}
+			seen[component.ProductID] = true
+
+			var found models.Product
+			if err := db.Select("id", "shop_id", "type").First(&found, component.ProductID).Error; err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("product %d not found", component.ProductID)})
+				return
+			}
+			if found.ShopID != product.ShopID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Product %d belongs to another shop", component.ProductID)})
+				return
+			}
+			if found.IsBundle() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Product %d is a bundle, bundles can't be nested", component.ProductID)})
+				return
+			}
+			components = append(components, models.BundleComponent{
+				BundleID:    product.ID,
+				ComponentID: component.ProductID,
+				Quantity:    component.Quantity,
+			})
+		}
+
+		productType := models.ProductTypeSimple
+		if len(components) > 0 {
+			productType = models.ProductTypeBundle
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("bundle_id = ?", product.ID).Delete(&models.BundleComponent{}).Error; err != nil {
+				return err
+			}
+			if len(components) > 0 {
+				if err := tx.Create(&components).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Model(product).Update("type", productType).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update the bundle"})
+			return
+		}
+
+		if err := db.First(product, product.ID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
+			return
+		}
+		if err := loadBundleComponents(db, product); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bundle components"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Bundle updated", "product": product})
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"net/http"
 	"talodu/auth"
+	"talodu/i18n"
 	"talodu/models"
+	"talodu/money"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -29,7 +32,7 @@ func AddToCart(db *gorm.DB) gin.HandlerFunc {
 		// Get authenticated user
 		authUser, err := auth.GetAuthUser(c)
 		if err != nil || authUser == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Authentication required")})
 			return
 		}
 
@@ -43,10 +46,10 @@ func AddToCart(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Check product exists and get current price
+		// Check product exists and get current price, drafts and hidden products can't be bought
 		var product Product
-		if err := db.First(&product, input.ProductID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		if err := db.First(&product, input.ProductID).Error; err != nil || !product.Orderable(time.Now()) {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
 			return
 		}
 
@@ -67,7 +70,8 @@ func AddToCart(db *gorm.DB) gin.HandlerFunc {
 			if err := db.Model(&existingItem).
 				Updates(map[string]interface{}{
 					"quantity": newQuantity,
-					"price":    product.Price, // Update to current price
+					"price":    product.EffectivePrice, // Update to current price
+					"currency": product.Currency,
 				}).Error; err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart"})
 				return
@@ -78,7 +82,7 @@ func AddToCart(db *gorm.DB) gin.HandlerFunc {
 				UserID:    authUser.ID,
 				ProductID: input.ProductID,
 				Quantity:  input.Quantity,
-				Price:     product.Price,
+				Price:     product.EffectivePrice,
 			}
 
 			if err := db.Create(&cartItem).Error; err != nil {
@@ -99,7 +103,7 @@ func GetCart(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authUser, err := auth.GetAuthUser(c)
 		if err != nil || authUser == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Authentication required")})
 			return
 		}
 
@@ -112,15 +116,37 @@ func GetCart(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Calculate total
-		var total float64
-		for _, item := range cartItems {
-			total += item.Price * float64(item.Quantity)
+		// The cart is in one currency, the requested one or the site currency
+		prices, ok := newPriceConverter(c, db)
+		if !ok {
+			return
+		}
+		if prices.target == "" {
+			prices.target = prices.site
+		}
+
+		// Calculate total at the current prices, a sale may have started or ended since the items were added
+		total := money.New(0, prices.target)
+		for i, item := range cartItems {
+			if item.Product.ID != 0 {
+				if !prices.product(c, &cartItems[i].Product) {
+					return
+				}
+				cartItems[i].Price = cartItems[i].Product.EffectivePrice
+			} else if price, _, err := prices.convert(item.Price, prices.target); err == nil {
+				cartItems[i].Price = price // Snapshot of a deleted product
+			}
+			cartItems[i].Currency = cartItems[i].Price.Currency
+			// An item without exchange rate to the cart currency is left out of the total
+			if subtotal, err := total.Add(cartItems[i].Price.Mul(item.Quantity)); err == nil {
+				total = subtotal
+			}
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"items": cartItems,
-			"total": total,
+			"items":    cartItems,
+			"total":    total,
+			"currency": prices.target,
 		})
 	}
 }
@@ -130,7 +156,7 @@ func UpdateCartItem(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authUser, err := auth.GetAuthUser(c)
 		if err != nil || authUser == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Authentication required")})
 			return
 		}
 
@@ -156,7 +182,7 @@ func UpdateCartItem(db *gorm.DB) gin.HandlerFunc {
 		// Check product stock
 		var product Product
 		if err := db.First(&product, cartItem.ProductID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
 			return
 		}
 
@@ -180,7 +206,7 @@ func RemoveFromCart(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authUser, err := auth.GetAuthUser(c)
 		if err != nil || authUser == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Authentication required")})
 			return
 		}
 
@@ -201,7 +227,7 @@ func ClearCart(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authUser, err := auth.GetAuthUser(c)
 		if err != nil || authUser == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Authentication required")})
 			return
 		}
 
@@ -0,0 +1,469 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"talodu/i18n"
+	"talodu/models"
+	"talodu/settings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Collections are the products merchandised in the slots of the storefront:
+// the homepage hero, the deals of the day, the spotlight of a category page.
+// Their products are picked by hand and ordered by drag and drop, or selected
+// by a rule. Each slot shows as many products as its display settings say.
+
+const defaultCollectionProductCount = 8
+
+// collectionProductIDs returns the visible products of the collection in
+// their order, at most limit
+func collectionProductIDs(db *gorm.DB, collection models.Collection, lang string, limit int) ([]uint, error) {
+	if collection.Mode != models.CollectionModeRule {
+		return models.CollectionProductIDs(db, collection.ID, limit)
+	}
+
+	rule := collection.Rule.Data()
+	query := db.Model(&models.Product{}).Where("products.is_visible = ?", true)
+	if len(rule.CategoryIDs) > 0 {
+		query = query.Where("products.id IN (SELECT product_id FROM product_categories WHERE category_id IN ?)", rule.CategoryIDs)
+	}
+	if rule.ShopID != nil {
+		query = query.Where("products.shop_id = ?", *rule.ShopID)
+	}
+	if rule.Featured {
+		query = query.Where("products.is_featured = ?", true)
+	}
+	if rule.OnSale {
+		query = query.Where(models.EffectivePriceSQL + " < products.price")
+	}
+	if rule.InStock {
+		query = query.Where(models.StockSQL + " > 0")
+	}
+	if rule.MinRating > 0 {
+		query = query.Where("products.rating >= ?", rule.MinRating)
+	}
+
+	keys, err := productSortRegistry.Parse(rule.Sort, lang)
+	if err != nil {
+		return nil, err
+	}
+	rates, err := models.LoadExchangeRates(db)
+	if err != nil {
+		return nil, err
+	}
+	prices := &priceConverter{site: siteCurrency(db), rates: rates} // Prices are compared in the site currency
+	keys = prices.sortKeys(keys)
+	pagination := Pagination{Page: 1, Limit: limit}
+	if query, err = pagination.Apply(query, keys); err != nil {
+		return nil, err
+	}
+	ids := []uint{}
+	err = query.Pluck("products.id", &ids).Error
+	return ids, err
+}
+
+// GET /collections?slot=category_spotlight&category_id=3 - The live
+// collections of a slot, in their order, without their products
+func ListCollections(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := models.LiveCollections(db.Preload("Translations"), time.Now())
+		if slot := c.Query("slot"); slot != "" {
+			query = query.Where("slot = ?", slot)
+		}
+		if categoryID := c.Query("category_id"); categoryID != "" {
+			query = query.Where("category_id = ?", categoryID)
+		}
+
+		var collections []models.Collection
+		if err := query.Order("position ASC, id ASC").Find(&collections).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch collections"})
+			return
+		}
+		lang := i18n.Language(c)
+		for i := range collections {
+			collections[i].Localize(lang)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"collections": collections, "count": len(collections)})
+	}
+}
+
+// GET /collections/:slug - A live collection and its products, translated in
+// the language of the request
+func GetCollection(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var collection models.Collection
+		if err := db.Preload("Translations").Where("slug = ?", c.Param("slug")).First(&collection).Error; err != nil || !collection.IsLive(time.Now()) {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Collection not found")})
+			return
+		}
+		lang := i18n.Language(c)
+		collection.Localize(lang)
+
+		limit := settings.LoadDisplaySettings(db).SlotProductCount(string(collection.Slot))
+		if limit <= 0 {
+			limit = defaultCollectionProductCount
+		}
+		ids, err := collectionProductIDs(db, collection, lang, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch collection products"})
+			return
+		}
+		respondWithProducts(c, db, ids, gin.H{"collection": collection})
+	}
+}
+
+// GET /admin/collections?slot=deals_of_the_day - Every collection, scheduled
+// and inactive ones included, untranslated as they are edited from this list
+func ListCollectionsAdmin(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Preload("Translations")
+		if slot := c.Query("slot"); slot != "" {
+			query = query.Where("slot = ?", slot)
+		}
+
+		var collections []models.Collection
+		if err := query.Order("slot ASC, position ASC, id ASC").Find(&collections).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch collections"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"collections": collections, "count": len(collections)})
+	}
+}
+
+// collectionInput is the body of the create and update endpoints
+type collectionInput struct {
+	Slug        string                `json:"slug" binding:"max=100"` // Made from the name when empty
+	Name        string                `json:"name" binding:"required,max=255"`
+	Description string                `json:"description"`
+	Slot        models.CollectionSlot `json:"slot" binding:"required"`
+	CategoryID  *uint                 `json:"category_id"`
+	Mode        models.CollectionMode `json:"mode" binding:"omitempty,oneof=manual rule"`
+	Rule        models.CollectionRule `json:"rule"`
+	Position    int                   `json:"position"`
+	IsActive    *bool                 `json:"is_active"`
+	StartsAt    *time.Time            `json:"starts_at"`
+	EndsAt      *time.Time            `json:"ends_at"`
+}
+
+// apply validates the input and copies it to the collection
+func (input collectionInput) apply(db *gorm.DB, collection *models.Collection) error {
+	slug := input.Slug
+	if slug == "" {
+		slug = input.Name
+	}
+	if slug = generateSlug(slug); slug == "" {
+		return errors.New("slug must contain letters or digits")
+	}
+	if !models.ValidCollectionSlot(input.Slot) {
+		return fmt.Errorf("invalid slot %q, must be %s, %s or %s", input.Slot,
+			models.CollectionSlotHomepageHero, models.CollectionSlotDealsOfTheDay, models.CollectionSlotCategorySpotlight)
+	}
+	if input.Slot == models.CollectionSlotCategorySpotlight {
+		if input.CategoryID == nil {
+			return errors.New("a category spotlight needs a category_id")
+		}
+		var count int64
+		db.Model(&models.Category{}).Where("id = ?", *input.CategoryID).Count(&count)
+		if count == 0 {
+			return errors.New("category not found")
+		}
+	}
+	if input.StartsAt != nil && input.EndsAt != nil && !input.EndsAt.After(*input.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	if input.Mode == "" {
+		input.Mode = models.CollectionModeManual
+	}
+	if input.Mode == models.CollectionModeRule {
+		if _, err := productSortRegistry.Parse(input.Rule.Sort, ""); err != nil {
+			return err
+		}
+		if input.Rule.MinRating < 0 || input.Rule.MinRating > 5 {
+			return errors.New("min_rating must be between 0 and 5")
+		}
+	} else {
+		input.Rule = models.CollectionRule{}
+	}
+
+	collection.Slug = slug
+	collection.Name = strings.TrimSpace(input.Name)
+	collection.Description = input.Description
+	collection.Slot = input.Slot
+	collection.CategoryID = nil
+	if input.Slot == models.CollectionSlotCategorySpotlight {
+		collection.CategoryID = input.CategoryID
+	}
+	collection.Mode = input.Mode
+	collection.Rule = datatypes.NewJSONType(input.Rule)
+	collection.Position = input.Position
+	collection.IsActive = input.IsActive == nil || *input.IsActive
+	collection.StartsAt = input.StartsAt
+	collection.EndsAt = input.EndsAt
+	return nil
+}
+
+// saveCollection validates the input, checks the slug is free and saves the collection
+func saveCollection(c *gin.Context, db *gorm.DB, collection *models.Collection) bool {
+	var input collectionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if err := input.apply(db, collection); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	var count int64
+	db.Model(&models.Collection{}).Where("slug = ? AND id <> ?", collection.Slug, collection.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another collection has this slug"})
+		return false
+	}
+	if err := db.Omit("Translations").Save(collection).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save collection"})
+		return false
+	}
+	return true
+}
+
+// POST /admin/collections - Create a collection
+func CreateCollection(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var collection models.Collection
+		if !saveCollection(c, db, &collection) {
+			return
+		}
+		c.JSON(http.StatusCreated, collection)
+	}
+}
+
+// PUT /admin/collections/:id - Update a collection. Switching a collection to
+// a rule keeps its items, they are used again if it switches back.
+func UpdateCollection(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var collection models.Collection
+		if err := db.Preload("Translations").First(&collection, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Collection not found")})
+			return
+		}
+		if !saveCollection(c, db, &collection) {
+			return
+		}
+		c.JSON(http.StatusOK, collection)
+	}
+}
+
+// DELETE /admin/collections/:id - Delete a collection, its items and its translations
+func DeleteCollection(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var collection models.Collection
+		if err := db.First(&collection, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Collection not found")})
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("collection_id = ?", collection.ID).Delete(&models.CollectionItem{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("collection_id = ?", collection.ID).Delete(&models.CollectionTranslation{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&collection).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete collection"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Collection deleted"})
+	}
+}
+
+// PUT /admin/collections/:id/translations - Create or update the translation
+// of the name and description of a collection
+func UpsertCollectionTranslation(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var collection models.Collection
+		if err := db.First(&collection, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Collection not found")})
+			return
+		}
+
+		var input struct {
+			Language    string `json:"language" binding:"required"`
+			Name        string `json:"name" binding:"required,max=255"`
+			Description string `json:"description"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		input.Language = strings.ToLower(strings.TrimSpace(input.Language))
+		if !importLanguages[input.Language] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "language must be en, fr or es"})
+			return
+		}
+
+		translation := models.CollectionTranslation{
+			CollectionID: collection.ID,
+			Language:     input.Language,
+			Name:         input.Name,
+			Description:  input.Description,
+		}
+		if err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "collection_id"}, {Name: "language"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "description", "updated_at"}),
+		}).Create(&translation).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save translation"})
+			return
+		}
+
+		c.JSON(http.StatusOK, translation)
+	}
+}
+
+// GET /admin/collections/:id/items - The items of a manual collection in
+// their order, hidden products included
+func ListCollectionItems(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var items []models.CollectionItem
+		if err := db.Where("collection_id = ?", c.Param("id")).
+			Order("position ASC, id ASC").
+			Find(&items).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch collection items"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"items": items, "count": len(items)})
+	}
+}
+
+// POST /admin/collections/:id/items - Add products at the end of a manual
+// collection. Products already in it keep their place.
+func AddCollectionItems(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var collection models.Collection
+		if err := db.First(&collection, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Collection not found")})
+			return
+		}
+
+		var input struct {
+			ProductIDs []uint `json:"product_ids" binding:"required,min=1"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		productIDs := uniqueUints(input.ProductIDs)
+
+		var found int64
+		db.Model(&models.Product{}).Where("id IN ?", productIDs).Count(&found)
+		if int(found) != len(productIDs) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.T(c, "Product not found")})
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var last int
+			if err := tx.Model(&models.CollectionItem{}).
+				Where("collection_id = ?", collection.ID).
+				Select("COALESCE(MAX(position), 0)").
+				Scan(&last).Error; err != nil {
+				return err
+			}
+			items := make([]models.CollectionItem, len(productIDs))
+			for i, productID := range productIDs {
+				items[i] = models.CollectionItem{CollectionID: collection.ID, ProductID: productID, Position: last + i + 1}
+			}
+			return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&items).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add products to the collection"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Products added to the collection"})
+	}
+}
+
+// DELETE /admin/collections/:id/items/:productId - Remove a product from a manual collection
+func RemoveCollectionItem(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result := db.Where("collection_id = ? AND product_id = ?", c.Param("id"), c.Param("productId")).
+			Delete(&models.CollectionItem{})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove product from the collection"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Product removed from the collection"})
+	}
+}
+
+// PUT /admin/collections/:id/items/order - Save the order of the items after
+// a drag and drop
+func UpdateCollectionItemOrder(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionID := c.Param("id")
+
+		var updates []struct {
+			ProductID uint `json:"product_id" binding:"required"`
+			Position  int  `json:"position" binding:"required,min=1"`
+		}
+		if err := c.ShouldBindJSON(&updates); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var existingIDs []uint
+		if err := db.Model(&models.CollectionItem{}).
+			Where("collection_id = ?", collectionID).
+			Pluck("product_id", &existingIDs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify collection items"})
+			return
+		}
+		existing := make(map[uint]bool)
+		for _, id := range existingIDs {
+			existing[id] = true
+		}
+		for _, update := range updates {
+			if !existing[update.ProductID] {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("Product %d is not in this collection", update.ProductID),
+				})
+				return
+			}
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, update := range updates {
+				if err := tx.Model(&models.CollectionItem{}).
+					Where("collection_id = ? AND product_id = ?", collectionID, update.ProductID).
+					Update("position", update.Position).Error; err != nil {
+					return fmt.Errorf("failed to update position of product %d: %v", update.ProductID, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Order updated successfully"})
+	}
+}
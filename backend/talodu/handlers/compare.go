@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"talodu/i18n"
+	"talodu/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	minComparedProducts = 2
+	maxComparedProducts = 4
+)
+
+// comparisonRow is a line of the comparison table, with one value per
+// compared product in the order of the request. Different is set when the
+// products don't all have the same value, for the UI to highlight the row.
+type comparisonRow struct {
+	Key       string        `json:"key"`
+	Label     string        `json:"label"`
+	Group     string        `json:"group"` // product, attributes or abouts
+	Values    []interface{} `json:"values"`
+	Different bool          `json:"different"`
+}
+
+func newComparisonRow(key, label, group string, values []interface{}) comparisonRow {
+	row := comparisonRow{Key: key, Label: label, Group: group, Values: values}
+	for _, value := range values[1:] {
+		if fmt.Sprint(value) != fmt.Sprint(values[0]) {
+			row.Different = true
+			break
+		}
+	}
+	return row
+}
+
+// GET /products/compare?ids=1,2,3&currency=EUR - Compare 2 to 4 visible products
+// side by side: price, rating, stock, shop, attributes and "about" bullets
+func CompareProducts(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lang := i18n.Language(c)
+
+		var ids []uint
+		for _, part := range strings.Split(c.Query("ids"), ",") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			id, err := strconv.ParseUint(part, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid product id %q", part)})
+				return
+			}
+			duplicate := false
+			for _, existing := range ids {
+				duplicate = duplicate || existing == uint(id)
+			}
+			if !duplicate {
+				ids = append(ids, uint(id))
+			}
+		}
+		if len(ids) < minComparedProducts || len(ids) > maxComparedProducts {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ids must list %d to %d different products", minComparedProducts, maxComparedProducts)})
+			return
+		}
+
+		var found []models.Product
+		if err := db.Preload("Translations").
+			Preload("Images", preloadProductImages(true)).
+			Preload("Images.Translations").
+			Preload("Shop", func(db *gorm.DB) *gorm.DB {
+				return db.Select("id", "name")
+			}).
+			Where("is_visible = ?", true).
+			Find(&found, ids).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+			return
+		}
+
+		// Products in the order of the request
+		products := make([]models.Product, 0, len(ids))
+		var missing []uint
+		for _, id := range ids {
+			index := -1
+			for i := range found {
+				if found[i].ID == id {
+					index = i
+					break
+				}
+			}
+			if index < 0 {
+				missing = append(missing, id)
+				continue
+			}
+			products = append(products, found[index])
+		}
+		if len(missing) > 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found"), "missing_ids": missing})
+			return
+		}
+
+		localizeProducts(products, lang)
+		prices, ok := newPriceConverter(c, db)
+		if !ok || !prices.products(c, products) {
+			return
+		}
+		// Prices in different currencies are compared in the site currency
+		for i := range products[1:] {
+			if products[i+1].Currency != products[0].Currency {
+				prices.target = prices.site
+				if !prices.products(c, products) {
+					return
+				}
+				break
+			}
+		}
+
+		values := func(value func(p *models.Product) interface{}) []interface{} {
+			result := make([]interface{}, len(products))
+			for i := range products {
+				result[i] = value(&products[i])
+			}
+			return result
+		}
+		rows := []comparisonRow{
+			newComparisonRow("price", "Price", "product", values(func(p *models.Product) interface{} { return p.EffectivePrice })),
+			newComparisonRow("regular_price", "Regular price", "product", values(func(p *models.Product) interface{} { return p.Price })),
+			newComparisonRow("rating", "Rating", "product", values(func(p *models.Product) interface{} { return p.Rating })),
+			newComparisonRow("stock", "Stock", "product", values(func(p *models.Product) interface{} { return p.Stock })),
+			newComparisonRow("shop", "Shop", "product", values(func(p *models.Product) interface{} { return p.Shop.Name })),
+		}
+
+		// Attributes are matched by code, the same code in several categories is the same attribute
+		type attributeRow struct {
+			code     string
+			label    string
+			position int
+			values   []interface{}
+		}
+		var attributeRows []*attributeRow
+		byCode := make(map[string]*attributeRow)
+		for i := range products {
+			attributes, err := loadProductAttributes(db, products[i].ID, lang)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attributes"})
+				return
+			}
+			for _, attribute := range attributes {
+				row, ok := byCode[attribute.Attribute.Code]
+				if !ok {
+					row = &attributeRow{
+						code:     attribute.Attribute.Code,
+						label:    attribute.Attribute.Name,
+						position: attribute.Attribute.Position,
+						values:   make([]interface{}, len(products)),
+					}
+					byCode[row.code] = row
+					attributeRows = append(attributeRows, row)
+				}
+				row.values[i] = attribute.Label
+			}
+		}
+		sort.SliceStable(attributeRows, func(i, j int) bool {
+			return attributeRows[i].position < attributeRows[j].position
+		})
+		for _, row := range attributeRows {
+			rows = append(rows, newComparisonRow("attr:"+row.code, row.label, "attributes", row.values))
+		}
+
+		// "About this item" bullets
+		var abouts []models.ProductAbout
+		if err := db.Preload("Translations").Where("product_id IN ?", ids).Order("item_order").Find(&abouts).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch abouts"})
+			return
+		}
+		rows = append(rows, newComparisonRow("abouts", "About this item", "abouts", values(func(p *models.Product) interface{} {
+			bullets := []string{}
+			for _, about := range abouts {
+				if about.ProductID != p.ID {
+					continue
+				}
+				about.Localize(lang)
+				bullets = append(bullets, about.AboutText)
+			}
+			return bullets
+		})))
+
+		c.JSON(http.StatusOK, gin.H{"products": products, "rows": rows})
+	}
+}
@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"talodu/auth"
+	"talodu/currency"
+	"talodu/models"
+	"talodu/money"
+	"talodu/settings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Product prices are in the currency of their shop when they were created,
+// the site currency of the global settings when the shop has none. Product,
+// cart and order endpoints take ?currency= to convert them with the exchange
+// rate table, rounded to the minor unit of the currency.
+
+// siteCurrency returns the currency of the global settings
+func siteCurrency(db *gorm.DB) string {
+	var globalSettings settings.GlobalSettings
+	if err := db.Limit(1).Find(&globalSettings).Error; err == nil && currency.Valid(currency.Normalize(globalSettings.Currency)) {
+		return currency.Normalize(globalSettings.Currency)
+	}
+	return "USD"
+}
+
+// shopCurrency returns the currency of the prices of new products of a shop
+func shopCurrency(db *gorm.DB, shopID uint) string {
+	var shop models.Shop
+	if err := db.Select("id", "currency").First(&shop, shopID).Error; err == nil && currency.Valid(currency.Normalize(shop.Currency)) {
+		return currency.Normalize(shop.Currency)
+	}
+	return siteCurrency(db)
+}
+
+// priceConverter converts the prices of a request to the requested currency
+type priceConverter struct {
+	target string // Requested currency, "" to keep the currencies of the products
+	site   string
+	rates  models.ExchangeRates
+}
+
+// newPriceConverter reads ?currency=, it answers the request and returns
+// false when the currency is invalid
+func newPriceConverter(c *gin.Context, db *gorm.DB) (*priceConverter, bool) {
+	prices := &priceConverter{site: siteCurrency(db)}
+	if value := c.Query("currency"); value != "" {
+		prices.target = currency.Normalize(value)
+		if !currency.Valid(prices.target) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid currency %q", value)})
+			return nil, false
+		}
+	}
+	var err error
+	if prices.rates, err = models.LoadExchangeRates(db); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch exchange rates"})
+		return nil, false
+	}
+	return prices, true
+}
+
+// convert converts a price to another currency, rounded to its minor unit,
+// and returns the rate it used
+func (p *priceConverter) convert(price money.Money, to string) (converted money.Money, rate float64, err error) {
+	rate, ok := p.rates.Rate(price.Currency, to)
+	if !ok {
+		return money.Money{}, 0, fmt.Errorf("no exchange rate from %s to %s", price.Currency, to)
+	}
+	return price.Convert(rate, to), rate, nil
+}
+
+// products converts the prices of the products to the requested currency.
+// It answers the request and returns false on failure.
+func (p *priceConverter) products(c *gin.Context, products []models.Product) bool {
+	for i := range products {
+		product := &products[i]
+		if p.target == "" || p.target == product.Currency {
+			continue
+		}
+		var err error
+		if product.Price, _, err = p.convert(product.Price, p.target); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		product.EffectivePrice, _, _ = p.convert(product.EffectivePrice, p.target)
+		if product.SalePrice != nil {
+			salePrice, _, _ := p.convert(*product.SalePrice, p.target)
+			product.SalePrice = &salePrice
+		}
+		product.Currency = p.target
+	}
+	return true
+}
+
+// product converts the prices of one product, see products
+func (p *priceConverter) product(c *gin.Context, product *models.Product) bool {
+	products := []models.Product{*product}
+	if !p.products(c, products) {
+		return false
+	}
+	*product = products[0]
+	return true
+}
+
+// priceSQL is the effective price of the products in major units of the
+// requested currency, the site currency when none is requested, so products
+// of shops with different currencies can be filtered and sorted together.
+// It is NULL for products without a rate to that currency.
+func (p *priceConverter) priceSQL() (string, []interface{}) {
+	to := p.target
+	if to == "" {
+		to = p.site
+	}
+	codes := []string{to}
+	for code := range p.rates {
+		if code != to {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+
+	var b strings.Builder
+	var args []interface{}
+	b.WriteString("(" + models.EffectivePriceSQL + " * (CASE products.currency")
+	for _, code := range codes {
+		if rate, ok := p.rates.Rate(code, to); ok {
+			b.WriteString(" WHEN ? THEN CAST(? AS NUMERIC)")
+			args = append(args, code, rate)
+		}
+	}
+	b.WriteString(" END) / " + models.PriceScaleSQL + ")")
+	return b.String(), args
+}
+
+// priceFilter restricts a product query to the prices between ?min_price=
+// and ?max_price=, in the requested currency, sale prices included
+func (p *priceConverter) priceFilter(c *gin.Context, query *gorm.DB) *gorm.DB {
+	if minPrice := c.Query("min_price"); minPrice != "" {
+		price, args := p.priceSQL()
+		query = query.Where(price+" >= CAST(? AS NUMERIC)", append(args, minPrice)...)
+	}
+	if maxPrice := c.Query("max_price"); maxPrice != "" {
+		price, args := p.priceSQL()
+		query = query.Where(price+" <= CAST(? AS NUMERIC)", append(args, maxPrice)...)
+	}
+	return query
+}
+
+// sortKeys sorts by the converted prices instead of the prices in the
+// currency of each product. Converted prices are not stored on the row, they
+// can't be used in a cursor.
+func (p *priceConverter) sortKeys(keys []SortKey) []SortKey {
+	for i, key := range keys {
+		if key.Column == models.EffectivePriceSQL {
+			price, args := p.priceSQL()
+			keys[i] = SortKey{Column: price, Args: args, Desc: key.Desc}
+		}
+	}
+	return keys
+}
+
+// GET /currencies - The site currency and the currencies prices can be converted to
+func ListCurrencies(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		site := siteCurrency(db)
+		rates, err := models.LoadExchangeRates(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch exchange rates"})
+			return
+		}
+
+		codes := []string{site}
+		for code := range rates {
+			if _, ok := rates.Rate(site, code); ok && code != site {
+				codes = append(codes, code)
+			}
+		}
+		sort.Strings(codes[1:])
+
+		currencies := make([]gin.H, len(codes))
+		for i, code := range codes {
+			rate, _ := rates.Rate(site, code)
+			currencies[i] = gin.H{"code": code, "decimals": currency.Decimals(code), "rate": rate}
+		}
+		c.JSON(http.StatusOK, gin.H{"site_currency": site, "currencies": currencies})
+	}
+}
+
+// GET /admin/exchange-rates - The exchange rate table
+func ListExchangeRates(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rates []models.ExchangeRate
+		if err := db.Order("from_currency, to_currency").Find(&rates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch exchange rates"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"rates": rates})
+	}
+}
+
+// exchangeRateInput is a rate entered by an admin or read from an import file
+type exchangeRateInput struct {
+	From string  `json:"from" binding:"required"`
+	To   string  `json:"to" binding:"required"`
+	Rate float64 `json:"rate" binding:"required"`
+}
+
+// normalized validates the input and returns it as a rate record
+func (input exchangeRateInput) normalized() (models.ExchangeRate, error) {
+	rate := models.ExchangeRate{From: currency.Normalize(input.From), To: currency.Normalize(input.To), Rate: input.Rate}
+	switch {
+	case !currency.Valid(rate.From):
+		return rate, fmt.Errorf("invalid currency %q", input.From)
+	case !currency.Valid(rate.To):
+		return rate, fmt.Errorf("invalid currency %q", input.To)
+	case rate.From == rate.To:
+		return rate, fmt.Errorf("the currencies of a rate must differ")
+	case rate.Rate <= 0:
+		return rate, fmt.Errorf("the rate must be positive")
+	}
+	return rate, nil
+}
+
+// saveExchangeRates creates or updates the rates of their currency pairs
+func saveExchangeRates(db *gorm.DB, rates []models.ExchangeRate) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "from_currency"}, {Name: "to_currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_by_id", "updated_at"}),
+	}).Create(&rates).Error
+}
+
+// PUT /admin/exchange-rates - Create or update the rate of a currency pair
+func UpsertExchangeRate(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input exchangeRateInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rate, err := input.normalized()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if authUser, err := auth.GetAuthUser(c); err == nil {
+			rate.UpdatedByID = &authUser.ID
+		}
+
+		if err := saveExchangeRates(db, []models.ExchangeRate{rate}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save exchange rate"})
+			return
+		}
+		db.Where("from_currency = ? AND to_currency = ?", rate.From, rate.To).First(&rate)
+
+		c.JSON(http.StatusOK, rate)
+	}
+}
+
+// DELETE /admin/exchange-rates/:id
+func DeleteExchangeRate(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result := db.Delete(&models.ExchangeRate{}, c.Param("id"))
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete exchange rate"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exchange rate not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Exchange rate deleted"})
+	}
+}
+
+// POST /admin/exchange-rates/import - Create or update rates from a CSV or
+// XLSX file with from, to and rate columns. Nothing is saved unless every
+// row is valid.
+func ImportExchangeRates(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A CSV or XLSX file is required"})
+			return
+		}
+		if file.Size > maxImportFileSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("File exceeds the maximum size of %d MB", maxImportFileSize>>20)})
+			return
+		}
+		records, err := readImportFile(file)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(records) < 2 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the file has no rates"})
+			return
+		}
+
+		columns := map[string]int{}
+		for i, name := range records[0] {
+			columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+		}
+		for _, name := range []string{"from", "to", "rate"} {
+			if _, ok := columns[name]; !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "missing column: " + name})
+				return
+			}
+		}
+		cell := func(record []string, name string) string {
+			if i := columns[name]; i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		var updatedByID *uint
+		if authUser, err := auth.GetAuthUser(c); err == nil {
+			updatedByID = &authUser.ID
+		}
+		rowErrors := []models.ImportRowError{}
+		byPair := make(map[string]models.ExchangeRate)
+		for i, record := range records[1:] {
+			row := i + 2 // Rows are numbered from 1, after the header
+			if strings.TrimSpace(strings.Join(record, "")) == "" {
+				continue
+			}
+			value, err := strconv.ParseFloat(strings.ReplaceAll(cell(record, "rate"), ",", "."), 64)
+			if err != nil {
+				rowErrors = append(rowErrors, models.ImportRowError{Row: row, Field: "rate", Message: "invalid rate"})
+				continue
+			}
+			rate, err := exchangeRateInput{From: cell(record, "from"), To: cell(record, "to"), Rate: value}.normalized()
+			if err != nil {
+				rowErrors = append(rowErrors, models.ImportRowError{Row: row, Message: err.Error()})
+				continue
+			}
+			rate.UpdatedByID = updatedByID
+			byPair[rate.From+rate.To] = rate // The last row of a pair wins
+		}
+		if len(rowErrors) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The file has invalid rows", "errors": rowErrors})
+			return
+		}
+
+		rates := make([]models.ExchangeRate, 0, len(byPair))
+		for _, rate := range byPair {
+			rates = append(rates, rate)
+		}
+		sort.Slice(rates, func(i, j int) bool { return rates[i].From+rates[i].To < rates[j].From+rates[j].To })
+		if len(rates) > 0 {
+			if err := saveExchangeRates(db, rates); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save exchange rates"})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Exchange rates imported", "imported": len(rates)})
+	}
+}
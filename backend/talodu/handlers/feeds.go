@@ -0,0 +1,544 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"talodu/auth"
+	"talodu/i18n"
+	"talodu/models"
+	"talodu/settings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Product feeds are generated into files the first time they are requested
+// and served from there until a product, image, translation, category or
+// shop changes. Products are read in batches and written as they come, a
+// feed never holds the whole catalogue in memory.
+//
+// Changes are noticed from the database, by the latest updated_at and
+// deleted_at of the feed tables, so those of other instances and of raw
+// updates count too. Hard deletes and category assignments leave no date,
+// they show once the feed is older than FEEDS_CACHE_TTL (15 minutes by
+// default).
+
+const (
+	feedBatchSize        = 200
+	feedMaxTitleLength   = 150
+	feedMaxAdditionalImg = 10
+)
+
+// feedTables are the tables whose changes make the cached feeds stale
+var feedTables = map[string]bool{
+	"products":                   true,
+	"product_images":             true,
+	"product_translations":       true,
+	"product_image_translations": true,
+	"product_categories":         true,
+	"categories":                 true,
+	"shops":                      true,
+	"global_settings":            true,
+}
+
+// feedStampSQL is the date of the latest change of the feed tables
+const feedStampSQL = `SELECT MAX(at) FROM (
+	SELECT MAX(updated_at) AS at FROM products UNION ALL SELECT MAX(deleted_at) FROM products
+	UNION ALL SELECT MAX(updated_at) FROM product_images UNION ALL SELECT MAX(deleted_at) FROM product_images
+	UNION ALL SELECT MAX(updated_at) FROM product_translations UNION ALL SELECT MAX(deleted_at) FROM product_translations
+	UNION ALL SELECT MAX(updated_at) FROM product_image_translations
+	UNION ALL SELECT MAX(updated_at) FROM categories UNION ALL SELECT MAX(deleted_at) FROM categories
+	UNION ALL SELECT MAX(updated_at) FROM shops UNION ALL SELECT MAX(deleted_at) FROM shops
+	UNION ALL SELECT MAX(updated_at) FROM global_settings UNION ALL SELECT MAX(deleted_at) FROM global_settings
+) AS changes`
+
+// defaultFeedCacheTTL is how long a feed is served at most, see FEEDS_CACHE_TTL
+const defaultFeedCacheTTL = 15 * time.Minute
+
+type feedCache struct {
+	mu      sync.Mutex
+	dir     string
+	ttl     time.Duration
+	version atomic.Uint64
+	entries map[string]feedEntry
+}
+
+type feedEntry struct {
+	path        string
+	version     uint64
+	stamp       time.Time // Latest change of the feed tables when generated
+	generatedAt time.Time
+}
+
+var feeds = &feedCache{ttl: defaultFeedCacheTTL, entries: make(map[string]feedEntry)}
+
+// RegisterFeedInvalidation makes the changes written through db invalidate
+// the cached feeds at once, without waiting for the next check of the
+// database. The directory holding them is FEEDS_CACHE_DIR, or one in the
+// system temporary directory.
+func RegisterFeedInvalidation(db *gorm.DB) {
+	feeds.dir = os.Getenv("FEEDS_CACHE_DIR")
+	if feeds.dir == "" {
+		feeds.dir = filepath.Join(os.TempDir(), "talodu-feeds")
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("FEEDS_CACHE_TTL")); err == nil && ttl > 0 {
+		feeds.ttl = ttl
+	}
+
+	invalidate := func(tx *gorm.DB) {
+		if tx.Error == nil && tx.Statement.RowsAffected != 0 && feedTables[tx.Statement.Table] {
+			InvalidateFeeds()
+		}
+	}
+	callbacks := db.Callback()
+	callbacks.Create().After("gorm:create").Register("feeds:invalidate", invalidate)
+	callbacks.Update().After("gorm:update").Register("feeds:invalidate", invalidate)
+	callbacks.Delete().After("gorm:delete").Register("feeds:invalidate", invalidate)
+}
+
+// InvalidateFeeds makes the next request of every feed generate it again
+func InvalidateFeeds() {
+	feeds.version.Add(1)
+}
+
+// serve sends the cached feed name, generating it first when it is stale
+func (f *feedCache) serve(c *gin.Context, db *gorm.DB, name, contentType string, generate func(w io.Writer) error) {
+	var stamp sql.NullTime
+	if err := db.Raw(feedStampSQL).Row().Scan(&stamp); err != nil {
+		log.Printf("Failed to check the changes of feed %s: %v", name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate feed"})
+		return
+	}
+
+	f.mu.Lock()
+	entry, ok := f.entries[name]
+	version := f.version.Load()
+	if !ok || entry.version != version || !entry.stamp.Equal(stamp.Time) || time.Since(entry.generatedAt) > f.ttl {
+		// Changes made while generating bump the version or the stamp, the next request regenerates
+		generatedAt := time.Now()
+		path, err := f.generate(name, generate)
+		if err != nil {
+			f.mu.Unlock()
+			log.Printf("Failed to generate feed %s: %v", name, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate feed"})
+			return
+		}
+		entry = feedEntry{path: path, version: version, stamp: stamp.Time, generatedAt: generatedAt}
+		f.entries[name] = entry
+	}
+	f.mu.Unlock()
+
+	c.Header("Content-Type", contentType)
+	c.Header("Cache-Control", "public, max-age=900")
+	c.File(entry.path)
+}
+
+// generate writes a feed to a temporary file and moves it in place, requests
+// being served keep reading the previous file
+func (f *feedCache) generate(name string, generate func(w io.Writer) error) (string, error) {
+	if err := os.MkdirAll(f.dir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(f.dir, name+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := generate(tmp); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(f.dir, name)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// feedProduct is a product as published in the feeds, translated and with absolute URLs
+type feedProduct struct {
+	ID           string
+	GTIN         string
+	Title        string
+	Description  string
+	Link         string
+	ImageLink    string
+	ExtraImages  []string
+	Availability bool
+	Price        string
+	SalePrice    string
+	SaleDates    string // ISO 8601 interval of the sale, empty when it has no end
+	Brand        string
+	ProductType  string
+}
+
+// streamFeedProducts calls fn with each visible product, reading them in batches
+func streamFeedProducts(db *gorm.DB, baseURL, lang string, fn func(p feedProduct) error) error {
+	var products []models.Product
+	var fnErr error
+	result := db.
+		Preload("Images", preloadProductImages(true)).
+		Preload("Translations", "draft = ?", false). // Machine translations are sent once reviewed
+		Preload("Categories").
+		Preload("Shop").
+		Where("is_visible = ?", true).
+		FindInBatches(&products, feedBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, product := range products {
+				if fnErr = fn(newFeedProduct(product, baseURL, lang)); fnErr != nil {
+					return fnErr
+				}
+			}
+			return nil
+		})
+	if fnErr != nil {
+		return fnErr
+	}
+	return result.Error
+}
+
+// feedSiteName returns the site name of the global settings
+func feedSiteName(db *gorm.DB) string {
+	var globalSettings settings.GlobalSettings
+	if err := db.Limit(1).Find(&globalSettings).Error; err == nil && globalSettings.SiteName != "" {
+		return globalSettings.SiteName
+	}
+	return "Talodu"
+}
+
+// newFeedProduct formats a product for the feeds, the prices are in the
+// product currency
+func newFeedProduct(product models.Product, baseURL, lang string) feedProduct {
+	item := feedProduct{
+		ID:           product.SKU,
+		GTIN:         product.GTIN,
+		Title:        product.Name,
+		Description:  product.Description,
+		Link:         baseURL + "/products/ps/" + product.Slug,
+		Availability: product.Stock > 0,
+		Price:        product.Price.String(),
+		Brand:        product.Shop.Name,
+	}
+	// Feeds are cached, scheduled sales are sent with their dates so they apply on time
+	if product.SalePrice != nil && (product.SaleEndsAt == nil || product.SaleEndsAt.After(time.Now())) {
+		item.SalePrice = product.SalePrice.String()
+		if product.SaleEndsAt != nil {
+			start := product.CreatedAt
+			if product.SaleStartsAt != nil {
+				start = *product.SaleStartsAt
+			}
+			item.SaleDates = start.Format(time.RFC3339) + "/" + product.SaleEndsAt.Format(time.RFC3339)
+		} else if product.SaleStartsAt != nil && product.SaleStartsAt.After(time.Now()) {
+			// Feeds need an end date to delay a sale, give it a far one
+			item.SaleDates = product.SaleStartsAt.Format(time.RFC3339) + "/" + product.SaleStartsAt.AddDate(10, 0, 0).Format(time.RFC3339)
+		}
+	}
+	if item.ID == "" {
+		item.ID = strconv.FormatUint(uint64(product.ID), 10)
+	}
+	i := i18n.Pick(lang, len(product.Translations), func(i int) string {
+		if product.Translations[i].Name == "" {
+			return ""
+		}
+		return product.Translations[i].Language
+	})
+	if i >= 0 {
+		item.Title = product.Translations[i].Name
+		if product.Translations[i].Description != "" {
+			item.Description = product.Translations[i].Description
+		}
+	}
+	if runes := []rune(item.Title); len(runes) > feedMaxTitleLength {
+		item.Title = string(runes[:feedMaxTitleLength])
+	}
+	if item.Description == "" {
+		item.Description = item.Title
+	}
+
+	var categories []string
+	for _, category := range product.Categories {
+		categories = append(categories, category.Name)
+	}
+	item.ProductType = strings.Join(categories, " > ")
+
+	// The primary image leads, the others follow in gallery order
+	for _, image := range product.Images {
+		link := absoluteURL(baseURL, image.URL)
+		if link == "" {
+			continue
+		}
+		if image.IsPrimary && item.ImageLink == "" {
+			item.ImageLink = link
+		} else {
+			item.ExtraImages = append(item.ExtraImages, link)
+		}
+	}
+	if item.ImageLink == "" && len(item.ExtraImages) > 0 {
+		item.ImageLink, item.ExtraImages = item.ExtraImages[0], item.ExtraImages[1:]
+	}
+	if len(item.ExtraImages) > feedMaxAdditionalImg {
+		item.ExtraImages = item.ExtraImages[:feedMaxAdditionalImg]
+	}
+	return item
+}
+
+// feedBaseURL is the site URL the feed links point to, HOST_URL. Feeds are
+// cached for every client, their links can't come from the Host header of
+// the request that generated them: it answers the request and returns false
+// when HOST_URL is not set.
+func feedBaseURL(c *gin.Context) (string, bool) {
+	hostURL := os.Getenv("HOST_URL")
+	if hostURL == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Product feeds are not configured, HOST_URL is not set"})
+		return "", false
+	}
+	return strings.TrimRight(hostURL, "/"), true
+}
+
+// requestBaseURL is the site URL the links of a response point to: HOST_URL,
+// or the host of the request
+func requestBaseURL(c *gin.Context) string {
+	if hostURL := os.Getenv("HOST_URL"); hostURL != "" {
+		return strings.TrimRight(hostURL, "/")
+	}
+	scheme := "https"
+	if c.Request.TLS == nil && c.GetHeader("X-Forwarded-Proto") != "https" {
+		scheme = "http"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// absoluteURL prefixes the URLs served by the API itself with its base URL
+func absoluteURL(baseURL, link string) string {
+	if strings.HasPrefix(link, "/") {
+		return baseURL + link
+	}
+	return link
+}
+
+// feedLanguage returns the ?lang= parameter, ok is false for an unsupported
+// language. Feeds are cached per language, they don't negotiate it.
+func feedLanguage(c *gin.Context) (lang string, ok bool) {
+	lang = i18n.Normalize(c.Query("lang"))
+	return lang, lang == "" || i18n.IsSupported(lang)
+}
+
+type googleFeedItem struct {
+	XMLName          xml.Name `xml:"item"`
+	ID               string   `xml:"g:id"`
+	Title            string   `xml:"g:title"`
+	Description      string   `xml:"g:description"`
+	Link             string   `xml:"g:link"`
+	ImageLink        string   `xml:"g:image_link,omitempty"`
+	AdditionalImages []string `xml:"g:additional_image_link"`
+	Availability     string   `xml:"g:availability"`
+	Price            string   `xml:"g:price"`
+	SalePrice        string   `xml:"g:sale_price,omitempty"`
+	SaleDates        string   `xml:"g:sale_price_effective_date,omitempty"`
+	Brand            string   `xml:"g:brand,omitempty"`
+	GTIN             string   `xml:"g:gtin,omitempty"`
+	Condition        string   `xml:"g:condition"`
+	ProductType      string   `xml:"g:product_type,omitempty"`
+	IdentifierExists string   `xml:"g:identifier_exists"`
+}
+
+// GET /feeds/google.xml?lang=fr - Google Merchant Center product feed
+func GetGoogleProductFeed(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lang, ok := feedLanguage(c)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.T(c, "Unsupported language")})
+			return
+		}
+		baseURL, ok := feedBaseURL(c)
+		if !ok {
+			return
+		}
+
+		feeds.serve(c, db, "google-"+lang+".xml", "application/xml; charset=utf-8", func(w io.Writer) error {
+			if _, err := io.WriteString(w, xml.Header+`<rss version="2.0" xmlns:g="http://base.google.com/ns/1.0"><channel>`); err != nil {
+				return err
+			}
+			siteName := feedSiteName(db)
+			encoder := xml.NewEncoder(w)
+			for _, element := range [][2]string{{"title", siteName}, {"link", baseURL}, {"description", siteName + " products"}} {
+				if err := encoder.EncodeElement(element[1], xml.StartElement{Name: xml.Name{Local: element[0]}}); err != nil {
+					return err
+				}
+			}
+
+			err := streamFeedProducts(db, baseURL, lang, func(p feedProduct) error {
+				availability := "out_of_stock"
+				if p.Availability {
+					availability = "in_stock"
+				}
+				identifierExists := "no"
+				if p.GTIN != "" {
+					identifierExists = "yes"
+				}
+				return encoder.Encode(googleFeedItem{
+					ID:               p.ID,
+					Title:            p.Title,
+					Description:      p.Description,
+					Link:             p.Link,
+					ImageLink:        p.ImageLink,
+					AdditionalImages: p.ExtraImages,
+					Availability:     availability,
+					Price:            p.Price,
+					SalePrice:        p.SalePrice,
+					SaleDates:        p.SaleDates,
+					Brand:            p.Brand,
+					GTIN:             p.GTIN,
+					Condition:        "new",
+					ProductType:      p.ProductType,
+					IdentifierExists: identifierExists,
+				})
+			})
+			if err != nil {
+				return err
+			}
+			if err := encoder.Flush(); err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, "</channel></rss>\n")
+			return err
+		})
+	}
+}
+
+// GET /feeds/facebook.csv?lang=fr - Facebook (Meta) catalogue data feed
+func GetFacebookProductFeed(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lang, ok := feedLanguage(c)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.T(c, "Unsupported language")})
+			return
+		}
+		baseURL, ok := feedBaseURL(c)
+		if !ok {
+			return
+		}
+
+		feeds.serve(c, db, "facebook-"+lang+".csv", "text/csv; charset=utf-8", func(w io.Writer) error {
+			writer := csv.NewWriter(w)
+			writer.Write([]string{"id", "title", "description", "availability", "condition", "price", "sale_price", "sale_price_effective_date", "link", "image_link", "additional_image_link", "brand", "gtin", "product_type"})
+
+			err := streamFeedProducts(db, baseURL, lang, func(p feedProduct) error {
+				availability := "out of stock"
+				if p.Availability {
+					availability = "in stock"
+				}
+				return writer.Write([]string{
+					p.ID, p.Title, p.Description, availability, "new", p.Price, p.SalePrice, p.SaleDates, p.Link,
+					p.ImageLink, strings.Join(p.ExtraImages, ","), p.Brand, p.GTIN, p.ProductType,
+				})
+			})
+			if err != nil {
+				return err
+			}
+			writer.Flush()
+			return writer.Error()
+		})
+	}
+}
+
+// GET /shops/:id/products/export - All the products of a shop, hidden ones
+// included, in the CSV format read by ImportShopProducts
+func ExportShopProducts(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authUser, err := auth.GetAuthUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
+			return
+		}
+
+		var shop models.Shop
+		if err := db.Preload("Employees").First(&shop, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Shop not found")})
+			return
+		}
+		if !canManageShopProducts(authUser, shop) {
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.T(c, "Operation not permitted")})
+			return
+		}
+
+		languages := []string{"en", "fr", "es"}
+		header := []string{"sku", "gtin", "name", "price", "description", "stock", "categories", "images"}
+		for _, lang := range languages {
+			header = append(header, "name_"+lang, "description_"+lang)
+		}
+		baseURL := requestBaseURL(c)
+
+		// The export is written as it is read, errors after the first batch can only cut it short
+		filename := fmt.Sprintf("%s-products-%s.csv", generateSlug(shop.Name), time.Now().Format("20060102"))
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Status(http.StatusOK)
+
+		writer := csv.NewWriter(c.Writer)
+		writer.Write(header)
+
+		var products []models.Product
+		result := db.
+			Preload("Images", preloadProductImages(false)).
+			// Drafts are left out, importing the file back then keeps them as they are
+			Preload("Translations", "draft = ?", false).
+			Preload("Categories").
+			Where("shop_id = ?", shop.ID).
+			FindInBatches(&products, feedBatchSize, func(tx *gorm.DB, batch int) error {
+				for _, product := range products {
+					var categories, images []string
+					for _, category := range product.Categories {
+						categories = append(categories, category.Name)
+					}
+					for _, image := range product.Images {
+						images = append(images, absoluteURL(baseURL, image.URL))
+					}
+
+					record := []string{
+						product.SKU,
+						product.GTIN,
+						product.Name,
+						product.Price.Decimal(),
+						product.Description,
+						strconv.Itoa(product.Stock),
+						strings.Join(categories, importListSep),
+						strings.Join(images, importListSep),
+					}
+					for _, lang := range languages {
+						var name, description string
+						for _, t := range product.Translations {
+							if t.Language == lang {
+								name, description = t.Name, t.Description
+								break
+							}
+						}
+						record = append(record, name, description)
+					}
+					writer.Write(record)
+				}
+				writer.Flush()
+				return writer.Error()
+			})
+		if result.Error != nil {
+			log.Printf("Failed to export the products of shop %d: %v", shop.ID, result.Error)
+		}
+		writer.Flush()
+	}
+}
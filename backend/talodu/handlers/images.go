@@ -1,16 +1,112 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
-	"os"
 	"strings"
+	"talodu/auth"
+	"talodu/i18n"
+	"talodu/imageproc"
 	"talodu/models"
+	"talodu/storage"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// productImagesOrder is the gallery order: the primary image first, see
+// SetPrimaryImage, then the order set with UpdateProductImageOrder
+const productImagesOrder = "is_primary DESC, position ASC, created_at ASC"
+
+// preloadProductImages orders the preloaded images of products, visibleOnly
+// hides the images turned off by the shop
+func preloadProductImages(visibleOnly bool) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if visibleOnly {
+			db = db.Where("is_visible = ?", true)
+		}
+		return db.Order(productImagesOrder)
+	}
+}
+
+// productImageAttributes are the form fields sent with an uploaded image
+type productImageAttributes struct {
+	AltText   string
+	Variant   string
+	Color     string
+	SourceURL string // set when the image was downloaded by an import
+}
+
+// saveProductImage validates an uploaded file, stores its renditions under
+// products/<productID> and creates the image record at the end of the gallery.
+func saveProductImage(ctx context.Context, db *gorm.DB, productID string, file *multipart.FileHeader, attributes productImageAttributes) (models.ProductImage, error) {
+	if file.Size > imageproc.MaxUploadSize {
+		return models.ProductImage{}, &imageproc.ValidationError{Message: fmt.Sprintf("image exceeds the maximum size of %d MB", imageproc.MaxUploadSize>>20)}
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return models.ProductImage{}, fmt.Errorf("failed to read file")
+	}
+	defer src.Close()
+
+	return storeProductImage(ctx, db, parseUint(productID), src, attributes)
+}
+
+// storeProductImage processes an image read from r and adds it to the gallery of the product
+func storeProductImage(ctx context.Context, db *gorm.DB, productID uint, r io.Reader, attributes productImageAttributes) (models.ProductImage, error) {
+	result, err := imageproc.Process(r)
+	if err != nil {
+		return models.ProductImage{}, err
+	}
+
+	keys, err := result.Store(ctx, storage.Default, fmt.Sprintf("products/%d", productID), uuid.New().String())
+	if err != nil {
+		return models.ProductImage{}, fmt.Errorf("failed to save file")
+	}
+
+	image := models.ProductImage{
+		ProductID:    productID,
+		Key:          keys[imageproc.Original],
+		ThumbnailKey: keys[imageproc.Thumbnail],
+		MediumKey:    keys[imageproc.Medium],
+		LargeKey:     keys[imageproc.Large],
+		WebPKey:      keys[imageproc.WebP],
+		Width:        result.Width,
+		Height:       result.Height,
+		MimeType:     result.MimeType,
+		AltText:      attributes.AltText,
+		Variant:      attributes.Variant,
+		Color:        attributes.Color,
+		SourceURL:    attributes.SourceURL,
+	}
+
+	// Append to the end of the gallery, uploads of the product wait for each
+	// other on the lock of its row so they don't take the same position
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Product{}, image.ProductID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ProductImage{}).
+			Where("product_id = ?", image.ProductID).
+			Select("COALESCE(MAX(position), 0) + 1").
+			Scan(&image.Position).Error; err != nil {
+			return err
+		}
+		return tx.Create(&image).Error
+	})
+	if err != nil {
+		storage.DeleteKeys(ctx, image.ObjectKeys())
+		return models.ProductImage{}, fmt.Errorf("failed to save image record")
+	}
+	return image, nil
+}
+
 // PUT /images/product/:imageId/primary - Set an image as primary
 
 func SetPrimaryImage(db *gorm.DB) gin.HandlerFunc {
@@ -58,7 +154,7 @@ func ToggleImageVisibility(db *gorm.DB) gin.HandlerFunc {
 
 		var image models.ProductImage
 		if err := db.First(&image, imageID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Image not found")})
 			return
 		}
 
@@ -85,24 +181,195 @@ func DeleteProductImage(db *gorm.DB) gin.HandlerFunc {
 
 		var image models.ProductImage
 		if err := db.First(&image, imageID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Image not found")})
 			return
 		}
 
-		// Delete the file from disk
-		filePath := strings.TrimPrefix(image.URL, "/")
-		if err := os.Remove(filePath); err != nil {
-			fmt.Printf("Failed to delete file %s: %v\n", filePath, err)
-		}
-
-		// Delete from database
-		if err := db.Delete(&image).Error; err != nil {
+		// The file and its renditions are removed once the record is gone,
+		// those a failure leaves behind are collected by the uploads garbage collection
+		if err := db.Unscoped().Delete(&image).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete image"})
 			return
 		}
+		storage.DeleteKeys(c.Request.Context(), image.ObjectKeys())
 
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Image deleted successfully",
 		})
 	}
 }
+
+// loadManagedImage loads the image of the :imageId parameter for a user who
+// manages the shop of its product. It answers the request and returns false
+// otherwise.
+func loadManagedImage(c *gin.Context, db *gorm.DB) (*models.ProductImage, bool) {
+	authUser, err := auth.GetAuthUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
+		return nil, false
+	}
+
+	var image models.ProductImage
+	if err := db.First(&image, c.Param("imageId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Image not found")})
+		return nil, false
+	}
+	var product models.Product
+	if err := db.Preload("Shop.Employees").First(&product, image.ProductID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
+		return nil, false
+	}
+	if !canManageShopProducts(authUser, product.Shop) {
+		c.JSON(http.StatusForbidden, gin.H{"error": i18n.T(c, "Operation not permitted")})
+		return nil, false
+	}
+	return &image, true
+}
+
+// PUT /products/images/order/:id - Reorder the gallery of a product
+func UpdateProductImageOrder(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var updates []struct {
+			ID       uint `json:"id" binding:"required"`
+			Position int  `json:"position" binding:"required,min=1"`
+		}
+
+		if err := c.ShouldBindJSON(&updates); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		product, _, ok := loadManagedProduct(c, db)
+		if !ok {
+			return
+		}
+
+		// Verify all images belong to this product
+		var existingIDs []uint
+		if err := db.Model(&models.ProductImage{}).
+			Where("product_id = ?", product.ID).
+			Pluck("id", &existingIDs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify images"})
+			return
+		}
+
+		existingIDMap := make(map[uint]bool)
+		for _, id := range existingIDs {
+			existingIDMap[id] = true
+		}
+
+		for _, update := range updates {
+			if !existingIDMap[update.ID] {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("Image %d does not belong to this product", update.ID),
+				})
+				return
+			}
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, update := range updates {
+				if err := tx.Model(&models.ProductImage{}).
+					Where("id = ?", update.ID).
+					Update("position", update.Position).Error; err != nil {
+					return fmt.Errorf("failed to update position of image %d: %v", update.ID, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Order updated successfully"})
+	}
+}
+
+// PUT /products/images/:imageId/variant - Attach an image to a variant and/or colour
+func SetImageVariant(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Empty values attach the image to all the variants or colours again
+		var input struct {
+			Variant string `json:"variant" binding:"max=100"`
+			Color   string `json:"color" binding:"max=50"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		image, ok := loadManagedImage(c, db)
+		if !ok {
+			return
+		}
+
+		if err := db.Model(image).Updates(map[string]interface{}{
+			"variant": strings.TrimSpace(input.Variant),
+			"color":   strings.TrimSpace(input.Color),
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update image"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Image variant updated",
+			"image":   image,
+		})
+	}
+}
+
+// GET /products/images/:imageId/translations - Alt text translations of an image
+func GetProductImageTranslations(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		imageID := c.Param("imageId")
+
+		var translations []models.ProductImageTranslation
+		if err := db.Where("product_image_id = ?", imageID).Order("language").Find(&translations).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch translations"})
+			return
+		}
+
+		c.JSON(http.StatusOK, translations)
+	}
+}
+
+// PUT /products/images/:imageId/translations - Create or update the alt text of an image in one language
+func UpsertProductImageTranslation(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Language string `json:"language" binding:"required,oneof=en fr es"`
+			AltText  string `json:"alt_text" binding:"required,max=255"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		image, ok := loadManagedImage(c, db)
+		if !ok {
+			return
+		}
+
+		translation := models.ProductImageTranslation{
+			ProductImageID: image.ID,
+			Language:       input.Language,
+			AltText:        input.AltText,
+		}
+		if err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "product_image_id"}, {Name: "language"}},
+			DoUpdates: clause.AssignmentColumns([]string{"alt_text", "updated_at"}),
+		}).Create(&translation).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save translation"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":     "Translation saved",
+			"translation": translation,
+		})
+	}
+}
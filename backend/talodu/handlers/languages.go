@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"talodu/auth"
+	"talodu/i18n"
+	"talodu/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UserLanguage returns the preferred language of the user signed in on the
+// request, "" for anonymous requests. It's the i18n.UserLanguage hook.
+func UserLanguage(db *gorm.DB) func(c *gin.Context) string {
+	return func(c *gin.Context) string {
+		if c.GetHeader("Authorization") == "" {
+			return ""
+		}
+		authUser, err := auth.GetAuthUser(c)
+		if err != nil {
+			return ""
+		}
+		var languages []string
+		db.Model(&models.User{}).Where("id = ?", authUser.ID).Limit(1).Pluck("preferred_language", &languages)
+		if len(languages) == 0 {
+			return ""
+		}
+		return languages[0]
+	}
+}
+
+// GET /languages - Languages the API answers in, and the language of this request
+func GetLanguages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"languages": i18n.Supported,
+			"default":   i18n.DefaultLanguage,
+			"content":   i18n.ContentLanguage,
+			"current":   i18n.Language(c),
+		})
+	}
+}
+
+// PUT /me/language - Set the preferred language of the current user, used
+// when a request doesn't ask for one and for their notifications. An empty
+// language clears the preference.
+func UpdateMyLanguage(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Language string `json:"language"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		authUser, err := auth.GetAuthUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
+			return
+		}
+
+		language := i18n.Normalize(input.Language)
+		if language != "" && !i18n.IsSupported(language) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.T(c, "Unsupported language"), "languages": i18n.Supported})
+			return
+		}
+		if err := db.Model(&models.User{}).Where("id = ?", authUser.ID).Update("preferred_language", language).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update the language"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"preferred_language": language})
+	}
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"talodu/auth"
+	"talodu/i18n"
+	"talodu/models"
+	"talodu/settings"
+	"talodu/utils/mail"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// notifyUsers records the notification for each user and emails it to them
+// in the background when email notifications are enabled. build returns the
+// notification in a language, each user gets it in their preferred language.
+// Failures are logged, a notification never fails the request that triggered it.
+func notifyUsers(db *gorm.DB, userIDs []uint, build func(lang string) models.Notification) {
+	seen := make(map[uint]bool)
+	var recipientIDs []uint
+	for _, id := range userIDs {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			recipientIDs = append(recipientIDs, id)
+		}
+	}
+	if len(recipientIDs) == 0 {
+		return
+	}
+
+	var recipients []models.User
+	if err := db.Select("id", "email", "preferred_language").Where("id IN ?", recipientIDs).Find(&recipients).Error; err != nil {
+		log.Printf("Failed to load the recipients of notifications: %v", err)
+		return
+	}
+
+	// One notification per language
+	byLanguage := make(map[string]models.Notification)
+	notifications := make([]models.Notification, len(recipients))
+	for i, recipient := range recipients {
+		lang := i18n.DefaultLanguage
+		if i18n.IsSupported(recipient.PreferredLanguage) {
+			lang = recipient.PreferredLanguage
+		}
+		notification, ok := byLanguage[lang]
+		if !ok {
+			notification = build(lang)
+			byLanguage[lang] = notification
+		}
+		notifications[i] = notification
+		notifications[i].UserID = recipient.ID
+	}
+	if len(notifications) == 0 {
+		return
+	}
+	if err := db.Create(&notifications).Error; err != nil {
+		log.Printf("Failed to save %s notifications: %v", notifications[0].Type, err)
+		return
+	}
+
+	var globalSettings settings.GlobalSettings
+	if err := db.Limit(1).Find(&globalSettings).Error; err != nil || (globalSettings.ID != 0 && !globalSettings.EmailNotifications) {
+		return
+	}
+
+	go func() {
+		for i, recipient := range recipients {
+			if recipient.Email == "" {
+				continue
+			}
+			notification := notifications[i]
+			body := fmt.Sprintf("<html>\n<body>\n    <h2>%s</h2>\n    <p>%s</p>\n</body>\n</html>",
+				html.EscapeString(notification.Title), html.EscapeString(notification.Message))
+			if err := mail.Send(recipient.Email, notification.Title, body); err != nil {
+				log.Printf("Failed to email %s notification to %s: %v", notification.Type, recipient.Email, err)
+			}
+		}
+	}()
+}
+
+// shopManagerIDs returns the owner and employees of a shop, shop.Employees must be preloaded
+func shopManagerIDs(shop models.Shop) []uint {
+	ids := []uint{shop.OwnerID}
+	for _, employee := range shop.Employees {
+		ids = append(ids, employee.ID)
+	}
+	return ids
+}
+
+// GET /me/notifications?unread=true - Notifications of the current user, newest first
+func ListNotifications(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authUser, err := auth.GetAuthUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
+			return
+		}
+
+		query := db.Model(&models.Notification{}).Where("user_id = ?", authUser.ID)
+		if c.Query("unread") == "true" {
+			query = query.Where("read_at IS NULL")
+		}
+
+		pagination, err := parsePagination(c, 20)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var totalCount int64
+		query.Count(&totalCount)
+
+		var unreadCount int64
+		db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", authUser.ID).Count(&unreadCount)
+
+		keys, err := notificationSortRegistry.Parse(c.Query("sort"), "")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query, err = pagination.Apply(query, keys)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var notifications []models.Notification
+		if err := query.Find(&notifications).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+			return
+		}
+		nextCursor, hasMore := pagination.Finish(&notifications, keys)
+
+		response := gin.H{"notifications": notifications, "unread_count": unreadCount}
+		for key, value := range pagination.Meta(totalCount, nextCursor, hasMore) {
+			response[key] = value
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// PUT /me/notifications/:id/read - Mark a notification as read
+func MarkNotificationRead(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authUser, err := auth.GetAuthUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
+			return
+		}
+
+		var notification models.Notification
+		if err := db.Where("user_id = ?", authUser.ID).First(&notification, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+			return
+		}
+		if notification.ReadAt == nil {
+			now := time.Now()
+			if err := db.Model(&notification).Update("read_at", now).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+				return
+			}
+			notification.ReadAt = &now
+		}
+
+		c.JSON(http.StatusOK, notification)
+	}
+}
+
+// PUT /me/notifications/read - Mark all the notifications of the current user as read
+func MarkAllNotificationsRead(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authUser, err := auth.GetAuthUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
+			return
+		}
+
+		result := db.Model(&models.Notification{}).
+			Where("user_id = ? AND read_at IS NULL", authUser.ID).
+			Update("read_at", time.Now())
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Notifications marked as read", "updated": result.RowsAffected})
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
 	"talodu/auth"
+	"talodu/currency"
+	"talodu/i18n"
 	"talodu/models"
+	"talodu/money"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -38,7 +40,7 @@ func CreateOrderFromCart(db *gorm.DB) gin.HandlerFunc {
 		// Get authenticated user
 		authUser, err := auth.GetAuthUser(c)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Authentication required")})
 			return
 		}
 
@@ -51,6 +53,7 @@ func CreateOrderFromCart(db *gorm.DB) gin.HandlerFunc {
 		var request struct {
 			Shipping      ShippingInfo `json:"shipping" binding:"required"`
 			PaymentMethod string       `json:"payment_method" binding:"required"`
+			Currency      string       `json:"currency"` // Or ?currency=, the site currency by default
 		}
 
 		if err := c.ShouldBindJSON(&request); err != nil {
@@ -58,6 +61,22 @@ func CreateOrderFromCart(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// The order is placed in one currency, items of shops in other currencies are converted
+		prices, ok := newPriceConverter(c, db)
+		if !ok {
+			return
+		}
+		if request.Currency != "" {
+			prices.target = currency.Normalize(request.Currency)
+			if !currency.Valid(prices.target) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid currency %q", request.Currency)})
+				return
+			}
+		}
+		if prices.target == "" {
+			prices.target = prices.site
+		}
+
 		// Begin transaction
 		tx := db.Begin()
 		defer func() {
@@ -68,9 +87,8 @@ func CreateOrderFromCart(db *gorm.DB) gin.HandlerFunc {
 
 		// Get user's cart items
 		var cartItems []struct {
-			ProductID uint    `json:"product_id"`
-			Quantity  int     `json:"quantity"`
-			Price     float64 `json:"price"`
+			ProductID uint `json:"product_id"`
+			Quantity  int  `json:"quantity"`
 		}
 
 		if err := tx.Model(&CartItem{}).Where("user_id = ?", authUser.ID).Find(&cartItems).Error; err != nil {
@@ -85,22 +103,16 @@ func CreateOrderFromCart(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Calculate total amount
-		var totalAmount float64
-		for _, item := range cartItems {
-			totalAmount += item.Price * float64(item.Quantity)
-		}
-
-		// Create order
+		// Create order, the total is computed from the prices at checkout
 		order := Order{
 			UserID:      authUser.ID,
 			OrderNumber: generateOrderNumber(),
 			Status:      OrderStatusPending,
-			TotalAmount: totalAmount,
+			TotalAmount: money.New(0, prices.target),
+			Currency:    prices.target,
 			Shipping:    request.Shipping,
 			Payment: PaymentInfo{
 				Method: request.PaymentMethod,
-				Amount: totalAmount,
 				Status: "pending",
 			},
 		}
@@ -108,25 +120,28 @@ func CreateOrderFromCart(db *gorm.DB) gin.HandlerFunc {
 		// Create order items and update stock
 		for _, cartItem := range cartItems {
 			var product Product
-			if err := tx.First(&product, cartItem.ProductID).Error; err != nil {
+			if err := tx.Preload("BundleComponents.Component").First(&product, cartItem.ProductID).Error; err != nil {
 				tx.Rollback()
 				c.JSON(http.StatusBadRequest, gin.H{
 					"error": fmt.Sprintf("product %d not found", cartItem.ProductID),
 				})
 				return
 			}
-
-			// Check stock availability
-			if product.Stock < cartItem.Quantity {
+			// Products hidden or unpublished since they were added to the cart
+			if !product.Orderable(time.Now()) {
 				tx.Rollback()
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": fmt.Sprintf("not enough stock for product %s", product.Name),
-				})
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("product %s is no longer available", product.Name)})
 				return
 			}
 
-			// Reduce product stock
-			if err := tx.Model(&product).Update("stock", gorm.Expr("stock - ?", cartItem.Quantity)).Error; err != nil {
+			// Reduce product stock, or the stock of the components of a bundle
+			components, err := takeFromStock(tx, &product, cartItem.Quantity)
+			if errors.Is(err, models.ErrInsufficientStock) {
+				tx.Rollback()
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
 				tx.Rollback()
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"error": fmt.Sprintf("failed to update stock for product %d", product.ID),
@@ -134,12 +149,29 @@ func CreateOrderFromCart(db *gorm.DB) gin.HandlerFunc {
 				return
 			}
 
+			price, rate, err := prices.convert(product.EffectivePrice, order.Currency)
+			if err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
 			order.Items = append(order.Items, OrderItem{
-				ProductID:   product.ID,
-				Quantity:    cartItem.Quantity,
-				PriceAtTime: product.Price,
+				ProductID:    product.ID,
+				Quantity:     cartItem.Quantity,
+				PriceAtTime:  price,
+				ShopPrice:    product.EffectivePrice,
+				ExchangeRate: rate,
+				Components:   components,
 			})
+			// Items are rounded to the minor unit before the sum, the total is exact
+			if order.TotalAmount, err = order.TotalAmount.Add(price.Mul(cartItem.Quantity)); err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
 		}
+		order.Payment.Amount = order.TotalAmount
 
 		// Save order
 		if err := tx.Create(&order).Error; err != nil {
@@ -194,10 +226,12 @@ func GetOrders(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Pagination parameters
-		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-		offset := (page - 1) * limit
+		// Pagination parameters (page numbers or keyset cursor)
+		pagination, err := parsePagination(c, 10)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
 		// Filter parameters
 		status := c.Query("status")
@@ -206,7 +240,8 @@ func GetOrders(db *gorm.DB) gin.HandlerFunc {
 		query := db.Model(&Order{}).
 			Preload("User").
 			Preload("Items").
-			Preload("Items.Product")
+			Preload("Items.Product").
+			Preload("Items.Components")
 
 		if status != "" {
 			query = query.Where("status = ?", status)
@@ -221,18 +256,32 @@ func GetOrders(db *gorm.DB) gin.HandlerFunc {
 		query.Count(&totalCount)
 
 		// Get paginated results
+		keys, err := orderSortRegistry.Parse(c.Query("sort"), "")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query, err = pagination.Apply(query, keys)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		var orders []Order
-		if err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&orders).Error; err != nil {
+		if err := query.Find(&orders).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch orders"})
 			return
 		}
+		nextCursor, hasMore := pagination.Finish(&orders, keys)
 
-		c.JSON(http.StatusOK, gin.H{
+		response := gin.H{
 			"orders":      orders,
 			"total_count": totalCount,
-			"page":        page,
-			"limit":       limit,
-		})
+		}
+		for key, value := range pagination.Meta(totalCount, nextCursor, hasMore) {
+			response[key] = value
+		}
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -241,7 +290,7 @@ func GetUserOrders(db *gorm.DB) gin.HandlerFunc {
 		// Get authenticated user
 		authUser, err := auth.GetAuthUser(c)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Authentication required")})
 			return
 		}
 
@@ -250,14 +299,17 @@ func GetUserOrders(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Pagination parameters
-		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-		offset := (page - 1) * limit
+		// Pagination parameters (page numbers or keyset cursor)
+		pagination, err := parsePagination(c, 10)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
 		query := db.Model(&Order{}).
 			Preload("Items").
 			Preload("Items.Product").
+			Preload("Items.Components").
 			Where("user_id = ?", authUser.ID)
 
 		// Get total count
@@ -265,18 +317,32 @@ func GetUserOrders(db *gorm.DB) gin.HandlerFunc {
 		query.Count(&totalCount)
 
 		// Get paginated results
+		keys, err := orderSortRegistry.Parse(c.Query("sort"), "")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query, err = pagination.Apply(query, keys)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		var orders []Order
-		if err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&orders).Error; err != nil {
+		if err := query.Find(&orders).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch orders"})
 			return
 		}
+		nextCursor, hasMore := pagination.Finish(&orders, keys)
 
-		c.JSON(http.StatusOK, gin.H{
+		response := gin.H{
 			"orders":      orders,
 			"total_count": totalCount,
-			"page":        page,
-			"limit":       limit,
-		})
+		}
+		for key, value := range pagination.Meta(totalCount, nextCursor, hasMore) {
+			response[key] = value
+		}
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -289,6 +355,7 @@ func GetOrderDetails(db *gorm.DB) gin.HandlerFunc {
 			Preload("User").
 			Preload("Items").
 			Preload("Items.Product").
+			Preload("Items.Components").
 			Preload("Items.Product.Images").
 			First(&order, orderID).Error
 
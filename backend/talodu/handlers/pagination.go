@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// List endpoints support two pagination modes:
+//   - page numbers: ?page=2&limit=10 (the default)
+//   - keyset cursors: ?pagination=cursor&limit=10 for the first page, then
+//     ?cursor=<nextCursor> for the following ones. Cursors are stable while rows
+//     are added or removed, which avoids the duplicates and gaps of deep offsets.
+
+const maxPageLimit = 100
+
+// SortKey is one column of a list ordering. Field is the name of the struct
+// field holding the column value, it is used to build the next cursor.
+// Column can also be an SQL expression taking Args.
+type SortKey struct {
+	Column string
+	Args   []interface{}
+	Field  string
+	Desc   bool
+}
+
+// Pagination holds the pagination parameters of a list request
+type Pagination struct {
+	Page   int
+	Limit  int
+	Keyset bool
+	cursor *listCursor
+}
+
+// listCursor is the decoded form of the opaque cursor sent to clients
+type listCursor struct {
+	Order  string        `json:"o"`
+	Values []cursorValue `json:"v"`
+}
+
+type cursorValue struct {
+	Type  string `json:"t"`
+	Value string `json:"v"`
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// parsePagination reads ?page, ?limit, ?pagination and ?cursor
+func parsePagination(c *gin.Context, defaultLimit int) (Pagination, error) {
+	p := Pagination{Page: 1, Limit: defaultLimit}
+
+	if limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit))); err == nil && limit > 0 {
+		p.Limit = limit
+	}
+	if p.Limit > maxPageLimit {
+		p.Limit = maxPageLimit
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := decodeListCursor(raw)
+		if err != nil {
+			return p, err
+		}
+		p.Keyset = true
+		p.cursor = cursor
+		return p, nil
+	}
+
+	if c.Query("pagination") == "cursor" {
+		p.Keyset = true
+		return p, nil
+	}
+
+	if page, err := strconv.Atoi(c.DefaultQuery("page", "1")); err == nil && page > 0 {
+		p.Page = page
+	}
+	return p, nil
+}
+
+// Apply orders the query by the sort keys, always ending with the primary key
+// so the order is stable, and restricts it to the requested page.
+func (p *Pagination) Apply(query *gorm.DB, keys []SortKey) (*gorm.DB, error) {
+	for _, key := range keys {
+		direction := "ASC"
+		if key.Desc {
+			direction = "DESC"
+		}
+		if len(key.Args) > 0 {
+			query = query.Order(clause.OrderBy{Expression: clause.Expr{
+				SQL:                key.Column + " " + direction,
+				Vars:               key.Args,
+				WithoutParentheses: true,
+			}})
+		} else {
+			query = query.Order(key.Column + " " + direction)
+		}
+	}
+
+	if !p.Keyset {
+		return query.Offset((p.Page - 1) * p.Limit).Limit(p.Limit), nil
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("cursor pagination needs a sort order")
+	}
+	for _, key := range keys {
+		if key.Field == "" || len(key.Args) > 0 {
+			return nil, errors.New("this sort order cannot be used with cursor pagination")
+		}
+	}
+
+	if p.cursor != nil {
+		if p.cursor.Order != sortKeysSignature(keys) || len(p.cursor.Values) != len(keys) {
+			return nil, errors.New("cursor does not match the requested sort order")
+		}
+		after := make([]interface{}, len(keys))
+		for i, value := range p.cursor.Values {
+			v, err := value.decode()
+			if err != nil {
+				return nil, errInvalidCursor
+			}
+			after[i] = v
+		}
+
+		// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ... with < for descending keys
+		var conditions []string
+		var args []interface{}
+		for i, key := range keys {
+			var parts []string
+			for j := 0; j < i; j++ {
+				parts = append(parts, keys[j].Column+" = ?")
+				args = append(args, after[j])
+			}
+			operator := ">"
+			if key.Desc {
+				operator = "<"
+			}
+			parts = append(parts, key.Column+" "+operator+" ?")
+			args = append(args, after[i])
+			conditions = append(conditions, "("+strings.Join(parts, " AND ")+")")
+		}
+		query = query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+
+	// One extra row tells whether there is a next page
+	return query.Limit(p.Limit + 1), nil
+}
+
+// Finish trims the extra row fetched in cursor mode and returns the cursor of
+// the next page. items must be a pointer to the slice the query was scanned into.
+func (p *Pagination) Finish(items interface{}, keys []SortKey) (nextCursor string, hasMore bool) {
+	if !p.Keyset {
+		return "", false
+	}
+
+	slice := reflect.ValueOf(items).Elem()
+	if slice.Len() <= p.Limit {
+		return "", false
+	}
+	slice.Set(slice.Slice(0, p.Limit))
+
+	last := reflect.Indirect(slice.Index(p.Limit - 1))
+	cursor := listCursor{Order: sortKeysSignature(keys)}
+	for _, key := range keys {
+		field := last.FieldByName(key.Field)
+		if !field.IsValid() {
+			return "", true
+		}
+		cursor.Values = append(cursor.Values, newCursorValue(field.Interface()))
+	}
+
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", true
+	}
+	return base64.RawURLEncoding.EncodeToString(data), true
+}
+
+// Meta returns the pagination fields added to list responses
+func (p *Pagination) Meta(totalCount int64, nextCursor string, hasMore bool) gin.H {
+	meta := gin.H{
+		"limit":      p.Limit,
+		"totalItems": totalCount,
+	}
+	if p.Keyset {
+		meta["nextCursor"] = nextCursor
+		meta["hasMore"] = hasMore
+	} else {
+		meta["page"] = p.Page
+		meta["totalPages"] = int(math.Ceil(float64(totalCount) / float64(p.Limit)))
+	}
+	return meta
+}
+
+// withIDTiebreaker appends the primary key to the sort keys unless it is already there
+func withIDTiebreaker(keys []SortKey, idColumn string) []SortKey {
+	for _, key := range keys {
+		if key.Column == idColumn {
+			return keys
+		}
+	}
+	desc := false
+	if len(keys) > 0 {
+		desc = keys[len(keys)-1].Desc
+	}
+	return append(keys, SortKey{Column: idColumn, Field: "ID", Desc: desc})
+}
+
+func sortKeysSignature(keys []SortKey) string {
+	var parts []string
+	for _, key := range keys {
+		if key.Desc {
+			parts = append(parts, "-"+key.Column)
+		} else {
+			parts = append(parts, key.Column)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func decodeListCursor(raw string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || len(cursor.Values) == 0 {
+		return nil, errInvalidCursor
+	}
+	return &cursor, nil
+}
+
+func newCursorValue(v interface{}) cursorValue {
+	switch value := v.(type) {
+	case time.Time:
+		return cursorValue{Type: "time", Value: value.UTC().Format(time.RFC3339Nano)}
+	case *time.Time:
+		if value == nil {
+			return cursorValue{Type: "null"}
+		}
+		return cursorValue{Type: "time", Value: value.UTC().Format(time.RFC3339Nano)}
+	case int, int8, int16, int32, int64:
+		return cursorValue{Type: "int", Value: fmt.Sprint(value)}
+	case uint, uint8, uint16, uint32, uint64:
+		return cursorValue{Type: "uint", Value: fmt.Sprint(value)}
+	case float32, float64:
+		return cursorValue{Type: "float", Value: fmt.Sprint(value)}
+	case bool:
+		return cursorValue{Type: "bool", Value: strconv.FormatBool(value)}
+	case driver.Valuer:
+		// Column types like money.Money, by the value stored in the column
+		if stored, err := value.Value(); err == nil {
+			return newCursorValue(stored)
+		}
+		return cursorValue{Type: "string", Value: fmt.Sprint(value)}
+	default:
+		return cursorValue{Type: "string", Value: fmt.Sprint(value)}
+	}
+}
+
+func (v cursorValue) decode() (interface{}, error) {
+	switch v.Type {
+	case "time":
+		return time.Parse(time.RFC3339Nano, v.Value)
+	case "int":
+		return strconv.ParseInt(v.Value, 10, 64)
+	case "uint":
+		return strconv.ParseUint(v.Value, 10, 64)
+	case "float":
+		return strconv.ParseFloat(v.Value, 64)
+	case "bool":
+		return strconv.ParseBool(v.Value)
+	case "string":
+		return v.Value, nil
+	case "null":
+		return nil, nil
+	}
+	return nil, errInvalidCursor
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"talodu/i18n"
+	"talodu/models"
+	"talodu/money"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// lowestPriceDays is the period of the "lowest price in the last 30 days"
+// shown next to a sale price, as consumer law requires for price reductions
+const lowestPriceDays = 30
+
+// PUT /products/:id/sale - Set the sale price and its optional dates, a null sale_price ends the sale
+func SetProductSale(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			SalePrice *float64   `json:"sale_price"` // In the product currency
+			StartsAt  *time.Time `json:"starts_at"`
+			EndsAt    *time.Time `json:"ends_at"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		product, authUser, ok := loadManagedProduct(c, db)
+		if !ok {
+			return
+		}
+
+		updates := map[string]interface{}{"sale_price": nil, "sale_starts_at": nil, "sale_ends_at": nil}
+		if input.SalePrice != nil {
+			salePrice := money.FromMajor(*input.SalePrice, product.Currency)
+			if salePrice.Amount < 0 || salePrice.Amount >= product.Price.Amount {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "sale_price must be lower than the regular price"})
+				return
+			}
+			if input.StartsAt != nil && input.EndsAt != nil && !input.EndsAt.After(*input.StartsAt) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be after starts_at"})
+				return
+			}
+			if input.EndsAt != nil && !input.EndsAt.After(time.Now()) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be in the future"})
+				return
+			}
+			updates = map[string]interface{}{
+				"sale_price":     salePrice,
+				"sale_starts_at": input.StartsAt,
+				"sale_ends_at":   input.EndsAt,
+			}
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(product).Updates(updates).Error; err != nil {
+				return err
+			}
+			return models.RecordPriceHistory(tx, product.ID, &authUser.ID)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update the sale"})
+			return
+		}
+		if err := db.First(product, product.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch updated product"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Sale updated", "product": product})
+	}
+}
+
+// GET /products/:id/price-history?days=90 - Price changes of a product for
+// the chart, with the lowest price of the 30 days before the current sale
+// (or before now when there is no sale)
+func GetProductPriceHistory(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days, err := strconv.Atoi(c.DefaultQuery("days", "90"))
+		if err != nil || days < 1 || days > 730 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 730"})
+			return
+		}
+
+		// Drafts and archived products are hidden, their prices with them
+		var product models.Product
+		if err := db.Scopes(visibleProducts).First(&product, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
+			return
+		}
+
+		now := time.Now()
+		// The lowest price is the one before the reduction, not during it
+		referenceEnd := now
+		if product.OnSale && product.SaleStartsAt != nil {
+			referenceEnd = *product.SaleStartsAt
+		} else if product.OnSale {
+			// A sale without start date began with the first record of the current run of sale prices
+			var saleStart models.PriceHistory
+			result := db.Where(`product_id = ? AND sale_price IS NOT NULL AND created_at >
+				COALESCE((SELECT MAX(created_at) FROM price_histories WHERE product_id = ? AND sale_price IS NULL), '-infinity')`, product.ID, product.ID).
+				Order("created_at ASC").Limit(1).Find(&saleStart)
+			if result.Error == nil && result.RowsAffected > 0 {
+				referenceEnd = saleStart.CreatedAt
+			}
+		}
+		referenceStart := referenceEnd.AddDate(0, 0, -lowestPriceDays)
+
+		since := now.AddDate(0, 0, -days)
+		if referenceStart.Before(since) {
+			since = referenceStart
+		}
+
+		// The record in force at the start of the period, then the following changes
+		history := []models.PriceHistory{}
+		var first models.PriceHistory
+		result := db.Where("product_id = ? AND created_at <= ?", product.ID, since).Order("created_at DESC, id DESC").Limit(1).Find(&first)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price history"})
+			return
+		}
+		if result.RowsAffected > 0 {
+			history = append(history, first)
+		}
+		var changes []models.PriceHistory
+		if err := db.Where("product_id = ? AND created_at > ?", product.ID, since).Order("created_at ASC, id ASC").Find(&changes).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price history"})
+			return
+		}
+		history = append(history, changes...)
+
+		response := gin.H{
+			"product_id":      product.ID,
+			"price":           product.Price,
+			"sale_price":      product.SalePrice,
+			"effective_price": product.EffectivePrice,
+			"on_sale":         product.OnSale,
+			"currency":        product.Currency,
+			"history":         history,
+		}
+		if lowest, ok := models.LowestPrice(history, referenceStart, referenceEnd); ok {
+			response["lowest_price_30_days"] = lowest
+			response["lowest_price_period"] = gin.H{"from": referenceStart, "to": referenceEnd}
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"talodu/i18n"
 	"talodu/models"
 
 	"github.com/gin-gonic/gin"
@@ -26,24 +27,21 @@ func GetProductDeAbouts1(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// GET /products/abouts/:productId - The abouts of a product in the language
+// of the request, reviewed translations only
 func GetProductAbouts(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		productID := c.Param("id")
-		lang := c.Query("lang") // Optional language filter
+		productID := c.Param("productId")
+		lang := i18n.Language(c)
 
 		var abouts []models.ProductAbout
-		query := db.Preload("Translations").Where("product_id = ?", productID).Order("item_order")
-
-		if lang != "" {
-			// Join with translations and filter by language
-			query = query.Joins("JOIN product_about_translations ON product_abouts.id = product_about_translations.product_about_id").
-				Where("product_about_translations.language = ?", lang)
-		}
-
-		if err := query.Find(&abouts).Error; err != nil {
+		if err := db.Preload("Translations").Where("product_id = ?", productID).Order("item_order").Find(&abouts).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch abouts"})
 			return
 		}
+		for i := range abouts {
+			abouts[i].Localize(lang)
+		}
 
 		c.JSON(http.StatusOK, abouts)
 	}
@@ -321,6 +319,7 @@ func UpdateProductAboutTranslation(db *gorm.DB) gin.HandlerFunc {
 
 		// 4. Update translation
 		translation.AboutText = input.AboutText
+		translation.Draft = false // Reviewed
 		if err := db.Save(&translation).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update translation"})
 			return
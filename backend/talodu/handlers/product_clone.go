@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"talodu/i18n"
+	"talodu/models"
+	"talodu/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// copyProductImage copies the files of an image under products/<productID>
+// and returns the image record for the copy, with the new keys
+func copyProductImage(ctx context.Context, image models.ProductImage, productID uint) (models.ProductImage, error) {
+	oldBase := strings.TrimSuffix(path.Base(image.Key), path.Ext(image.Key))
+	newBase := uuid.New().String()
+
+	var copied []string
+	copyKey := func(key string) (string, error) {
+		if key == "" {
+			return "", nil
+		}
+		name := path.Base(key)
+		if strings.HasPrefix(name, oldBase) {
+			name = newBase + strings.TrimPrefix(name, oldBase) // Keeps the rendition suffix
+		} else {
+			name = newBase + "_" + name
+		}
+		newKey := fmt.Sprintf("products/%d/%s", productID, name)
+
+		src, err := storage.Default.Get(ctx, key)
+		if err != nil {
+			return "", err
+		}
+		data, err := io.ReadAll(src)
+		src.Close()
+		if err != nil {
+			return "", err
+		}
+		if err := storage.Default.Put(ctx, newKey, bytes.NewReader(data), int64(len(data)), mime.TypeByExtension(path.Ext(newKey))); err != nil {
+			return "", err
+		}
+		copied = append(copied, newKey)
+		return newKey, nil
+	}
+
+	clone := models.ProductImage{
+		ProductID: productID,
+		Width:     image.Width,
+		Height:    image.Height,
+		MimeType:  image.MimeType,
+		AltText:   image.AltText,
+		IsPrimary: image.IsPrimary,
+		IsVisible: image.IsVisible,
+		Position:  image.Position,
+		Variant:   image.Variant,
+		Color:     image.Color,
+		SourceURL: image.SourceURL,
+	}
+	for _, t := range image.Translations {
+		clone.Translations = append(clone.Translations, models.ProductImageTranslation{Language: t.Language, AltText: t.AltText})
+	}
+	for _, field := range []struct {
+		from string
+		to   *string
+	}{
+		{image.Key, &clone.Key},
+		{image.ThumbnailKey, &clone.ThumbnailKey},
+		{image.MediumKey, &clone.MediumKey},
+		{image.LargeKey, &clone.LargeKey},
+		{image.WebPKey, &clone.WebPKey},
+	} {
+		key, err := copyKey(field.from)
+		if err != nil {
+			storage.DeleteKeys(ctx, copied)
+			return models.ProductImage{}, fmt.Errorf("failed to copy %s: %w", field.from, err)
+		}
+		*field.to = key
+	}
+	return clone, nil
+}
+
+// POST /products/:id/clone - Copy a product with its translations, abouts,
+// categories, attributes, images and bundle components into the same shop or
+// another shop the user manages, bundles only into their shop. The copy is a
+// hidden draft with its own slug and image files.
+func CloneProduct(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			ShopID uint   `json:"shop_id"` // Same shop when absent
+			Name   string `json:"name"`    // "<name> (copy)" when absent
+		}
+		if err := c.ShouldBindJSON(&input); err != nil && err != io.EOF {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		source, authUser, ok := loadManagedProduct(c, db)
+		if !ok {
+			return
+		}
+		shop := source.Shop
+		if err := db.Preload("Translations").
+			Preload("Categories").
+			Preload("Images", preloadProductImages(false)).
+			Preload("Images.Translations").
+			Preload("Attributes.Translations").
+			First(source, source.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+			return
+		}
+		var abouts []models.ProductAbout
+		if err := db.Preload("Translations").Where("product_id = ?", source.ID).Order("item_order").Find(&abouts).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch abouts"})
+			return
+		}
+
+		if err := loadBundleComponents(db, source); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bundle components"})
+			return
+		}
+
+		if input.ShopID != 0 && input.ShopID != source.ShopID {
+			// The components of a bundle are products of its shop
+			if source.IsBundle() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "A bundle can only be cloned into its own shop"})
+				return
+			}
+			if err := db.Preload("Employees").First(&shop, input.ShopID).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Shop not found")})
+				return
+			}
+			if !canManageShopProducts(authUser, shop) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "You don't manage this shop"})
+				return
+			}
+		}
+
+		// SKUs are unique in a shop, the copy keeps it only in another shop where it's free
+		sku := ""
+		if shop.ID != source.ShopID && source.SKU != "" {
+			taken, err := skuTaken(db, shop.ID, 0, source.SKU)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check the SKU"})
+				return
+			}
+			if !taken {
+				sku = source.SKU
+			}
+		}
+
+		name := strings.TrimSpace(input.Name)
+		if name == "" {
+			name = source.Name + " (copy)"
+		}
+		clone := models.Product{
+			Name:         name,
+			Slug:         uuid.New().String(), // Unique placeholder, AfterCreate sets the slug
+			Description:  source.Description,
+			Price:        source.Price,
+			SalePrice:    source.SalePrice,
+			SaleStartsAt: source.SaleStartsAt,
+			SaleEndsAt:   source.SaleEndsAt,
+			Stock:        source.Stock,
+			ShopID:       shop.ID,
+			SKU:          sku,
+			GTIN:         source.GTIN,
+			Type:         source.Type,
+			Status:       models.ProductStatusDraft, // Hidden until submitted and approved
+		}
+
+		ctx := c.Request.Context()
+		var copiedKeys []string
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&clone).Error; err != nil {
+				return err
+			}
+
+			for _, t := range source.Translations {
+				translation := models.ProductTranslation{ProductID: clone.ID, Language: t.Language, Name: t.Name, Description: t.Description, Draft: t.Draft}
+				if err := tx.Create(&translation).Error; err != nil {
+					return err
+				}
+			}
+
+			for _, about := range abouts {
+				aboutCopy := models.ProductAbout{ProductID: clone.ID, ItemOrder: about.ItemOrder, AboutText: about.AboutText}
+				for _, t := range about.Translations {
+					aboutCopy.Translations = append(aboutCopy.Translations, models.ProductAboutTranslation{Language: t.Language, AboutText: t.AboutText, Draft: t.Draft})
+				}
+				if err := tx.Create(&aboutCopy).Error; err != nil {
+					return err
+				}
+			}
+
+			if len(source.Categories) > 0 {
+				if err := tx.Model(&clone).Association("Categories").Append(source.Categories); err != nil {
+					return err
+				}
+			}
+
+			for _, value := range source.Attributes {
+				valueCopy := models.ProductAttributeValue{
+					ProductID:             clone.ID,
+					AttributeDefinitionID: value.AttributeDefinitionID,
+					Value:                 value.Value,
+					NumberValue:           value.NumberValue,
+				}
+				for _, t := range value.Translations {
+					valueCopy.Translations = append(valueCopy.Translations, models.ProductAttributeValueTranslation{Language: t.Language, Value: t.Value})
+				}
+				if err := tx.Create(&valueCopy).Error; err != nil {
+					return err
+				}
+			}
+
+			for _, component := range source.BundleComponents {
+				componentCopy := models.BundleComponent{BundleID: clone.ID, ComponentID: component.ComponentID, Quantity: component.Quantity}
+				if err := tx.Create(&componentCopy).Error; err != nil {
+					return err
+				}
+			}
+
+			for _, image := range source.Images {
+				imageCopy, err := copyProductImage(ctx, image, clone.ID)
+				if err != nil {
+					return err
+				}
+				copiedKeys = append(copiedKeys, imageCopy.ObjectKeys()...)
+				if err := tx.Create(&imageCopy).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			storage.DeleteKeys(ctx, copiedKeys)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clone product: " + err.Error()})
+			return
+		}
+
+		var created models.Product
+		if err := db.Preload("Translations").
+			Preload("Categories").
+			Preload("Images", preloadProductImages(false)).
+			Preload("Images.Translations").
+			First(&created, clone.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cloned product"})
+			return
+		}
+		if err := loadBundleComponents(db, &created); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bundle components"})
+			return
+		}
+		created.Shop = shop
+
+		c.JSON(http.StatusCreated, gin.H{"message": "Product cloned", "product": created, "source_id": source.ID})
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"talodu/auth"
+	"talodu/i18n"
+	"talodu/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// normalizeProductGTIN validates the optional barcode of a product
+func normalizeProductGTIN(gtin string) (string, error) {
+	if strings.TrimSpace(gtin) == "" {
+		return "", nil
+	}
+	return models.NormalizeGTIN(gtin)
+}
+
+// skuTaken tells whether another product of the shop already uses sku,
+// productID is the product being saved, 0 for a new one
+func skuTaken(db *gorm.DB, shopID, productID uint, sku string) (bool, error) {
+	if sku == "" {
+		return false, nil
+	}
+	var count int64
+	err := db.Model(&models.Product{}).
+		Where("shop_id = ? AND sku = ? AND id <> ?", shopID, sku, productID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// applyProductIdentifierSearch extends the text search of the sellers with
+// their identifiers: SKUs starting with the search and equal barcodes
+func applyProductIdentifierSearch(db *gorm.DB, query *gorm.DB, search, lang string) *gorm.DB {
+	search = strings.TrimSpace(search)
+	if search == "" {
+		return query
+	}
+
+	text := applyProductSearch(db, db.Session(&gorm.Session{NewDB: true}), search, lang)
+	if _, ok := text.Statement.Clauses["WHERE"]; !ok {
+		// Nothing left of the search once stop words are removed
+		return query
+	}
+
+	identifiers := db.Where("products.sku ILIKE ?", escapeLike(search)+"%")
+	if gtin, err := models.NormalizeGTIN(search); err == nil {
+		identifiers = identifiers.Or("LPAD(products.gtin, 14, '0') = ?", models.GTIN14(gtin))
+	}
+	return query.Where(text.Or(identifiers))
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// GET /products/lookup?barcode=...&shop_id=... - Find products by scanned
+// barcode, matched against the GTINs then the SKUs. With a shop_id the
+// hidden products of that shop are included, for the shop managers.
+func LookupProduct(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		barcode := strings.TrimSpace(c.Query("barcode"))
+		if barcode == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "barcode is required"})
+			return
+		}
+
+		query := db.Model(&models.Product{}).
+			Preload("Images", preloadProductImages(false)).
+			Preload("Translations").
+			Preload("Shop", func(db *gorm.DB) *gorm.DB {
+				return db.Select("id", "name")
+			})
+
+		staff := false
+		if shopID := c.Query("shop_id"); shopID != "" {
+			authUser, err := auth.GetAuthUser(c)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
+				return
+			}
+			var shop models.Shop
+			if err := db.Preload("Employees").First(&shop, shopID).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Shop not found")})
+				return
+			}
+			if !canManageShopProducts(authUser, shop) {
+				c.JSON(http.StatusForbidden, gin.H{"error": i18n.T(c, "Operation not permitted")})
+				return
+			}
+			query = query.Where("shop_id = ?", shop.ID)
+			staff = true
+		} else {
+			query = query.Where("is_visible = ?", true)
+		}
+
+		// A code that isn't a valid GTIN can still be a SKU printed as a barcode
+		gtin, gtinErr := models.NormalizeGTIN(barcode)
+		if gtinErr == nil {
+			query = query.Where("LPAD(gtin, 14, '0') = ? OR sku = ?", models.GTIN14(gtin), barcode)
+		} else {
+			query = query.Where("sku = ?", barcode)
+		}
+
+		var products []models.Product
+		if err := query.Order("id").Limit(50).Find(&products).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up products"})
+			return
+		}
+		// Shop managers review the machine translations, customers only see reviewed ones
+		for i := range products {
+			if staff {
+				products[i].LocalizeWithDrafts(i18n.Language(c))
+			} else {
+				products[i].Localize(i18n.Language(c))
+			}
+		}
+
+		// The app offers to create the product when nothing matches, with the barcode filled in
+		response := gin.H{
+			"barcode":    barcode,
+			"valid_gtin": gtinErr == nil,
+			"products":   products,
+		}
+		if gtinErr == nil {
+			response["gtin"] = gtin
+		}
+		if len(products) == 0 {
+			response["error"] = "No product matches this barcode"
+			c.JSON(http.StatusNotFound, response)
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
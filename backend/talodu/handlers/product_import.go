@@ -0,0 +1,650 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"talodu/auth"
+	"talodu/currency"
+	"talodu/i18n"
+	"talodu/imageproc"
+	"talodu/models"
+	"talodu/money"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Products are imported from a CSV or XLSX file whose first row names the
+// columns (case insensitive):
+//   - sku, name, price: required
+//   - description, stock, gtin: optional, gtin is an EAN/UPC barcode
+//   - categories: category names separated by "|"
+//   - images: image URLs separated by "|", downloaded during the import
+//   - name_<lang>, description_<lang>: translations, e.g. name_fr
+//
+// Products are matched by SKU within the shop, existing ones are updated and
+// the others created. Columns missing from the file are left untouched.
+
+const (
+	maxImportFileSize  = 20 << 20 // 20 MB
+	maxImportRows      = 5000
+	importListSep      = "|"
+	importImageTimeout = 30 * time.Second
+)
+
+var importLanguages = map[string]bool{"en": true, "fr": true, "es": true}
+
+// productImport is a validated import file
+type productImport struct {
+	columns map[string]bool
+	rows    []importRow
+}
+
+func (p *productImport) has(column string) bool {
+	return p.columns[column]
+}
+
+type importRow struct {
+	Line         int
+	SKU          string
+	GTIN         string
+	Name         string
+	Description  string
+	Price        money.Money
+	Stock        int
+	Categories   []string
+	Images       []string
+	Translations map[string]models.ProductTranslation // by language
+}
+
+// POST /shops/:id/products/import?dry_run=true - Import products from a CSV or XLSX file
+func ImportShopProducts(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authUser, err := auth.GetAuthUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
+			return
+		}
+
+		var shop models.Shop
+		if err := db.Preload("Employees").First(&shop, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Shop not found")})
+			return
+		}
+		if !canManageShopProducts(authUser, shop) {
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.T(c, "Operation not permitted")})
+			return
+		}
+
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A CSV or XLSX file is required"})
+			return
+		}
+		if file.Size > maxImportFileSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("File exceeds the maximum size of %d MB", maxImportFileSize>>20)})
+			return
+		}
+
+		records, err := readImportFile(file)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Everything is validated before anything is written
+		data, rowErrors := parseProductImport(records, shopCurrency(db, shop.ID))
+		report := gin.H{
+			"valid":      len(rowErrors) == 0,
+			"total_rows": len(data.rows),
+			"errors":     rowErrors,
+		}
+
+		var skus []string
+		for _, row := range data.rows {
+			skus = append(skus, row.SKU)
+		}
+		var existing []string
+		if len(skus) > 0 {
+			if err := db.Model(&models.Product{}).Where("shop_id = ? AND sku IN ?", shop.ID, skus).Pluck("sku", &existing).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing products"})
+				return
+			}
+		}
+		report["to_update"] = len(existing)
+		report["to_create"] = len(data.rows) - len(existing)
+
+		if len(rowErrors) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, report)
+			return
+		}
+		if c.Query("dry_run") == "true" {
+			c.JSON(http.StatusOK, report)
+			return
+		}
+
+		job := models.ImportJob{
+			ShopID:    shop.ID,
+			UserID:    authUser.ID,
+			Filename:  file.Filename,
+			Status:    models.ImportStatusPending,
+			TotalRows: len(data.rows),
+			Errors:    []models.ImportRowError{},
+		}
+		if err := db.Create(&job).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create import job"})
+			return
+		}
+
+		go runProductImport(db, job.ID, shop.ID, initialProductStatus(c), data)
+
+		report["job"] = job
+		c.JSON(http.StatusAccepted, report)
+	}
+}
+
+// GET /shops/:id/products/import/:jobId - Progress of an import
+func GetProductImportJob(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authUser, err := auth.GetAuthUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
+			return
+		}
+
+		var shop models.Shop
+		if err := db.Preload("Employees").First(&shop, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Shop not found")})
+			return
+		}
+		if !canManageShopProducts(authUser, shop) {
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.T(c, "Operation not permitted")})
+			return
+		}
+
+		var job models.ImportJob
+		if err := db.Where("shop_id = ?", shop.ID).First(&job, c.Param("jobId")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Import job not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// FailInterruptedImports marks the imports left unfinished by a restart as failed
+func FailInterruptedImports(db *gorm.DB) {
+	now := time.Now()
+	db.Model(&models.ImportJob{}).
+		Where("status IN ?", []models.ImportStatus{models.ImportStatusPending, models.ImportStatusRunning}).
+		Updates(map[string]interface{}{"status": models.ImportStatusFailed, "finished_at": now})
+}
+
+// readImportFile returns the cells of a CSV file or of the first sheet of an XLSX file
+func readImportFile(file *multipart.FileHeader) ([][]string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, errors.New("failed to read file")
+	}
+	defer src.Close()
+
+	switch strings.ToLower(filepath.Ext(file.Filename)) {
+	case ".csv":
+		reader := csv.NewReader(src)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV file: %v", err)
+		}
+		return records, nil
+	case ".xlsx":
+		workbook, err := excelize.OpenReader(src)
+		if err != nil {
+			return nil, fmt.Errorf("invalid XLSX file: %v", err)
+		}
+		defer workbook.Close()
+		sheets := workbook.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, errors.New("the XLSX file has no sheet")
+		}
+		return workbook.GetRows(sheets[0])
+	default:
+		return nil, errors.New("unsupported file type, upload a .csv or .xlsx file")
+	}
+}
+
+// parseProductImport validates all the rows and returns every problem found,
+// prices are read in priceCurrency
+func parseProductImport(records [][]string, priceCurrency string) (*productImport, []models.ImportRowError) {
+	data := &productImport{columns: make(map[string]bool)}
+	rowErrors := []models.ImportRowError{}
+
+	if len(records) == 0 {
+		return data, []models.ImportRowError{{Row: 1, Message: "the file is empty"}}
+	}
+
+	header := make([]string, len(records[0]))
+	for i, name := range records[0] {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		header[i] = name
+		if name == "" {
+			continue
+		}
+		if !isImportColumn(name) {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: 1, Field: name, Message: "unknown column"})
+			continue
+		}
+		if data.columns[name] {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: 1, Field: name, Message: "duplicate column"})
+		}
+		data.columns[name] = true
+	}
+	for _, required := range []string{"sku", "name", "price"} {
+		if !data.columns[required] {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: 1, Field: required, Message: "missing required column"})
+		}
+	}
+	if len(rowErrors) > 0 {
+		return data, rowErrors
+	}
+	if len(records)-1 > maxImportRows {
+		return data, []models.ImportRowError{{Row: maxImportRows + 2, Message: fmt.Sprintf("a file can't have more than %d products", maxImportRows)}}
+	}
+
+	seenSKUs := make(map[string]int)
+	for i, record := range records[1:] {
+		line := i + 2
+		cells := make(map[string]string)
+		empty := true
+		for j, value := range record {
+			if j < len(header) {
+				cells[header[j]] = strings.TrimSpace(value)
+				empty = empty && cells[header[j]] == ""
+			}
+		}
+		if empty {
+			continue
+		}
+
+		row := importRow{Line: line, Translations: make(map[string]models.ProductTranslation)}
+		fail := func(field, message string) {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: line, SKU: row.SKU, Field: field, Message: message})
+		}
+
+		row.SKU = cells["sku"]
+		switch {
+		case row.SKU == "":
+			fail("sku", "is required")
+		case len(row.SKU) > 64:
+			fail("sku", "must be at most 64 characters")
+		case seenSKUs[row.SKU] > 0:
+			fail("sku", fmt.Sprintf("duplicates row %d", seenSKUs[row.SKU]))
+		default:
+			seenSKUs[row.SKU] = line
+		}
+
+		if gtin, err := normalizeProductGTIN(cells["gtin"]); err != nil {
+			fail("gtin", err.Error())
+		} else {
+			row.GTIN = gtin
+		}
+
+		row.Name = cells["name"]
+		if row.Name == "" {
+			fail("name", "is required")
+		}
+		row.Description = cells["description"]
+
+		price, err := money.Parse(strings.ReplaceAll(cells["price"], ",", "."), priceCurrency)
+		if err != nil || price.Amount < 0 {
+			fail("price", fmt.Sprintf("must be a positive number with at most %d decimals", currency.Decimals(priceCurrency)))
+		}
+		row.Price = price
+
+		if value := cells["stock"]; value != "" {
+			stock, err := strconv.Atoi(value)
+			if err != nil || stock < 0 {
+				fail("stock", "must be a positive whole number")
+			}
+			row.Stock = stock
+		}
+
+		row.Categories = splitImportList(cells["categories"])
+
+		row.Images = splitImportList(cells["images"])
+		for _, image := range row.Images {
+			if u, err := url.Parse(image); err != nil {
+				fail("images", fmt.Sprintf("%q is not a valid URL", image))
+			} else if err := checkImportURL(u); err != nil {
+				fail("images", fmt.Sprintf("%q: %v", image, err))
+			}
+		}
+
+		for lang := range importLanguages {
+			name, description := cells["name_"+lang], cells["description_"+lang]
+			if name == "" && description == "" {
+				continue
+			}
+			if name == "" {
+				fail("name_"+lang, "is required with description_"+lang)
+			}
+			row.Translations[lang] = models.ProductTranslation{Language: lang, Name: name, Description: description}
+		}
+
+		data.rows = append(data.rows, row)
+	}
+
+	if len(data.rows) == 0 && len(rowErrors) == 0 {
+		rowErrors = append(rowErrors, models.ImportRowError{Row: 2, Message: "the file has no products"})
+	}
+	return data, rowErrors
+}
+
+func isImportColumn(name string) bool {
+	switch name {
+	case "sku", "gtin", "name", "description", "price", "stock", "categories", "images":
+		return true
+	}
+	for _, prefix := range []string{"name_", "description_"} {
+		if strings.HasPrefix(name, prefix) && importLanguages[strings.TrimPrefix(name, prefix)] {
+			return true
+		}
+	}
+	return false
+}
+
+func splitImportList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, importListSep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// runProductImport imports the rows one by one, recording the progress on the job
+func runProductImport(db *gorm.DB, jobID uint, shopID uint, status models.ProductStatus, data *productImport) {
+	job := models.ImportJob{Model: gorm.Model{ID: jobID}}
+	started := time.Now()
+	db.Model(&job).Updates(map[string]interface{}{"status": models.ImportStatusRunning, "started_at": started})
+
+	rowErrors := []models.ImportRowError{}
+	finish := func(status models.ImportStatus) {
+		db.Model(&job).Updates(map[string]interface{}{
+			"status":      status,
+			"errors":      datatypes.JSONSlice[models.ImportRowError](rowErrors),
+			"finished_at": time.Now(),
+		})
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("product import %d panicked: %v", jobID, r)
+			rowErrors = append(rowErrors, models.ImportRowError{Message: "the import stopped unexpectedly"})
+			finish(models.ImportStatusFailed)
+		}
+	}()
+
+	ctx := context.Background()
+	var processed, createdCount, updatedCount, failedCount int
+	for _, row := range data.rows {
+		created, warnings, err := importProductRow(ctx, db, shopID, status, data, row)
+		switch {
+		case err != nil:
+			failedCount++
+			rowErrors = append(rowErrors, models.ImportRowError{Row: row.Line, SKU: row.SKU, Message: err.Error()})
+		case created:
+			createdCount++
+		default:
+			updatedCount++
+		}
+		rowErrors = append(rowErrors, warnings...)
+		processed++
+
+		db.Model(&job).Updates(map[string]interface{}{
+			"processed_rows": processed,
+			"created_count":  createdCount,
+			"updated_count":  updatedCount,
+			"failed_count":   failedCount,
+		})
+	}
+
+	finish(models.ImportStatusCompleted)
+}
+
+// importProductRow creates or updates the product of a row, new products
+// get status. Images that can't be downloaded don't fail the row, they are
+// returned as warnings.
+func importProductRow(ctx context.Context, db *gorm.DB, shopID uint, status models.ProductStatus, data *productImport, row importRow) (created bool, warnings []models.ImportRowError, err error) {
+	var product models.Product
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("shop_id = ? AND sku = ?", shopID, row.SKU).Limit(1).Find(&product)
+		if result.Error != nil {
+			return result.Error
+		}
+		created = result.RowsAffected == 0
+
+		if created {
+			product = models.Product{
+				Name:        row.Name,
+				Description: row.Description,
+				Price:       row.Price,
+				Stock:       row.Stock,
+				ShopID:      shopID,
+				SKU:         row.SKU,
+				GTIN:        row.GTIN,
+				Status:      status,
+			}
+			product.Slug = generateSlug(row.Name) + "-"
+			if err := tx.Create(&product).Error; err != nil {
+				return fmt.Errorf("failed to create product: %v", err)
+			}
+		} else {
+			if product.Currency != row.Price.Currency {
+				return fmt.Errorf("the prices of the product are in %s", product.Currency)
+			}
+			if product.SalePrice != nil && row.Price.Amount <= product.SalePrice.Amount {
+				return fmt.Errorf("price must be higher than the sale price %s", product.SalePrice)
+			}
+			updates := map[string]interface{}{"name": row.Name, "price": row.Price}
+			if data.has("description") {
+				updates["description"] = row.Description
+			}
+			if data.has("stock") {
+				updates["stock"] = row.Stock
+			}
+			if data.has("gtin") {
+				updates["gtin"] = row.GTIN
+			}
+			oldSlug := product.Slug
+			if product.Name != row.Name {
+				updates["slug"] = generateSlug(row.Name) + "-" + fmt.Sprint(product.ID)
+			}
+			if err := tx.Model(&product).Updates(updates).Error; err != nil {
+				return fmt.Errorf("failed to update product: %v", err)
+			}
+			if slug, ok := updates["slug"].(string); ok {
+				if err := models.RecordSlugChange(tx, models.SlugEntityProduct, product.ID, oldSlug, slug); err != nil {
+					return fmt.Errorf("failed to record slug change: %v", err)
+				}
+			}
+			if err := models.RecordPriceHistory(tx, product.ID, nil); err != nil {
+				return fmt.Errorf("failed to record price history: %v", err)
+			}
+		}
+
+		if data.has("categories") {
+			categories := make([]models.Category, 0, len(row.Categories))
+			for _, name := range row.Categories {
+				var category models.Category
+				if err := tx.Where("LOWER(name) = LOWER(?)", name).FirstOrCreate(&category, models.Category{Name: name}).Error; err != nil {
+					return fmt.Errorf("failed to save category %s: %v", name, err)
+				}
+				categories = append(categories, category)
+			}
+			if err := tx.Model(&product).Association("Categories").Replace(categories); err != nil {
+				return fmt.Errorf("failed to save categories: %v", err)
+			}
+		}
+
+		for lang, translation := range row.Translations {
+			var existing models.ProductTranslation
+			result := tx.Where("product_id = ? AND language = ?", product.ID, lang).Limit(1).Find(&existing)
+			if result.Error != nil {
+				return result.Error
+			}
+			var saveErr error
+			if result.RowsAffected == 0 {
+				translation.ProductID = product.ID
+				saveErr = tx.Create(&translation).Error
+			} else {
+				saveErr = tx.Model(&existing).Updates(map[string]interface{}{"name": translation.Name, "description": translation.Description}).Error
+			}
+			if saveErr != nil {
+				return fmt.Errorf("failed to save %s translation: %v", lang, saveErr)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, nil, err
+	}
+
+	// Images are downloaded outside the transaction, those already imported are skipped
+	for _, imageURL := range row.Images {
+		var count int64
+		db.Model(&models.ProductImage{}).Where("product_id = ? AND source_url = ?", product.ID, imageURL).Count(&count)
+		if count > 0 {
+			continue
+		}
+		if err := importProductImage(ctx, db, product.ID, imageURL); err != nil {
+			warnings = append(warnings, models.ImportRowError{Row: row.Line, SKU: row.SKU, Field: "images", Message: fmt.Sprintf("%s: %v", imageURL, err)})
+		}
+	}
+	return created, warnings, nil
+}
+
+// Image URLs come from the sellers' files, downloads must not reach the
+// network of the server: only http(s) on the standard ports, to public
+// addresses. The address is checked when connecting, after the resolution,
+// so a DNS answer changing between the check and the download can't get
+// around it, and again on every redirect.
+var importHTTPClient = &http.Client{
+	Timeout: importImageTimeout,
+	Transport: &http.Transport{
+		DialContext:         dialPublicAddress,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("too many redirects")
+		}
+		return checkImportURL(req.URL)
+	},
+}
+
+var importDialer = &net.Dialer{Timeout: 10 * time.Second}
+
+// reservedNetworks are the non-public ranges net.IP has no predicate for
+var reservedNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{"0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4", "64:ff9b::/96"} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// publicIP tells whether ip is an address of the internet, not of the
+// server, its private network or the cloud metadata service (169.254.169.254)
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkImportURL accepts the http(s) URLs on the standard ports
+func checkImportURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("only http and https URLs are allowed")
+	}
+	if u.Hostname() == "" {
+		return errors.New("the URL has no host")
+	}
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		return errors.New("only ports 80 and 443 are allowed")
+	}
+	return nil
+}
+
+// dialPublicAddress connects to the first address of the host once all of
+// them are known to be public
+func dialPublicAddress(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if port != "80" && port != "443" {
+		return nil, errors.New("only ports 80 and 443 are allowed")
+	}
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("%s has no address", host)
+	}
+	for _, address := range addresses {
+		if !publicIP(address.IP) {
+			return nil, fmt.Errorf("%s is not a public address", host)
+		}
+	}
+	// Connect to the checked address rather than resolving the host again
+	return importDialer.DialContext(ctx, network, net.JoinHostPort(addresses[0].IP.String(), port))
+}
+
+func importProductImage(ctx context.Context, db *gorm.DB, productID uint, imageURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return err
+	}
+	if err := checkImportURL(req.URL); err != nil {
+		return err
+	}
+	resp, err := importHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("download failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed with status %d", resp.StatusCode)
+	}
+
+	// One byte over the limit is enough for imageproc to reject the file
+	body := io.LimitReader(resp.Body, imageproc.MaxUploadSize+1)
+	_, err = storeProductImage(ctx, db, productID, body, productImageAttributes{SourceURL: imageURL})
+	return err
+}
@@ -0,0 +1,414 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"talodu/auth"
+	"talodu/i18n"
+	"talodu/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Customers ask questions on the product page, the shop and other customers
+// answer them. Answers of the shop owner and employees are flagged IsSeller
+// and listed first. Everyone votes on questions and answers, admins hide the
+// inappropriate ones. The shop is notified of new questions and the author of
+// a question of its answers.
+
+// preloadVisibleAnswers orders the visible answers of questions, the seller's first
+func preloadVisibleAnswers(db *gorm.DB) *gorm.DB {
+	return db.Where("status = ?", models.ModerationVisible).Order("is_seller DESC, votes DESC, created_at ASC")
+}
+
+// refreshAnswerCount recounts the visible answers of a question
+func refreshAnswerCount(db *gorm.DB, questionID uint) error {
+	return db.Model(&models.ProductQuestion{}).Where("id = ?", questionID).
+		Update("answer_count", db.Model(&models.ProductAnswer{}).Select("COUNT(*)").
+			Where("question_id = ? AND status = ?", questionID, models.ModerationVisible)).Error
+}
+
+// GET /products/:id/questions?sort=-votes&page=1 - Visible questions of a product with their answers
+func ListProductQuestions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Model(&models.ProductQuestion{}).
+			Preload("Answers", preloadVisibleAnswers).
+			Where("product_id = ? AND status = ?", c.Param("id"), models.ModerationVisible)
+		if c.Query("answered") == "true" {
+			query = query.Where("answer_count > 0")
+		}
+
+		pagination, err := parsePagination(c, 10)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var totalCount int64
+		query.Count(&totalCount)
+
+		keys, err := questionSortRegistry.Parse(c.Query("sort"), "")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query, err = pagination.Apply(query, keys)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var questions []models.ProductQuestion
+		if err := query.Find(&questions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch questions"})
+			return
+		}
+		nextCursor, hasMore := pagination.Finish(&questions, keys)
+
+		response := gin.H{"questions": questions}
+		for key, value := range pagination.Meta(totalCount, nextCursor, hasMore) {
+			response[key] = value
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// POST /products/:id/questions - Ask a question about a product
+func AskProductQuestion(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authUser, err := auth.GetAuthUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
+			return
+		}
+
+		var input struct {
+			Body string `json:"body" binding:"required,max=1000"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if input.Body = strings.TrimSpace(input.Body); len(input.Body) < 3 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The question is too short"})
+			return
+		}
+
+		var product models.Product
+		if err := db.Preload("Shop.Employees").Where("is_visible = ?", true).First(&product, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
+			return
+		}
+
+		question := models.ProductQuestion{
+			ProductID:  product.ID,
+			UserID:     authUser.ID,
+			AuthorName: authUser.Username,
+			Body:       input.Body,
+			Status:     models.ModerationVisible,
+			Answers:    []models.ProductAnswer{},
+		}
+		if err := db.Create(&question).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save question"})
+			return
+		}
+
+		notifyUsers(db, shopManagerIDs(product.Shop), func(lang string) models.Notification {
+			return models.Notification{
+				Type:    models.NotificationProductQuestion,
+				Title:   i18n.Translate(lang, "New question about a product"),
+				Message: i18n.Translate(lang, "%s asked about \"%s\": %s", authUser.Username, product.Name, question.Body),
+				Link:    "/products/ps/" + product.Slug,
+			}
+		})
+
+		c.JSON(http.StatusCreated, question)
+	}
+}
+
+// POST /products/questions/:questionId/answers - Answer a question, as the shop or as a customer who ordered the product
+func AnswerProductQuestion(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authUser, err := auth.GetAuthUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
+			return
+		}
+
+		var input struct {
+			Body string `json:"body" binding:"required,max=2000"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if input.Body = strings.TrimSpace(input.Body); input.Body == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The answer is empty"})
+			return
+		}
+
+		var question models.ProductQuestion
+		if err := db.Where("status = ?", models.ModerationVisible).First(&question, c.Param("questionId")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Question not found")})
+			return
+		}
+		var product models.Product
+		if err := db.Preload("Shop.Employees").First(&product, question.ProductID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
+			return
+		}
+
+		answer := models.ProductAnswer{
+			QuestionID: question.ID,
+			UserID:     authUser.ID,
+			AuthorName: authUser.Username,
+			Body:       input.Body,
+			IsSeller:   product.Shop.OwnerID == authUser.ID || isEmployee(product.Shop.Employees, authUser.ID),
+			Status:     models.ModerationVisible,
+		}
+
+		// Customers answer from experience: they must have ordered the product
+		if !answer.IsSeller {
+			var orders int64
+			if err := db.Model(&models.OrderItem{}).
+				Joins("JOIN orders ON orders.id = order_items.order_id AND orders.deleted_at IS NULL").
+				Where("orders.user_id = ? AND order_items.product_id = ? AND orders.status <> ?", authUser.ID, product.ID, models.OrderStatusCancelled).
+				Count(&orders).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+				return
+			}
+			if orders == 0 {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Only the shop and the customers who ordered the product can answer"})
+				return
+			}
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&answer).Error; err != nil {
+				return err
+			}
+			return refreshAnswerCount(tx, question.ID)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save answer"})
+			return
+		}
+
+		if question.UserID != authUser.ID {
+			answeredBy := authUser.Username
+			if answer.IsSeller {
+				answeredBy = product.Shop.Name
+			}
+			notifyUsers(db, []uint{question.UserID}, func(lang string) models.Notification {
+				return models.Notification{
+					Type:    models.NotificationQuestionAnswered,
+					Title:   i18n.Translate(lang, "Your question was answered"),
+					Message: i18n.Translate(lang, "%s answered your question about \"%s\": %s", answeredBy, product.Name, answer.Body),
+					Link:    "/products/ps/" + product.Slug,
+				}
+			})
+		}
+
+		c.JSON(http.StatusCreated, answer)
+	}
+}
+
+// voteQA records the vote of the user on a question or an answer and
+// recounts its votes. A value of 0 withdraws the vote.
+func voteQA(c *gin.Context, db *gorm.DB, targetType string, target interface{}, targetID, authorID uint) {
+	authUser, err := auth.GetAuthUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
+		return
+	}
+	var input struct {
+		Value *int `json:"value" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || *input.Value < -1 || *input.Value > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "value must be 1, -1 or 0"})
+		return
+	}
+	if authorID == authUser.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can't vote on your own " + targetType})
+		return
+	}
+
+	var votes int
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND target_type = ? AND target_id = ?", authUser.ID, targetType, targetID).
+			Delete(&models.QAVote{}).Error; err != nil {
+			return err
+		}
+		if *input.Value != 0 {
+			if err := tx.Create(&models.QAVote{UserID: authUser.ID, TargetType: targetType, TargetID: targetID, Value: *input.Value}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(target).Update("votes", tx.Model(&models.QAVote{}).Select("COALESCE(SUM(value), 0)").
+			Where("target_type = ? AND target_id = ?", targetType, targetID)).Error; err != nil {
+			return err
+		}
+		return tx.Model(target).Where("id = ?", targetID).Select("votes").Row().Scan(&votes)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save vote"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vote saved", "votes": votes, "your_vote": *input.Value})
+}
+
+// POST /products/questions/:questionId/vote - Vote on a question: {"value": 1}, -1, or 0 to withdraw
+func VoteProductQuestion(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var question models.ProductQuestion
+		if err := db.Where("status = ?", models.ModerationVisible).First(&question, c.Param("questionId")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Question not found")})
+			return
+		}
+		voteQA(c, db, "question", &question, question.ID, question.UserID)
+	}
+}
+
+// POST /products/answers/:answerId/vote - Vote on an answer: {"value": 1}, -1, or 0 to withdraw
+func VoteProductAnswer(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var answer models.ProductAnswer
+		if err := db.Where("status = ?", models.ModerationVisible).First(&answer, c.Param("answerId")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Answer not found")})
+			return
+		}
+		voteQA(c, db, "answer", &answer, answer.ID, answer.UserID)
+	}
+}
+
+// moderationInput is the body of the moderation endpoints
+type moderationInput struct {
+	Status models.ModerationStatus `json:"status" binding:"required,oneof=visible hidden"`
+	Reason string                  `json:"reason" binding:"max=500"`
+}
+
+// PUT /products/questions/:questionId/moderation - Hide or show a question (admins)
+func ModerateProductQuestion(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input moderationInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var question models.ProductQuestion
+		if err := db.First(&question, c.Param("questionId")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Question not found")})
+			return
+		}
+		if err := db.Model(&question).Updates(map[string]interface{}{
+			"status":            input.Status,
+			"moderation_reason": input.Reason,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to moderate question"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Question moderated", "question": question})
+	}
+}
+
+// PUT /products/answers/:answerId/moderation - Hide or show an answer (admins)
+func ModerateProductAnswer(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input moderationInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var answer models.ProductAnswer
+		if err := db.First(&answer, c.Param("answerId")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Answer not found")})
+			return
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&answer).Updates(map[string]interface{}{
+				"status":            input.Status,
+				"moderation_reason": input.Reason,
+			}).Error; err != nil {
+				return err
+			}
+			return refreshAnswerCount(tx, answer.QuestionID)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to moderate answer"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Answer moderated", "answer": answer})
+	}
+}
+
+// DELETE /products/questions/:questionId - Delete a question and its answers (author or admins)
+func DeleteProductQuestion(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authUser, err := auth.GetAuthUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
+			return
+		}
+
+		var question models.ProductQuestion
+		if err := db.First(&question, c.Param("questionId")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Question not found")})
+			return
+		}
+		if question.UserID != authUser.ID && !auth.IsAdminOrIsSuperAdmin(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.T(c, "Operation not permitted")})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("question_id = ?", question.ID).Delete(&models.ProductAnswer{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&question).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete question"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Question deleted"})
+	}
+}
+
+// DELETE /products/answers/:answerId - Delete an answer (author or admins)
+func DeleteProductAnswer(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authUser, err := auth.GetAuthUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
+			return
+		}
+
+		var answer models.ProductAnswer
+		if err := db.First(&answer, c.Param("answerId")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Answer not found")})
+			return
+		}
+		if answer.UserID != authUser.ID && !auth.IsAdminOrIsSuperAdmin(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.T(c, "Operation not permitted")})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(&answer).Error; err != nil {
+				return err
+			}
+			return refreshAnswerCount(tx, answer.QuestionID)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete answer"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Answer deleted"})
+	}
+}
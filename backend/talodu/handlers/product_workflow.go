@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"talodu/auth"
+	"talodu/i18n"
+	"talodu/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Products go through draft -> pending_review -> published -> archived.
+// Shops submit their drafts, admins approve or reject them, and approved
+// products go live at their publish_at date, or right away without one.
+// The scheduled publications and archivings are applied by the
+// "product-schedule" job, see jobs.ApplyProductSchedules. IsVisible stays
+// the flag every catalogue query filters on: it is only set on live products.
+
+// loadManagedProduct loads the product of the :id parameter with its shop
+// and checks the user can manage it, writing the error response otherwise
+func loadManagedProduct(c *gin.Context, db *gorm.DB) (*models.Product, *auth.AuthUser, bool) {
+	authUser, err := auth.GetAuthUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
+		return nil, nil, false
+	}
+
+	var product models.Product
+	if err := db.Preload("Shop.Employees").First(&product, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
+		return nil, nil, false
+	}
+	if !canManageShopProducts(authUser, product.Shop) {
+		c.JSON(http.StatusForbidden, gin.H{"error": i18n.T(c, "Operation not permitted")})
+		return nil, nil, false
+	}
+	return &product, authUser, true
+}
+
+// transitionProduct moves the product to status with the extra column
+// updates. The update only applies if nobody changed the status meanwhile.
+func transitionProduct(c *gin.Context, db *gorm.DB, product *models.Product, status models.ProductStatus, updates map[string]interface{}) bool {
+	if !product.CanTransitionTo(status) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("A %s product can't become %s", product.Status, status)})
+		return false
+	}
+
+	updates["status"] = status
+	if _, ok := updates["is_visible"]; !ok {
+		updates["is_visible"] = models.IsLive(status, product.PublishAt, time.Now())
+	}
+	result := db.Model(&models.Product{}).
+		Where("id = ? AND status = ?", product.ID, product.Status).
+		Updates(updates)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product status"})
+		return false
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "The product status changed, reload it and try again"})
+		return false
+	}
+
+	if err := db.First(product, product.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch updated product"})
+		return false
+	}
+	return true
+}
+
+// initialProductStatus is the status of the products created by the user:
+// admins publish directly, shops start with a draft
+func initialProductStatus(c *gin.Context) models.ProductStatus {
+	if auth.IsAdminOrIsSuperAdmin(c) {
+		return models.ProductStatusPublished
+	}
+	return models.ProductStatusDraft
+}
+
+// POST /products/:id/submit - Submit a draft for review
+func SubmitProduct(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		product, authUser, ok := loadManagedProduct(c, db)
+		if !ok {
+			return
+		}
+
+		if !transitionProduct(c, db, product, models.ProductStatusPendingReview, map[string]interface{}{
+			"submitted_by_id":  authUser.ID,
+			"rejection_reason": "",
+		}) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Product submitted for review", "product": product})
+	}
+}
+
+// POST /products/:id/approve - Publish a product waiting for review, at its publish_at date if any
+func ApproveProduct(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authUser, err := auth.GetAuthUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
+			return
+		}
+
+		var product models.Product
+		if err := db.Preload("Shop.Employees").First(&product, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
+			return
+		}
+		if product.Status != models.ProductStatusPendingReview {
+			c.JSON(http.StatusConflict, gin.H{"error": "Only products waiting for review can be approved"})
+			return
+		}
+
+		now := time.Now()
+		updates := map[string]interface{}{
+			"reviewed_by_id":   authUser.ID,
+			"reviewed_at":      now,
+			"rejection_reason": "",
+		}
+		if product.PublishAt != nil && !product.PublishAt.After(now) {
+			// The publication date is past, the product goes live now
+			updates["publish_at"] = nil
+			product.PublishAt = nil
+		}
+		shop := product.Shop
+		if !transitionProduct(c, db, &product, models.ProductStatusPublished, updates) {
+			return
+		}
+
+		notifyUsers(db, append(shopManagerIDs(shop), derefUint(product.SubmittedByID)), func(lang string) models.Notification {
+			message := i18n.Translate(lang, "Your product \"%s\" was approved and is now published.", product.Name)
+			if product.PublishAt != nil {
+				message = i18n.Translate(lang, "Your product \"%s\" was approved and will be published on %s.", product.Name, product.PublishAt.Format("2006-01-02 15:04 MST"))
+			}
+			return models.Notification{
+				Type:    models.NotificationProductApproved,
+				Title:   i18n.Translate(lang, "Product approved"),
+				Message: message,
+				Link:    "/products/ps/" + product.Slug,
+			}
+		})
+
+		c.JSON(http.StatusOK, gin.H{"message": "Product approved", "product": product})
+	}
+}
+
+// POST /products/:id/reject - Send a product waiting for review back to draft, with the reason
+func RejectProduct(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authUser, err := auth.GetAuthUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
+			return
+		}
+
+		var input struct {
+			Reason string `json:"reason" binding:"required,max=1000"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A rejection reason is required"})
+			return
+		}
+
+		var product models.Product
+		if err := db.Preload("Shop.Employees").First(&product, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
+			return
+		}
+		if product.Status != models.ProductStatusPendingReview {
+			c.JSON(http.StatusConflict, gin.H{"error": "Only products waiting for review can be rejected"})
+			return
+		}
+
+		shop := product.Shop
+		if !transitionProduct(c, db, &product, models.ProductStatusDraft, map[string]interface{}{
+			"reviewed_by_id":   authUser.ID,
+			"reviewed_at":      time.Now(),
+			"rejection_reason": input.Reason,
+		}) {
+			return
+		}
+
+		notifyUsers(db, append(shopManagerIDs(shop), derefUint(product.SubmittedByID)), func(lang string) models.Notification {
+			return models.Notification{
+				Type:    models.NotificationProductRejected,
+				Title:   i18n.Translate(lang, "Product rejected"),
+				Message: i18n.Translate(lang, "Your product \"%s\" was not approved: %s", product.Name, input.Reason),
+				Link:    fmt.Sprintf("/products/%d", product.ID),
+			}
+		})
+
+		c.JSON(http.StatusOK, gin.H{"message": "Product rejected", "product": product})
+	}
+}
+
+// POST /products/:id/archive - Withdraw a published product from the catalogue
+func ArchiveProduct(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		product, _, ok := loadManagedProduct(c, db)
+		if !ok {
+			return
+		}
+
+		if !transitionProduct(c, db, product, models.ProductStatusArchived, map[string]interface{}{
+			"publish_at":   nil,
+			"unpublish_at": nil,
+		}) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Product archived", "product": product})
+	}
+}
+
+// POST /products/:id/draft - Take a published or archived product back to draft to rework it
+func ReturnProductToDraft(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		product, _, ok := loadManagedProduct(c, db)
+		if !ok {
+			return
+		}
+		if product.Status == models.ProductStatusPendingReview && !auth.IsAdminOrIsSuperAdmin(c) {
+			// Shops can't withdraw a product from review, admins reject it
+			c.JSON(http.StatusConflict, gin.H{"error": "The product is waiting for review"})
+			return
+		}
+
+		if !transitionProduct(c, db, product, models.ProductStatusDraft, map[string]interface{}{}) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Product returned to draft", "product": product})
+	}
+}
+
+// PUT /products/:id/schedule - Set or clear the publish_at and unpublish_at dates
+func ScheduleProduct(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			PublishAt   *time.Time `json:"publish_at"`
+			UnpublishAt *time.Time `json:"unpublish_at"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		product, _, ok := loadManagedProduct(c, db)
+		if !ok {
+			return
+		}
+		if product.Status == models.ProductStatusArchived {
+			c.JSON(http.StatusConflict, gin.H{"error": "An archived product can't be scheduled, return it to draft first"})
+			return
+		}
+
+		now := time.Now()
+		if input.UnpublishAt != nil {
+			if !input.UnpublishAt.After(now) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unpublish_at must be in the future"})
+				return
+			}
+			if input.PublishAt != nil && !input.UnpublishAt.After(*input.PublishAt) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unpublish_at must be after publish_at"})
+				return
+			}
+		}
+		if input.PublishAt != nil && !input.PublishAt.After(now) && product.Status == models.ProductStatusPublished {
+			// A past date on a published product means now, the job would clear it anyway
+			input.PublishAt = nil
+		}
+
+		updates := map[string]interface{}{
+			"publish_at":   input.PublishAt,
+			"unpublish_at": input.UnpublishAt,
+		}
+		if product.Status == models.ProductStatusPublished {
+			updates["is_visible"] = models.IsLive(product.Status, input.PublishAt, now)
+		}
+		if err := db.Model(product).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update the schedule"})
+			return
+		}
+		if err := db.First(product, product.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch updated product"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Schedule updated", "product": product})
+	}
+}
+
+func derefUint(value *uint) uint {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
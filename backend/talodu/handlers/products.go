@@ -1,18 +1,19 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"log"
-	"math"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"talodu/auth"
+	"talodu/i18n"
+	"talodu/imageproc"
 	"talodu/models"
-
-	"github.com/google/uuid"
+	"talodu/money"
+	"talodu/settings"
+	"talodu/storage"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -22,19 +23,33 @@ type Product = models.Product
 type ProductImage = models.ProductImage
 type ProductTranslation = models.ProductTranslation
 
-// GET /products/featured
+// localizeProducts translates the products and what's loaded with them in
+// lang, following its fallback chain, see models.Product.Localize
+func localizeProducts(products []models.Product, lang string) {
+	for i := range products {
+		products[i].Localize(lang)
+	}
+}
+
+// GET /products/featured - The products flagged as featured, as many as the
+// display settings show unless ?limit= is given. Merchandising slots with
+// their own scheduling and ordering are served by GET /collections/:slug.
 func GetFeaturedProducts(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var products []models.Product
-		lang := strings.ToLower(strings.TrimSpace(c.Query("lang")))
-		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "8"))
+		lang := i18n.Language(c)
+		limit, err := strconv.Atoi(c.Query("limit"))
+		if err != nil || limit <= 0 {
+			limit = settings.LoadDisplaySettings(db).FeaturedProductsCount
+		}
+		if limit <= 0 {
+			limit = defaultCollectionProductCount
+		}
 
 		query := db.
 			//Preload("Images", "is_visible = ?", true).
-			Preload("Images", func(db *gorm.DB) *gorm.DB {
-				return db.Select("id", "created_at", "updated_at", "deleted_at", "product_id", "url", "alt_text", "is_primary", "is_visible").
-					Order("is_primary DESC, created_at ASC").Where("is_visible = ?", true)
-			}).
+			Preload("Images", preloadProductImages(true)).
+			Preload("Images.Translations").
 			Preload("Translations").
 			Preload("Shop", func(db *gorm.DB) *gorm.DB {
 				return db.Select("id", "name")
@@ -50,17 +65,10 @@ func GetFeaturedProducts(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Apply translations if language is specified
-		if lang != "" {
-			for i := range products {
-				for _, t := range products[i].Translations {
-					if t.Language == lang {
-						products[i].Name = t.Name
-						products[i].Description = t.Description
-						break
-					}
-				}
-			}
+		localizeProducts(products, lang)
+		prices, ok := newPriceConverter(c, db)
+		if !ok || !prices.products(c, products) {
+			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
@@ -87,7 +95,7 @@ func ToggleFeaturedProduct(db *gorm.DB) gin.HandlerFunc {
 
 		var product models.Product
 		if err := db.First(&product, productID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
 			return
 		}
 
@@ -120,66 +128,21 @@ func ToggleFeaturedProduct(db *gorm.DB) gin.HandlerFunc {
 func GetRelatedProducts(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		productID := c.Param("id")
-		lang := strings.ToLower(strings.TrimSpace(c.Query("lang")))
 		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "8"))
 
-		// Get current product and its categories
 		var currentProduct models.Product
-		if err := db.Preload("Categories").First(&currentProduct, productID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		if err := db.Select("id").First(&currentProduct, productID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
 			return
 		}
 
-		// Extract category IDs
-		var categoryIDs []uint
-		for _, category := range currentProduct.Categories {
-			categoryIDs = append(categoryIDs, category.ID)
-		}
-
-		if len(categoryIDs) == 0 {
-			c.JSON(http.StatusOK, gin.H{"products": []models.Product{}})
-			return
-		}
-
-		// Find products that share the same categories, excluding current product
-		var relatedProducts []models.Product
-		query := db.
-			Preload("Images").
-			Preload("Translations").
-			Preload("Shop", func(db *gorm.DB) *gorm.DB {
-				return db.Select("id", "name")
-			}).
-			Joins("JOIN product_categories pc ON products.id = pc.product_id").
-			Where("pc.category_id IN (?)", categoryIDs).
-			Where("products.id != ?", productID).
-			Where("products.is_visible = ?", true).
-			Where("products.deleted_at IS NULL").
-			Group("products.id").
-			Order("COUNT(pc.category_id) DESC, products.created_at DESC").
-			Limit(limit)
-
-		if err := query.Find(&relatedProducts).Error; err != nil {
+		// Products that share the most categories, excluding current product
+		ids, err := sameCategoryProductIDs(db, []uint{currentProduct.ID}, []uint{currentProduct.ID}, limit)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch related products"})
 			return
 		}
-
-		// Apply translations if language is specified
-		if lang != "" {
-			for i := range relatedProducts {
-				for _, t := range relatedProducts[i].Translations {
-					if t.Language == lang {
-						relatedProducts[i].Name = t.Name
-						relatedProducts[i].Description = t.Description
-						break
-					}
-				}
-			}
-		}
-
-		c.JSON(http.StatusOK, gin.H{
-			"products": relatedProducts,
-			"count":    len(relatedProducts),
-		})
+		respondWithProducts(c, db, ids, nil)
 	}
 }
 
@@ -188,98 +151,77 @@ func ListProducts(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var _ = models.Product{}
 		var products []models.Product
-		lang := strings.ToLower(strings.TrimSpace(c.Query("lang")))
+		lang := i18n.Language(c)
 
 		//query := db.Model(&models.Product{})
 		query := db.Model(&models.Product{}).
 			Preload("Translations").
-			Preload("Images", "is_visible = ?", true). // Only visible images).
+			Preload("Images", preloadProductImages(true)). // Only visible images, in gallery order
+			Preload("Images.Translations").
 			Preload("Shop", func(db *gorm.DB) *gorm.DB {
 				return db.Select("id", "name") // Only load specific shop fields
 
 			}).Where("is_visible = ?", true) // Only show visible products
 
-		if search := c.Query("search"); search != "" {
-			search = strings.TrimSpace(search)
-
-			if len(search) < 5 {
-				// Use trigram-optimized ILIKE for short searches
-				query = query.Where(
-					"name ILIKE ? OR description ILIKE ?",
-					"%"+search+"%", "%"+search+"%",
-				)
-			} else {
-				// Use FTS with OR logic for longer queries
-				//index is added to db for fts to work
-				//CREATE EXTENSION IF NOT EXISTS pg_trgm;
-				//CREATE INDEX idx_products_name_trgm ON products USING gin(name gin_trgm_ops);
-				//CREATE INDEX idx_products_description_trgm ON products USING gin(description gin_trgm_ops);
-				//terms := strings.Join(strings.Fields(search), " | ") // Changed from " & " to " | "
-				terms := strings.Join(strings.Fields(search), " & ") // Changed from " & " to " | "
-				query = query.Where(
-					"to_tsvector('french', coalesce(name,'') || ' ' || coalesce(description,'')) @@ to_tsquery('french', ?)",
-					terms,
-				)
-			}
-		}
+		// Search with synonyms and stop words of the requested language
+		query = applyProductSearch(db, query, c.Query("search"), lang)
 
-		// Minimum price (e.g., ?min_price=50)
-		if minPrice := c.Query("min_price"); minPrice != "" {
-			query = query.Where("price >= ?", minPrice)
+		// Price range (e.g., ?min_price=50&max_price=500) in the requested currency
+		prices, ok := newPriceConverter(c, db)
+		if !ok {
+			return
 		}
-		// Maximum price (e.g., ?max_price=500)
-		if maxPrice := c.Query("max_price"); maxPrice != "" {
-			query = query.Where("price <= ?", maxPrice)
+		query = prices.priceFilter(c, query)
+		// Category (e.g., ?category_id=3)
+		if categoryID := c.Query("category_id"); categoryID != "" {
+			query = query.Where("products.id IN (SELECT product_id FROM product_categories WHERE category_id = ?)", categoryID)
+		}
+		// Attributes (e.g., ?attr[ram]=8GB,16GB&attr[screen_size]=6..7)
+		query, err := applyAttributeFilters(query, c.QueryMap("attr"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		//  Pagination (page numbers or keyset cursor)
+		pagination, err := parsePagination(c, 5)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 
 		// Get TOTAL COUNT (before pagination)
 		var totalCount int64
 		query.Count(&totalCount) // Critical: Count before .Offset()
 
-		// 2. Sorting (e.g., ?sort=price or ?sort=-price for DESC)
-		if sort := c.Query("sort"); sort != "" {
-			if sort[0] == '-' {
-				query = query.Order(sort[1:] + " DESC")
-			} else {
-				query = query.Order(sort)
-			}
-		} else {
-			//query = query.Order("id") // Default sort
-			query = query.Order("created_at DESC")
+		// 2. Sorting (e.g., ?sort=price, ?sort=-price for DESC or ?sort=-rating,price)
+		keys, err := productSortRegistry.Parse(c.Query("sort"), lang)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
-
-		//  Pagination
-		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "5"))
-		offset := (page - 1) * limit
+		keys = prices.sortKeys(keys)
 
 		// Execute query
-		query.Offset(offset).Limit(limit).Find(&products)
-
-		// Apply translations to each product if language is specified
-		if lang != "" {
-			for i := range products {
-				for _, t := range products[i].Translations {
-					if t.Language == lang {
-						products[i].Name = t.Name
-						products[i].Description = t.Description
-						break
-					}
-				}
-			}
+		query, err = pagination.Apply(query, keys)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
+		query.Find(&products)
+		nextCursor, hasMore := pagination.Finish(&products, keys)
 
-		//  Calculate total pages
-		totalPages := int(math.Ceil(float64(totalCount) / float64(limit)))
+		localizeProducts(products, lang)
+		if !prices.products(c, products) {
+			return
+		}
 
 		// Return response
-		c.JSON(http.StatusOK, gin.H{
-			"products":   products,
-			"page":       page,
-			"limit":      limit,
-			"totalItems": totalCount,
-			"totalPages": totalPages,
-		})
+		response := gin.H{"products": products}
+		for key, value := range pagination.Meta(totalCount, nextCursor, hasMore) {
+			response[key] = value
+		}
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -288,94 +230,68 @@ func ListProductsAdmin(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var _ = models.Product{}
 		var products []models.Product
-		lang := strings.ToLower(strings.TrimSpace(c.Query("lang")))
+		lang := i18n.QueryLanguage(c) // The source text unless a translation is requested
 
 		//query := db.Model(&models.Product{})
-		query := db.Model(&models.Product{}).Preload("Translations").Preload("Images").Preload("Shop", func(db *gorm.DB) *gorm.DB {
+		query := db.Model(&models.Product{}).Preload("Translations").Preload("Images", preloadProductImages(false)).Preload("Images.Translations").Preload("Shop", func(db *gorm.DB) *gorm.DB {
 			return db.Select("id", "name") // Only load specific shop fields
 		})
 
-		if search := c.Query("search"); search != "" {
-			search = strings.TrimSpace(search)
-
-			if len(search) < 5 {
-				// Use trigram-optimized ILIKE for short searches
-				query = query.Where(
-					"name ILIKE ? OR description ILIKE ?",
-					"%"+search+"%", "%"+search+"%",
-				)
-			} else {
-				// Use FTS with OR logic for longer queries
-				//index is added to db for fts to work
-				//CREATE EXTENSION IF NOT EXISTS pg_trgm;
-				//CREATE INDEX idx_products_name_trgm ON products USING gin(name gin_trgm_ops);
-				//CREATE INDEX idx_products_description_trgm ON products USING gin(description gin_trgm_ops);
-				//terms := strings.Join(strings.Fields(search), " | ") // Changed from " & " to " | "
-				terms := strings.Join(strings.Fields(search), " & ") // Changed from " & " to " | "
-				query = query.Where(
-					"to_tsvector('french', coalesce(name,'') || ' ' || coalesce(description,'')) @@ to_tsquery('french', ?)",
-					terms,
-				)
-			}
-		}
+		// Search with synonyms and stop words of the requested language, or by SKU and barcode
+		query = applyProductIdentifierSearch(db, query, c.Query("search"), lang)
 
-		// Minimum price (e.g., ?min_price=50)
-		if minPrice := c.Query("min_price"); minPrice != "" {
-			query = query.Where("price >= ?", minPrice)
+		// Price range (e.g., ?min_price=50&max_price=500) in the requested currency
+		prices, ok := newPriceConverter(c, db)
+		if !ok {
+			return
 		}
-		// Maximum price (e.g., ?max_price=500)
-		if maxPrice := c.Query("max_price"); maxPrice != "" {
-			query = query.Where("price <= ?", maxPrice)
+		query = prices.priceFilter(c, query)
+		// Lifecycle status (e.g., ?status=pending_review for the review queue)
+		if status := c.Query("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+
+		//  Pagination (page numbers or keyset cursor)
+		pagination, err := parsePagination(c, 5)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 
 		// Get TOTAL COUNT (before pagination)
 		var totalCount int64
 		query.Count(&totalCount) // Critical: Count before .Offset()
 
-		// 2. Sorting (e.g., ?sort=price or ?sort=-price for DESC)
-		if sort := c.Query("sort"); sort != "" {
-			if sort[0] == '-' {
-				query = query.Order(sort[1:] + " DESC")
-			} else {
-				query = query.Order(sort)
-			}
-		} else {
-			//query = query.Order("id") // Default sort
-			query = query.Order("created_at DESC")
+		// 2. Sorting (e.g., ?sort=price, ?sort=-price for DESC or ?sort=-rating,price)
+		keys, err := productSortRegistry.Parse(c.Query("sort"), lang)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
-
-		//  Pagination
-		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "5"))
-		offset := (page - 1) * limit
+		keys = prices.sortKeys(keys)
 
 		// Execute query
-		query.Offset(offset).Limit(limit).Find(&products)
-
-		// Apply translations to each product if language is specified
-		if lang != "" {
-			for i := range products {
-				for _, t := range products[i].Translations {
-					if t.Language == lang {
-						products[i].Name = t.Name
-						products[i].Description = t.Description
-						break
-					}
-				}
-			}
+		query, err = pagination.Apply(query, keys)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
+		query.Find(&products)
+		nextCursor, hasMore := pagination.Finish(&products, keys)
 
-		//  Calculate total pages
-		totalPages := int(math.Ceil(float64(totalCount) / float64(limit)))
+		for i := range products {
+			products[i].LocalizeWithDrafts(lang) // Drafts are reviewed from here
+		}
+		if !prices.products(c, products) {
+			return
+		}
 
 		// Return response
-		c.JSON(http.StatusOK, gin.H{
-			"products":   products,
-			"page":       page,
-			"limit":      limit,
-			"totalItems": totalCount,
-			"totalPages": totalPages,
-		})
+		response := gin.H{"products": products}
+		for key, value := range pagination.Meta(totalCount, nextCursor, hasMore) {
+			response[key] = value
+		}
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -393,14 +309,34 @@ func ToggleProductVisibility(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		authUser, err := auth.GetAuthUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
+			return
+		}
+
 		var product models.Product
-		if err := db.First(&product, productID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		if err := db.Preload("Shop.Employees").First(&product, productID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
+			return
+		}
+		if !canManageShopProducts(authUser, product.Shop) {
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.T(c, "Operation not permitted")})
 			return
 		}
 
+		// Showing a product is publishing it, which goes through review
+		updates := map[string]interface{}{"is_visible": input.IsVisible}
+		if input.IsVisible {
+			if product.Status != models.ProductStatusPublished {
+				c.JSON(http.StatusConflict, gin.H{"error": "Only published products can be made visible"})
+				return
+			}
+			updates["publish_at"] = nil
+		}
+
 		// Update visibility
-		if err := db.Model(&product).Update("is_visible", input.IsVisible).Error; err != nil {
+		if err := db.Model(&product).Updates(updates).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update visibility"})
 			return
 		}
@@ -429,7 +365,7 @@ func GetShopProducts(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		query := db.
-			Preload("Images").
+			Preload("Images", preloadProductImages(false)).
 			Preload("Categories").
 			Where("shop_id = ?", shopID).
 			Where("is_visible = ?", true).
@@ -489,7 +425,7 @@ func CreateProductTranslation(db *gorm.DB) gin.HandlerFunc {
 		// Verify product exists
 		var product models.Product
 		if err := db.First(&product, productID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
 			return
 		}
 
@@ -522,9 +458,11 @@ func CreateProductTranslation(db *gorm.DB) gin.HandlerFunc {
 		} else {
 			// If record found, update its fields
 			// Check if there are actual changes to avoid unnecessary updates
-			if existingTranslation.Name != input.Name || existingTranslation.Description != input.Description {
+			// Saving a machine translation draft approves it
+			if existingTranslation.Name != input.Name || existingTranslation.Description != input.Description || existingTranslation.Draft {
 				existingTranslation.Name = input.Name
 				existingTranslation.Description = input.Description
+				existingTranslation.Draft = false
 				if err := db.Save(&existingTranslation).Error; err != nil {
 					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update translation"})
 					return
@@ -553,29 +491,18 @@ func GetAdminProduct(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var product models.Product
 		id := c.Param("id")
-		lang := strings.ToLower(strings.TrimSpace(c.Query("lang")))
+		lang := i18n.QueryLanguage(c) // The source text unless a translation is requested, for the edit form
 
 		log.Printf("Processing request for product ID: %s, language: %s", id, lang)
 
-		if err := db.Preload("Images", func(db *gorm.DB) *gorm.DB {
-			return db.Select("id", "created_at", "updated_at", "deleted_at", "product_id", "url", "alt_text", "is_primary", "is_visible").
-				Order("is_primary DESC, created_at ASC")
-		}).Preload("Translations").Preload("Categories").First(&product, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		if err := db.Preload("Images", preloadProductImages(false)).Preload("Images.Translations").Preload("Translations").Preload("Categories").First(&product, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
 			return
 		}
 
-		// Apply translation if available
-		if lang != "" {
-			for _, t := range product.Translations {
-				if t.Language == lang {
-					product.Name = t.Name
-					product.Description = t.Description
-					break
-				}
-			}
-		} else {
-			log.Printf("No language for for product ID: %s, language: %s", id, lang)
+		if err := loadBundleComponents(db, &product); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bundle components"})
+			return
 		}
 
 		// Fetch and return the fully updated product
@@ -586,59 +513,59 @@ func GetAdminProduct(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 		product.Shop = shop
-		db.Save(&product)
+
+		// The staff of the shop opening the product to edit it aren't
+		// customers, they review the draft translations
+		authUser, err := auth.GetAuthUser(c)
+		staff := err == nil && canManageShopProducts(authUser, shop)
+		if staff {
+			product.LocalizeWithDrafts(lang)
+		} else {
+			product.Localize(lang)
+			recordProductView(c, db, product.ID)
+		}
+		prices, ok := newPriceConverter(c, db)
+		if !ok || !prices.product(c, &product) {
+			return
+		}
+
+		attributes, err := loadProductAttributes(db, product.ID, lang)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attributes"})
+			return
+		}
+		product.Attributes = attributes
 
 		// get product abouts with translations
 		var abouts []models.ProductAbout
 
-		if err := db.Preload("Translations").Where("product_id = ?", id).Order("item_order").Find(&abouts).Error; err != nil {
+		translations := func(db *gorm.DB) *gorm.DB {
+			if staff {
+				return db
+			}
+			return db.Where("draft = ?", false) // Customers only see reviewed translations
+		}
+		if err := db.Preload("Translations", translations).Where("product_id = ?", id).Order("item_order").Find(&abouts).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch abouts"})
 			return
 		}
 
-		//product.Abouts = abouts
-
-		// Convert to response format with translations
-		aboutResponses := make([]models.ProductAboutResponse, len(abouts))
-
+		translatedAbouts := make([]models.ProductAbout, len(abouts))
 		for i, about := range abouts {
-			aboutText := "Not translated" // Default empty if no translation found
-
-			if lang != "" {
-				// Find translation for this language
-				var translation models.ProductAboutTranslation
-				if err := db.Where("product_about_id = ? AND language = ?", about.ID, lang).
-					First(&translation).Error; err == nil {
-					aboutText = translation.AboutText
-				} else {
-					aboutText = about.AboutText
-				}
+			if staff {
+				about.LocalizeWithDrafts(lang)
+			} else {
+				about.Localize(lang)
 			}
-			aboutResponses[i] = models.ProductAboutResponse{
+			translatedAbouts[i] = models.ProductAbout{
 				ID:        about.ID,
-				ProductID: about.ProductID,
 				ItemOrder: about.ItemOrder,
-				AboutText: aboutText,
+				AboutText: about.AboutText,
 				CreatedAt: about.CreatedAt,
 				UpdatedAt: about.UpdatedAt,
 			}
-
-		}
-
-		translatedAbouts := make([]models.ProductAbout, len(abouts))
-
-		for i, a2 := range aboutResponses {
-			translatedAbouts[i] = models.ProductAbout{
-				ID:        a2.ID,
-				ItemOrder: a2.ItemOrder,
-				AboutText: a2.AboutText,
-				CreatedAt: a2.CreatedAt,
-				UpdatedAt: a2.UpdatedAt,
-				//Translations: abouts.translations,
-			}
 		}
 
-		//product.AboutsT = aboutResponses
 		product.Abouts = translatedAbouts
 		product.AboutsWithTranlations = abouts
 
@@ -656,9 +583,14 @@ func CreateProduct(db *gorm.DB) gin.HandlerFunc {
 		var input struct {
 			Name        string  `json:"name"`
 			Description string  `json:"description"`
-			Price       float64 `json:"price"`
+			Price       float64 `json:"price"` // In the shop currency
 			Stock       int     `json:"stock"`
 			ShopID      uint    `json:"shop_id" binding:"required"`
+			SKU         string  `json:"sku" binding:"max=64"`
+			GTIN        string  `json:"gtin"`
+			CategoryIDs []uint  `json:"category_ids"`
+			// Values of the attributes of the categories
+			Attributes []productAttributeInput `json:"attributes"`
 		}
 
 		if err := c.ShouldBindJSON(&input); err != nil {
@@ -669,22 +601,67 @@ func CreateProduct(db *gorm.DB) gin.HandlerFunc {
 		// Verify shop exists and user has access
 		var shop models.Shop
 		if err := db.Preload("Owner").Preload("Employees").First(&shop, input.ShopID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Shop not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Shop not found")})
+			return
+		}
+
+		sku := strings.TrimSpace(input.SKU)
+		gtin, err := normalizeProductGTIN(input.GTIN)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if taken, err := skuTaken(db, shop.ID, 0, sku); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check the SKU"})
+			return
+		} else if taken {
+			c.JSON(http.StatusConflict, gin.H{"error": "A product with this SKU already exists in the shop"})
+			return
+		}
+
+		var categories []models.Category
+		if len(input.CategoryIDs) > 0 {
+			if err := db.Find(&categories, input.CategoryIDs).Error; err != nil || len(categories) != len(input.CategoryIDs) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown category in category_ids"})
+				return
+			}
+		}
+		attributes, err := validateProductAttributes(db, input.CategoryIDs, input.Attributes)
+		var validationErr *attributeValidationError
+		if errors.As(err, &validationErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check the attributes"})
 			return
 		}
 
 		product := models.Product{
 			Name:        input.Name,
-			Price:       input.Price,
+			Price:       money.FromMajor(input.Price, shopCurrency(db, shop.ID)),
 			Description: input.Description,
 			Stock:       input.Stock,
 			ShopID:      input.ShopID,
+			SKU:         sku,
+			GTIN:        gtin,
+			Status:      initialProductStatus(c),
 		}
 		//product.Slug = generateSlug(input.Name) + "-" + productID
 		product.Slug = generateSlug(input.Name) + "-"
 
 		//db.Create(&product)
-		if err := db.Create(&product).Error; err != nil {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&product).Error; err != nil {
+				return err
+			}
+			if len(categories) > 0 {
+				if err := tx.Model(&product).Association("Categories").Append(categories); err != nil {
+					return err
+				}
+			}
+			return saveProductAttributes(tx, product.ID, attributes)
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
 			return
 		}
@@ -697,6 +674,11 @@ func CreateProduct(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		createdProduct.Shop = shop
+		createdProduct.Categories = categories
+		if createdProduct.Attributes, err = loadProductAttributes(db, product.ID, ""); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch created product"})
+			return
+		}
 
 		c.JSON(http.StatusCreated, createdProduct)
 	}
@@ -718,11 +700,21 @@ func DeleteProduct(db *gorm.DB) gin.HandlerFunc {
 		id := c.Param("id")
 
 		if err := db.First(&product, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
 			return
 		}
 
-		db.Delete(&product)
+		// Images are soft-deleted with the product, their files are collected by the uploads garbage collection
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("product_id = ?", product.ID).Delete(&ProductImage{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&product).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Delete failed"})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{"message": "Product deleted"})
 	}
 }
@@ -735,13 +727,17 @@ func UpdateProduct(db *gorm.DB) gin.HandlerFunc {
 		// Request payload structure
 		var request struct {
 			Name        string  `json:"name" binding:"required"`
-			Price       float64 `json:"price" binding:"required"`
+			Price       float64 `json:"price" binding:"required"` // In the product currency
 			Stock       int     `json:"stock" binding:"required"`
 			Description string  `json:"description"`
 			//shop        models.Shop       `json:"shop" binding:"required"`
 			ShopID     uint              `json:"ShopID" binding:"required"`
 			Categories []models.Category `json:"categories"`
 			Shop       Shop              `json:"shop_id"`
+			SKU        *string           `json:"sku" binding:"omitempty,max=64"` // Left unchanged when absent
+			GTIN       *string           `json:"gtin"`
+			// Replace the attribute values when present, values of removed categories are dropped otherwise
+			Attributes []productAttributeInput `json:"attributes"`
 		}
 
 		fmt.Println("The request :", request)
@@ -773,14 +769,63 @@ func UpdateProduct(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Identifiers are validated before anything is written, null leaves them unchanged
+		identifiers := map[string]interface{}{}
+		if request.GTIN != nil {
+			gtin, err := normalizeProductGTIN(*request.GTIN)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			identifiers["gtin"] = gtin
+		}
+		sku := existingProduct.SKU
+		if request.SKU != nil {
+			sku = strings.TrimSpace(*request.SKU)
+			identifiers["sku"] = sku
+		}
+		if taken, err := skuTaken(db, request.ShopID, existingProduct.ID, sku); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check the SKU"})
+			return
+		} else if taken {
+			c.JSON(http.StatusConflict, gin.H{"error": "A product with this SKU already exists in the shop"})
+			return
+		}
+
+		// Attributes are checked against the requested categories, new ones have no attributes yet
+		var requestedCategoryIDs []uint
+		for _, category := range request.Categories {
+			if category.ID != 0 {
+				requestedCategoryIDs = append(requestedCategoryIDs, category.ID)
+			}
+		}
+		var attributes []models.ProductAttributeValue
+		if request.Attributes != nil {
+			var err error
+			attributes, err = validateProductAttributes(db, requestedCategoryIDs, request.Attributes)
+			var validationErr *attributeValidationError
+			if errors.As(err, &validationErr) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			} else if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check the attributes"})
+				return
+			}
+		}
+
 		// 3. Prepare product updates
 		product := models.Product{
 			Name:        request.Name,
-			Price:       request.Price,
+			Price:       money.FromMajor(request.Price, existingProduct.Currency),
 			Stock:       request.Stock,
 			Description: request.Description,
 			ShopID:      request.ShopID,
 		}
+		// The sale must be changed or removed before the price goes down to it
+		if existingProduct.SalePrice != nil && product.Price.Amount <= existingProduct.SalePrice.Amount {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "price must be higher than the sale price, change or remove the sale first"})
+			return
+		}
 
 		// Generate new slug if name changed
 		if existingProduct.Name != request.Name {
@@ -790,8 +835,31 @@ func UpdateProduct(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// 4. Update product
-		if err := db.Model(&models.Product{}).Where("id = ?", productID).Updates(&product).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update product: " + err.Error()})
+		var changedByID *uint
+		if authUser, err := auth.GetAuthUser(c); err == nil {
+			changedByID = &authUser.ID
+		}
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.Product{}).Where("id = ?", productID).Updates(&product).Error; err != nil {
+				return fmt.Errorf("failed to update product: %w", err)
+			}
+			if product.Slug != "" {
+				// Links to the former slug redirect to the new one
+				if err := models.RecordSlugChange(tx, models.SlugEntityProduct, existingProduct.ID, existingProduct.Slug, product.Slug); err != nil {
+					return fmt.Errorf("failed to record slug change: %w", err)
+				}
+			}
+			if err := models.RecordPriceHistory(tx, existingProduct.ID, changedByID); err != nil {
+				return fmt.Errorf("failed to record price history: %w", err)
+			}
+			if len(identifiers) > 0 {
+				if err := tx.Model(&existingProduct).Updates(identifiers).Error; err != nil {
+					return fmt.Errorf("failed to update product identifiers: %w", err)
+				}
+			}
+			return nil
+		}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
@@ -840,6 +908,21 @@ func UpdateProduct(db *gorm.DB) gin.HandlerFunc {
 			}
 		}
 
+		// 6. Handle attributes
+		if request.Attributes != nil {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				return saveProductAttributes(tx, existingProduct.ID, attributes)
+			})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update attributes: " + err.Error()})
+				return
+			}
+		} else if err := db.Where("product_id = ? AND attribute_definition_id NOT IN (SELECT id FROM attribute_definitions WHERE category_id IN ?)",
+			existingProduct.ID, append(categoryIDs, 0)).Delete(&models.ProductAttributeValue{}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update attributes: " + err.Error()})
+			return
+		}
+
 		// Fetch and return the fully updated product
 		var updatedProduct models.Product
 		if err := db.Preload("Categories").Preload("Shop").
@@ -869,6 +952,13 @@ func UpdateProduct(db *gorm.DB) gin.HandlerFunc {
 
 		fmt.Printf("ShopID before save: %d\n", updatedProduct.Shop.ID)
 
+		attributes, err := loadProductAttributes(db, updatedProduct.ID, "")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch attributes"})
+			return
+		}
+		updatedProduct.Attributes = attributes
+
 		//c.JSON(http.StatusOK, updatedProduct)
 
 		// Return response
@@ -886,7 +976,7 @@ func DeleteProductBatch(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		if err := c.ShouldBindJSON(&request); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.T(c, "Invalid request")})
 			return
 		}
 
@@ -923,14 +1013,14 @@ func DeleteProductImagesBatch(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		if err := c.ShouldBindJSON(&request); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.T(c, "Invalid request")})
 			return
 		}
 
 		// Get userID from auth context (preferred over URL param)
 		authUserID, exists := c.Get("userID")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
 			return
 		}
 
@@ -972,19 +1062,18 @@ func DeleteProductImagesBatch(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if err := db.Where("id IN ?", request.IDs).Delete(&ProductImage{}).Error; err != nil {
-			c.JSON(http.StatusOK, gin.H{"error": "Images delete failed"})
+		if len(images) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Images not found"})
 			return
 		}
 
-		// Delete the files from disk
+		// The files are removed once the records are gone
+		if err := db.Unscoped().Delete(&images).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Images delete failed"})
+			return
+		}
 		for _, image := range images {
-			// Remove the leading slash from the URL to get the correct path
-			filePath := strings.TrimPrefix(image.URL, "/")
-			if err := os.Remove(filePath); err != nil {
-				// Log the error but continue with other files
-				fmt.Printf("Failed to delete file %s: %v\n", filePath, err)
-			}
+			storage.DeleteKeys(c.Request.Context(), image.ObjectKeys())
 		}
 
 		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%d images deleted", len(request.IDs))})
@@ -993,11 +1082,12 @@ func DeleteProductImagesBatch(db *gorm.DB) gin.HandlerFunc {
 
 // Seed initial data
 func SeedProducts(db *gorm.DB) {
+	code := shopCurrency(db, 1)
 	products := []Product{
-		{Name: "Laptop", Price: 999.99, Description: "Del inspiron laptop", Stock: 15, ShopID: 1},
-		{Name: "Phone", Price: 699.99, Description: "iPhone 16 pro 128 GB", Stock: 15, ShopID: 1},
-		{Name: "Tablet", Price: 399.99, Description: "samsung table", Stock: 15, ShopID: 1},
-		{Name: "Headphone", Price: 39.99, Description: "Noise cancelling headphone", Stock: 5, ShopID: 1},
+		{Name: "Laptop", Price: money.FromMajor(999.99, code), Description: "Del inspiron laptop", Stock: 15, ShopID: 1},
+		{Name: "Phone", Price: money.FromMajor(699.99, code), Description: "iPhone 16 pro 128 GB", Stock: 15, ShopID: 1},
+		{Name: "Tablet", Price: money.FromMajor(399.99, code), Description: "samsung table", Stock: 15, ShopID: 1},
+		{Name: "Headphone", Price: money.FromMajor(39.99, code), Description: "Noise cancelling headphone", Stock: 5, ShopID: 1},
 	}
 	for _, p := range products {
 		db.Create(&p)
@@ -1037,34 +1127,18 @@ func UploadProductImage(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	// Create upload directory
-	uploadPath := filepath.Join("uploads", "products", productID)
-	if err := os.MkdirAll(uploadPath, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload directory"})
-		return
-	}
-
-	// Generate unique filename
-	fileExt := filepath.Ext(file.Filename)
-	filename := uuid.New().String() + fileExt
-	dst := filepath.Join(uploadPath, filename)
-
-	// Save file
-	if err := c.SaveUploadedFile(file, dst); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
-		return
-	}
-
-	// Save to database
-	image := ProductImage{
-		ProductID: parseUint(productID),
-		URL:       "/" + filepath.ToSlash(dst),
-		AltText:   c.PostForm("alt_text"),
-	}
-
-	if err := db.Create(&image).Error; err != nil {
-		_ = os.Remove(dst)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image record"})
+	image, err := saveProductImage(c.Request.Context(), db, productID, file, productImageAttributes{
+		AltText: c.PostForm("alt_text"),
+		Variant: c.PostForm("variant"),
+		Color:   c.PostForm("color"),
+	})
+	if err != nil {
+		var invalid *imageproc.ValidationError
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": invalid.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -1089,44 +1163,26 @@ func UploadProductImagesBatch(c *gin.Context, db *gorm.DB) {
 		return
 	}
 
-	// Create upload directory
-	uploadPath := filepath.Join("uploads", "products", productID)
-	if err := os.MkdirAll(uploadPath, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload directory"})
-		return
-	}
-
 	var uploadedImages []ProductImage
+	var rejected []gin.H
 	for _, file := range files {
-		// Generate unique filename
-		fileExt := filepath.Ext(file.Filename)
-		filename := uuid.New().String() + fileExt
-		dst := filepath.Join(uploadPath, filename)
-
-		// Save file
-		if err := c.SaveUploadedFile(file, dst); err != nil {
+		image, err := saveProductImage(c.Request.Context(), db, productID, file, productImageAttributes{
+			AltText: c.PostForm("alt_text"),
+			Variant: c.PostForm("variant"),
+			Color:   c.PostForm("color"),
+		})
+		if err != nil {
+			rejected = append(rejected, gin.H{"file": file.Filename, "error": err.Error()})
 			continue // Skip failed files
 		}
-
-		// Create image record
-		image := ProductImage{
-			ProductID: parseUint(productID),
-			URL:       "/" + filepath.ToSlash(dst),
-			AltText:   c.PostForm("alt_text"),
-		}
-
-		if err := db.Create(&image).Error; err != nil {
-			_ = os.Remove(dst)
-			continue
-		}
-
 		uploadedImages = append(uploadedImages, image)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Batch upload completed",
-		"count":   len(uploadedImages),
-		"images":  uploadedImages,
+		"message":  "Batch upload completed",
+		"count":    len(uploadedImages),
+		"images":   uploadedImages,
+		"rejected": rejected,
 	})
 }
 
@@ -1135,7 +1191,17 @@ func GetProductImages(c *gin.Context, db *gorm.DB) {
 	productID := c.Param("productId")
 	var images []ProductImage
 
-	if err := db.Where("product_id = ? AND is_visible = ?", productID, true).Find(&images).Error; err != nil {
+	query := db.Preload("Translations").Where("product_id = ? AND is_visible = ?", productID, true)
+
+	// Images of other variants and colours are left out, shared images are always included
+	if variant := c.Query("variant"); variant != "" {
+		query = query.Where("(variant = '' OR variant IS NULL OR variant = ?)", variant)
+	}
+	if color := c.Query("color"); color != "" {
+		query = query.Where("(color = '' OR color IS NULL OR color = ?)", color)
+	}
+
+	if err := query.Order(productImagesOrder).Find(&images).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch images"})
 		return
 	}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"talodu/i18n"
+	"talodu/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Recommendations come from the product_recommendations table the
+// "recommendations" job refreshes. Products the job has no data for yet
+// (new products, a new shop) are completed with the products sharing their
+// categories, and the personal recommendations of a new customer with the
+// featured products.
+
+const (
+	defaultRecommendationLimit = 8
+	maxRecommendationLimit     = 50
+	// recommendationSources is how many viewed and bought products the
+	// personal recommendations are computed from
+	recommendationSources = 20
+)
+
+// recommendationRelated is the type of the same-category recommendations
+const recommendationRelated = "related"
+
+func recommendationLimit(c *gin.Context) int {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultRecommendationLimit)))
+	if err != nil || limit <= 0 {
+		return defaultRecommendationLimit
+	}
+	if limit > maxRecommendationLimit {
+		return maxRecommendationLimit
+	}
+	return limit
+}
+
+// excludeProducts leaves the products of ids out of query
+func excludeProducts(query *gorm.DB, ids []uint) *gorm.DB {
+	if len(ids) == 0 {
+		return query
+	}
+	return query.Where("products.id NOT IN ?", ids)
+}
+
+// sameCategoryProductIDs ranks the visible products by the number of
+// categories they share with the products of productIDs, like the related
+// products of a product page
+func sameCategoryProductIDs(db *gorm.DB, productIDs, exclude []uint, limit int) ([]uint, error) {
+	ids := []uint{}
+	if len(productIDs) == 0 || limit <= 0 {
+		return ids, nil
+	}
+	query := db.Model(&models.Product{}).
+		Joins("JOIN product_categories pc ON products.id = pc.product_id").
+		Where("pc.category_id IN (SELECT category_id FROM product_categories WHERE product_id IN ?)", productIDs).
+		Where("products.is_visible = ?", true)
+	err := excludeProducts(query, exclude).
+		Group("products.id").
+		Order("COUNT(pc.category_id) DESC, products.created_at DESC").
+		Limit(limit).
+		Pluck("products.id", &ids).Error
+	return ids, err
+}
+
+// featuredProductIDs returns the visible featured products in their order
+func featuredProductIDs(db *gorm.DB, exclude []uint, limit int) ([]uint, error) {
+	ids := []uint{}
+	if limit <= 0 {
+		return ids, nil
+	}
+	query := db.Model(&models.Product{}).Where("products.is_featured = ? AND products.is_visible = ?", true, true)
+	err := excludeProducts(query, exclude).
+		Order("products.featured_order ASC, products.created_at DESC").
+		Limit(limit).
+		Pluck("products.id", &ids).Error
+	return ids, err
+}
+
+// loadProductsInOrder loads the products of ids for a listing, in the order of ids
+func loadProductsInOrder(db *gorm.DB, ids []uint) ([]models.Product, error) {
+	products := []models.Product{}
+	if len(ids) == 0 {
+		return products, nil
+	}
+	var found []models.Product
+	if err := db.Preload("Images", preloadProductImages(true)).
+		Preload("Images.Translations").
+		Preload("Translations").
+		Preload("Shop", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id", "name")
+		}).
+		Find(&found, ids).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Product, len(found))
+	for _, product := range found {
+		byID[product.ID] = product
+	}
+	for _, id := range ids {
+		if product, ok := byID[id]; ok {
+			products = append(products, product)
+		}
+	}
+	return products, nil
+}
+
+// respondWithProducts loads, localizes and converts the products of ids and
+// answers the request with them and the extra fields
+func respondWithProducts(c *gin.Context, db *gorm.DB, ids []uint, extra gin.H) {
+	products, err := loadProductsInOrder(db, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+		return
+	}
+	localizeProducts(products, i18n.Language(c))
+	prices, ok := newPriceConverter(c, db)
+	if !ok || !prices.products(c, products) {
+		return
+	}
+
+	response := gin.H{"products": products, "count": len(products)}
+	for key, value := range extra {
+		response[key] = value
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GET /products/:id/recommendations?type=bought_together&limit=8 - Products to
+// show on a product page: "bought_together" (the default), "also_viewed" or
+// "related" for the products of the same categories. The related products
+// complete the list when there isn't enough data.
+func GetProductRecommendations(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recommendationType := c.DefaultQuery("type", string(models.RecommendationBoughtTogether))
+		if !models.ValidRecommendationType(models.RecommendationType(recommendationType)) && recommendationType != recommendationRelated {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid type %q, must be %s, %s or %s",
+				recommendationType, models.RecommendationBoughtTogether, models.RecommendationAlsoViewed, recommendationRelated)})
+			return
+		}
+		limit := recommendationLimit(c)
+
+		var product models.Product
+		if err := db.Select("id").First(&product, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
+			return
+		}
+
+		ids := []uint{}
+		if recommendationType != recommendationRelated {
+			var err error
+			ids, err = models.RecommendedProductIDs(db, models.RecommendationType(recommendationType), []uint{product.ID}, []uint{product.ID}, limit)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recommendations"})
+				return
+			}
+		}
+		fallback := false
+		if len(ids) < limit {
+			related, err := sameCategoryProductIDs(db, []uint{product.ID}, append([]uint{product.ID}, ids...), limit-len(ids))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch related products"})
+				return
+			}
+			fallback = len(related) > 0 && recommendationType != recommendationRelated
+			ids = append(ids, related...)
+		}
+
+		respondWithProducts(c, db, ids, gin.H{"type": recommendationType, "fallback": fallback})
+	}
+}
+
+// GET /me/recommendations?limit=8 - Recommendations for the signed-in user or
+// the anonymous session, from the products they viewed and bought
+func GetMyRecommendations(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := recommendationLimit(c)
+		viewer := requestViewer(c)
+
+		sources, err := models.RecentlyViewedProductIDs(db, viewer, recommendationSources)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recently viewed products"})
+			return
+		}
+		if viewer.UserID != nil {
+			var bought []uint
+			if err := db.Model(&models.OrderItem{}).
+				Joins("JOIN orders ON orders.id = order_items.order_id AND orders.deleted_at IS NULL").
+				Where("orders.user_id = ?", *viewer.UserID).
+				Group("order_items.product_id").
+				Order("MAX(orders.created_at) DESC").
+				Limit(recommendationSources).
+				Pluck("order_items.product_id", &bought).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+				return
+			}
+			sources = append(sources, bought...)
+		}
+
+		// What the customer already saw or bought isn't recommended again
+		ids, err := models.RecommendedProductIDs(db, "", sources, sources, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recommendations"})
+			return
+		}
+		fallback := false
+		if len(ids) < limit {
+			related, err := sameCategoryProductIDs(db, sources, append(sources, ids...), limit-len(ids))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch related products"})
+				return
+			}
+			ids = append(ids, related...)
+			fallback = len(related) > 0
+		}
+		if len(ids) < limit {
+			featured, err := featuredProductIDs(db, append(sources, ids...), limit-len(ids))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch featured products"})
+				return
+			}
+			ids = append(ids, featured...)
+			fallback = fallback || len(featured) > 0
+		}
+
+		respondWithProducts(c, db, ids, gin.H{"fallback": fallback})
+	}
+}
@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"talodu/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Synonyms and stop words are managed by admins and kept in an in-memory cache.
+// Every admin write invalidates the cache, and the cache also expires on its own
+// so that other server instances pick up changes without a restart.
+const searchVocabularyTTL = time.Minute
+
+// defaultSearchLanguage is used when the request has no ?lang=, it matches the
+// 'french' text search configuration of the FTS queries.
+const defaultSearchLanguage = "fr"
+
+type searchVocabulary struct {
+	synonyms  map[string]map[string][]string // language -> term -> every term of its sets
+	stopWords map[string]map[string]bool     // language -> word
+	loadedAt  time.Time
+}
+
+var (
+	searchVocabularyMu    sync.RWMutex
+	searchVocabularyCache *searchVocabulary
+)
+
+var searchWordSplitter = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+func normalizeSearchTerm(term string) string {
+	return strings.Join(strings.Fields(strings.ToLower(term)), " ")
+}
+
+func invalidateSearchVocabulary() {
+	searchVocabularyMu.Lock()
+	searchVocabularyCache = nil
+	searchVocabularyMu.Unlock()
+}
+
+func getSearchVocabulary(db *gorm.DB) *searchVocabulary {
+	searchVocabularyMu.RLock()
+	vocab := searchVocabularyCache
+	searchVocabularyMu.RUnlock()
+
+	if vocab != nil && time.Since(vocab.loadedAt) < searchVocabularyTTL {
+		return vocab
+	}
+
+	searchVocabularyMu.Lock()
+	defer searchVocabularyMu.Unlock()
+
+	vocab = &searchVocabulary{
+		synonyms:  make(map[string]map[string][]string),
+		stopWords: make(map[string]map[string]bool),
+		loadedAt:  time.Now(),
+	}
+
+	var synonyms []models.SearchSynonym
+	if err := db.Find(&synonyms).Error; err != nil {
+		// Search still works without the vocabulary, it just isn't expanded
+		return vocab
+	}
+	for _, set := range synonyms {
+		if vocab.synonyms[set.Language] == nil {
+			vocab.synonyms[set.Language] = make(map[string][]string)
+		}
+		var terms []string
+		for _, term := range set.Terms {
+			if term = normalizeSearchTerm(term); term != "" {
+				terms = append(terms, term)
+			}
+		}
+		for _, term := range terms {
+			vocab.synonyms[set.Language][term] = appendUniqueStrings(vocab.synonyms[set.Language][term], terms...)
+		}
+	}
+
+	var stopWords []models.SearchStopWord
+	if err := db.Find(&stopWords).Error; err == nil {
+		for _, sw := range stopWords {
+			if vocab.stopWords[sw.Language] == nil {
+				vocab.stopWords[sw.Language] = make(map[string]bool)
+			}
+			vocab.stopWords[sw.Language][normalizeSearchTerm(sw.Word)] = true
+		}
+	}
+
+	searchVocabularyCache = vocab
+	return vocab
+}
+
+func appendUniqueStrings(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, existing := range list {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// expandSearchTerms splits a search into words, drops the stop words and returns
+// one group per remaining word: the word itself followed by its synonyms.
+// A search that matches a multi-word synonym as a whole is kept as a single group.
+func expandSearchTerms(db *gorm.DB, search, lang string) [][]string {
+	if lang == "" {
+		lang = defaultSearchLanguage
+	}
+	vocab := getSearchVocabulary(db)
+	synonyms := vocab.synonyms[lang]
+	stopWords := vocab.stopWords[lang]
+
+	phrase := normalizeSearchTerm(search)
+	if terms, ok := synonyms[phrase]; ok {
+		return [][]string{terms}
+	}
+
+	var groups [][]string
+	var words []string
+	for _, word := range searchWordSplitter.Split(phrase, -1) {
+		if word == "" {
+			continue
+		}
+		words = append(words, word)
+		if stopWords[word] {
+			continue
+		}
+		if terms, ok := synonyms[word]; ok {
+			groups = append(groups, appendUniqueStrings([]string{word}, terms...))
+		} else {
+			groups = append(groups, []string{word})
+		}
+	}
+
+	// A search made only of stop words is still a search
+	if len(groups) == 0 {
+		for _, word := range words {
+			groups = append(groups, []string{word})
+		}
+	}
+	return groups
+}
+
+// applyProductSearch filters the products query on ?search=, expanding the
+// search with the synonyms and stop words of the requested language.
+func applyProductSearch(db *gorm.DB, query *gorm.DB, search, lang string) *gorm.DB {
+	search = strings.TrimSpace(search)
+	if search == "" {
+		return query
+	}
+
+	groups := expandSearchTerms(db, search, lang)
+	if len(groups) == 0 {
+		return query
+	}
+
+	if len(search) < 5 {
+		// Use trigram-optimized ILIKE for short searches
+		for _, group := range groups {
+			var conditions []string
+			var args []interface{}
+			for _, term := range group {
+				conditions = append(conditions, "name ILIKE ? OR description ILIKE ?")
+				args = append(args, "%"+term+"%", "%"+term+"%")
+			}
+			query = query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+		}
+		return query
+	}
+
+	// Use FTS for longer queries, every group must match and any term of a group can match
+	//CREATE EXTENSION IF NOT EXISTS pg_trgm;
+	//CREATE INDEX idx_products_name_trgm ON products USING gin(name gin_trgm_ops);
+	//CREATE INDEX idx_products_description_trgm ON products USING gin(description gin_trgm_ops);
+	var parts []string
+	for _, group := range groups {
+		var alternatives []string
+		for _, term := range group {
+			// Multi-word synonyms must match as a phrase
+			var words []string
+			for _, word := range searchWordSplitter.Split(term, -1) {
+				if word != "" {
+					words = append(words, word)
+				}
+			}
+			if len(words) > 0 {
+				alternatives = append(alternatives, strings.Join(words, " <-> "))
+			}
+		}
+		if len(alternatives) > 0 {
+			parts = append(parts, "("+strings.Join(alternatives, " | ")+")")
+		}
+	}
+	if len(parts) == 0 {
+		return query
+	}
+
+	return query.Where(
+		"to_tsvector('french', coalesce(name,'') || ' ' || coalesce(description,'')) @@ to_tsquery('french', ?)",
+		strings.Join(parts, " & "),
+	)
+}
+
+// GET /admin/search/synonyms?lang=fr
+func ListSearchSynonyms(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var synonyms []models.SearchSynonym
+		query := db.Order("language, id")
+		if lang := strings.ToLower(strings.TrimSpace(c.Query("lang"))); lang != "" {
+			query = query.Where("language = ?", lang)
+		}
+		if err := query.Find(&synonyms).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch synonyms"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"synonyms": synonyms})
+	}
+}
+
+type searchSynonymInput struct {
+	Language string   `json:"language" binding:"required,max=5"`
+	Terms    []string `json:"terms" binding:"required,min=2"`
+}
+
+func (input searchSynonymInput) normalized() (string, []string) {
+	var terms []string
+	for _, term := range input.Terms {
+		if term = normalizeSearchTerm(term); term != "" {
+			terms = appendUniqueStrings(terms, term)
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(input.Language)), terms
+}
+
+// POST /admin/search/synonyms
+func CreateSearchSynonym(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input searchSynonymInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		lang, terms := input.normalized()
+		if len(terms) < 2 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A synonym set needs at least two different terms"})
+			return
+		}
+
+		synonym := models.SearchSynonym{Language: lang, Terms: terms}
+		if err := db.Create(&synonym).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create synonym set"})
+			return
+		}
+		invalidateSearchVocabulary()
+
+		c.JSON(http.StatusCreated, synonym)
+	}
+}
+
+// PUT /admin/search/synonyms/:id
+func UpdateSearchSynonym(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input searchSynonymInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var synonym models.SearchSynonym
+		if err := db.First(&synonym, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Synonym set not found"})
+			return
+		}
+
+		lang, terms := input.normalized()
+		if len(terms) < 2 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A synonym set needs at least two different terms"})
+			return
+		}
+
+		synonym.Language = lang
+		synonym.Terms = terms
+		if err := db.Save(&synonym).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update synonym set"})
+			return
+		}
+		invalidateSearchVocabulary()
+
+		c.JSON(http.StatusOK, synonym)
+	}
+}
+
+// DELETE /admin/search/synonyms/:id
+func DeleteSearchSynonym(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result := db.Delete(&models.SearchSynonym{}, c.Param("id"))
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete synonym set"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Synonym set not found"})
+			return
+		}
+		invalidateSearchVocabulary()
+
+		c.JSON(http.StatusOK, gin.H{"message": "Synonym set deleted"})
+	}
+}
+
+// GET /admin/search/stopwords?lang=fr
+func ListSearchStopWords(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var stopWords []models.SearchStopWord
+		query := db.Order("language, word")
+		if lang := strings.ToLower(strings.TrimSpace(c.Query("lang"))); lang != "" {
+			query = query.Where("language = ?", lang)
+		}
+		if err := query.Find(&stopWords).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stop words"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"stopWords": stopWords})
+	}
+}
+
+// POST /admin/search/stopwords - accepts one or several words for a language
+func CreateSearchStopWords(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Language string   `json:"language" binding:"required,max=5"`
+			Words    []string `json:"words" binding:"required,min=1"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		lang := strings.ToLower(strings.TrimSpace(input.Language))
+		var created []models.SearchStopWord
+		for _, word := range input.Words {
+			word = normalizeSearchTerm(word)
+			if word == "" {
+				continue
+			}
+			stopWord := models.SearchStopWord{Language: lang, Word: word}
+			if err := db.Where(stopWord).FirstOrCreate(&stopWord).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save stop word " + word})
+				return
+			}
+			created = append(created, stopWord)
+		}
+		invalidateSearchVocabulary()
+
+		c.JSON(http.StatusCreated, gin.H{"stopWords": created})
+	}
+}
+
+// DELETE /admin/search/stopwords/:id
+func DeleteSearchStopWord(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result := db.Delete(&models.SearchStopWord{}, c.Param("id"))
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete stop word"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Stop word not found"})
+			return
+		}
+		invalidateSearchVocabulary()
+
+		c.JSON(http.StatusOK, gin.H{"message": "Stop word deleted"})
+	}
+}
@@ -4,14 +4,16 @@ package handlers
 import (
 	"errors"
 	"fmt"
-	"math"
 	"math/rand"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
 	"talodu/auth"
+	"talodu/currency"
+	"talodu/i18n"
 	"talodu/models"
+	"talodu/money"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -28,12 +30,18 @@ func CreateShop(db *gorm.DB) gin.HandlerFunc {
 			Description string `json:"description"`
 			Moto        string `json:"moto"`
 			OwnerID     uint   `json:"owner_id" binding:"required"`
+			Currency    string `json:"currency"` // The site currency when empty
 		}
 
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		input.Currency = currency.Normalize(input.Currency)
+		if input.Currency != "" && !currency.Valid(input.Currency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "currency must be an ISO 4217 code, e.g. XAF"})
+			return
+		}
 
 		// Verify owner exists
 		var owner models.User
@@ -47,6 +55,7 @@ func CreateShop(db *gorm.DB) gin.HandlerFunc {
 			Description: input.Description,
 			OwnerID:     input.OwnerID,
 			Moto:        input.Moto,
+			Currency:    input.Currency,
 		}
 
 		shop.Slug = generateSlug(input.Name) + "-"
@@ -69,6 +78,7 @@ func UpdateShop(db *gorm.DB) gin.HandlerFunc {
 			Name        string `json:"name" binding:"required"`
 			Description string `json:"description"`
 			Moto        string `json:"moto"`
+			Currency    string `json:"currency"` // Unchanged when empty, existing products keep the currency of their prices
 			//Categories  []models.Category `json:"categories"`
 			//Shop        Shop              `json:"shop_id"`
 		}
@@ -81,6 +91,12 @@ func UpdateShop(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		request.Currency = currency.Normalize(request.Currency)
+		if request.Currency != "" && !currency.Valid(request.Currency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "currency must be an ISO 4217 code, e.g. XAF"})
+			return
+		}
+
 		// Print all request fields with detailed information
 		fmt.Println("\n=== Request Payload ===")
 		fmt.Printf("Name: %s\n", request.Name)
@@ -98,6 +114,7 @@ func UpdateShop(db *gorm.DB) gin.HandlerFunc {
 			Name:        request.Name,
 			Moto:        request.Moto,
 			Description: request.Description,
+			Currency:    request.Currency,
 		}
 
 		// Generate new slug if name changed
@@ -106,8 +123,19 @@ func UpdateShop(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// 4. Update shop
-		if err := db.Model(&models.Shop{}).Where("id = ?", shopID).Updates(&shop).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update shop: " + err.Error()})
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.Shop{}).Where("id = ?", shopID).Updates(&shop).Error; err != nil {
+				return fmt.Errorf("failed to update shop: %w", err)
+			}
+			if shop.Slug != "" {
+				// Links to the former slug redirect to the new one
+				if err := models.RecordSlugChange(tx, models.SlugEntityShop, existingShop.ID, existingShop.Slug, shop.Slug); err != nil {
+					return fmt.Errorf("failed to record slug change: %w", err)
+				}
+			}
+			return nil
+		}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
@@ -141,7 +169,7 @@ func AddShopEmployee(db *gorm.DB) gin.HandlerFunc {
 		// Verify shop exists and current user is owner
 		var shop models.Shop
 		if err := db.First(&shop, shopID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Shop not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Shop not found")})
 			return
 		}
 
@@ -154,7 +182,7 @@ func AddShopEmployee(db *gorm.DB) gin.HandlerFunc {
 		// Add employee
 		var user models.User
 		if err := db.First(&user, input.UserID).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "User not found"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.T(c, "User not found")})
 			return
 		}
 
@@ -188,7 +216,7 @@ func AddShopEmployee2(db *gorm.DB) gin.HandlerFunc {
 		// Verify shop exists
 		var shop models.Shop
 		if err := db.Preload("Owner").First(&shop, shopID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Shop not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Shop not found")})
 			return
 		}
 
@@ -207,7 +235,7 @@ func AddShopEmployee2(db *gorm.DB) gin.HandlerFunc {
 		// Add employee
 		var user models.User
 		if err := db.First(&user, input.UserID).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "User not found"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.T(c, "User not found")})
 			return
 		}
 
@@ -243,6 +271,12 @@ func isAuthorized(authUser *auth.AuthUser, shop models.Shop) bool {
 	return false
 }
 
+// canManageShopProducts tells whether the user can manage the products of the
+// shop: admins, the owner and the employees. shop.Employees must be preloaded.
+func canManageShopProducts(authUser *auth.AuthUser, shop models.Shop) bool {
+	return isAuthorized(authUser, shop) || isEmployee(shop.Employees, authUser.ID)
+}
+
 func IsAuthorized2(c *gin.Context, shop models.Shop) bool {
 	// SuperAdmin can do anything
 	var authUser *auth.AuthUser
@@ -335,25 +369,34 @@ func ListShops(db *gorm.DB) gin.HandlerFunc {
 
 		}
 
-		// Pagination
-		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-		offset := (page - 1) * limit
+		// Pagination (page numbers or keyset cursor)
+		pagination, err := parsePagination(c, 10)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
 		var totalCount int64
 		query.Model(&models.Shop{}).Count(&totalCount)
 		// Execute query
-		query.Offset(offset).Limit(limit).Find(&shops)
-
-		totalPages := int(math.Ceil(float64(totalCount) / float64(limit)))
+		keys, err := shopSortRegistry.Parse(c.Query("sort"), "")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query, err = pagination.Apply(query, keys)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query.Find(&shops)
+		nextCursor, hasMore := pagination.Finish(&shops, keys)
 
-		c.JSON(http.StatusOK, gin.H{
-			"shops":      shops,
-			"page":       page,
-			"limit":      limit,
-			"totalItems": totalCount,
-			"totalPages": totalPages,
-		})
+		response := gin.H{"shops": shops}
+		for key, value := range pagination.Meta(totalCount, nextCursor, hasMore) {
+			response[key] = value
+		}
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -367,13 +410,13 @@ func GetShop(db *gorm.DB) gin.HandlerFunc {
 
 		/**
 		if err := db.First(&shop, id).Preload("Owner").Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Shop not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Shop not found")})
 			return
 		}
 		*/
 
 		if err := query.First(&shop, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Shop not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Shop not found")})
 			return
 		}
 
@@ -397,7 +440,7 @@ func DeleteShop(db *gorm.DB) gin.HandlerFunc {
 		// Get userID from auth context (preferred over URL param)
 		authUserID, exists := c.Get("userID")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Not authenticated")})
 			return
 		}
 
@@ -414,7 +457,7 @@ func DeleteShop(db *gorm.DB) gin.HandlerFunc {
 		// Preload Owner and include error handling
 		if err := db.Preload("Owner").Preload("Products").First(&shop, id).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				c.JSON(http.StatusNotFound, gin.H{"error": "Shop not found"})
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Shop not found")})
 			} else {
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"error":   "Failed to fetch shop details",
@@ -508,7 +551,7 @@ func DeleteShop2(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		if err := db.Preload("Owner").First(&shop, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Shop not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Shop not found")})
 			return
 		}
 
@@ -623,7 +666,7 @@ func SeedShopsProductsAndCategories(db *gorm.DB) error {
 			product := Product{
 				Name:        productName,
 				Description: template.description,
-				Price:       template.priceRange[0] + rand.Float64()*(template.priceRange[1]-template.priceRange[0]),
+				Price:       money.FromMajor(template.priceRange[0]+rand.Float64()*(template.priceRange[1]-template.priceRange[0]), shopCurrency(db, shop.ID)),
 				Stock:       rand.Intn(100) + 10, // Random stock between 10-110
 				ShopID:      shop.ID,
 			}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"talodu/i18n"
+	"talodu/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Slugs end with the ID of their product or shop ("iphone-15-pro-42") and
+// change with the name. Pages are served under the current slug only, former
+// slugs and slugs with a stale name permanently redirect to it.
+
+// redirectToSlug sends a 301 to the page of the current slug, keeping the query string
+func redirectToSlug(c *gin.Context, prefix, slug string) {
+	location := prefix + slug
+	if query := c.Request.URL.RawQuery; query != "" {
+		location += "?" + query
+	}
+	c.Redirect(http.StatusMovedPermanently, location)
+}
+
+// slugID extracts the ID from the last segment of a slug
+func slugID(slug string) uint {
+	parts := strings.Split(slug, "-")
+	return parseUint(parts[len(parts)-1])
+}
+
+// resolveSlug finds the entity of a slug: its current slug, a former one, or
+// the ID at the end of the slug, among the entities of the scopes. current
+// tells whether slug is the current slug.
+func resolveSlug(db *gorm.DB, model interface{}, entityType, slug string, scopes ...func(*gorm.DB) *gorm.DB) (found, current bool) {
+	if result := db.Scopes(scopes...).Where("slug = ?", slug).Limit(1).Find(model); result.Error == nil && result.RowsAffected > 0 {
+		return true, true
+	}
+	if id, ok := models.FindSlugOwner(db, entityType, slug); ok {
+		if err := db.Scopes(scopes...).First(model, id).Error; err == nil {
+			return true, false
+		}
+	}
+	if id := slugID(slug); id != 0 {
+		if err := db.Scopes(scopes...).First(model, id).Error; err == nil {
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// visibleProducts leaves out the products customers can't see: drafts,
+// products waiting for review, archived and hidden ones
+func visibleProducts(db *gorm.DB) *gorm.DB {
+	return db.Where("products.is_visible = ?", true)
+}
+
+// GET /products/ps/:slug - Product page by slug, visible products only
+func GetProductBySlug(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var product models.Product
+		found, current := resolveSlug(db, &product, models.SlugEntityProduct, c.Param("slug"), visibleProducts)
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Product not found")})
+			return
+		}
+		if !current {
+			redirectToSlug(c, "/products/ps/", product.Slug)
+			return
+		}
+
+		// The page is shown in the language of the request
+		if err := db.Preload("Translations").
+			Preload("Images", preloadProductImages(true)).
+			Preload("Images.Translations").
+			Preload("Categories.Translations").
+			First(&product, product.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+			return
+		}
+		if err := loadBundleComponents(db, &product); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bundle components"})
+			return
+		}
+		product.Localize(i18n.Language(c))
+		prices, ok := newPriceConverter(c, db)
+		if !ok || !prices.product(c, &product) {
+			return
+		}
+
+		recordProductView(c, db, product.ID)
+		c.JSON(http.StatusOK, product)
+	}
+}
+
+// GET /shops/s/:slug?page=1&limit=20&sort=-created_at - Public shop page by
+// slug, with a page of its visible products in the language of the request
+func GetShopBySlug(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lang := i18n.Language(c)
+		var shop models.Shop
+		found, current := resolveSlug(db, &shop, models.SlugEntityShop, c.Param("slug"))
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Shop not found")})
+			return
+		}
+		if !current {
+			redirectToSlug(c, "/shops/s/", shop.Slug)
+			return
+		}
+
+		if err := db.Preload("Owner", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id", "username") // Public page, no contact details
+		}).First(&shop, shop.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shop"})
+			return
+		}
+
+		prices, ok := newPriceConverter(c, db)
+		if !ok {
+			return
+		}
+		pagination, err := parsePagination(c, 20)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		keys, err := productSortRegistry.Parse(c.DefaultQuery("sort", "-created_at"), lang)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		keys = prices.sortKeys(keys)
+
+		query := db.Model(&models.Product{}).
+			Scopes(visibleProducts).
+			Where("products.shop_id = ?", shop.ID).
+			Preload("Translations").
+			Preload("Images", preloadProductImages(true)).
+			Preload("Images.Translations")
+		var totalCount int64
+		if err := query.Count(&totalCount).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shop products"})
+			return
+		}
+		query, err = pagination.Apply(query, keys)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := query.Find(&shop.Products).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shop products"})
+			return
+		}
+		nextCursor, hasMore := pagination.Finish(&shop.Products, keys)
+
+		localizeProducts(shop.Products, lang)
+		if !prices.products(c, shop.Products) {
+			return
+		}
+
+		response := gin.H{"shop": shop}
+		for key, value := range pagination.Meta(totalCount, nextCursor, hasMore) {
+			response[key] = value
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"talodu/models"
+)
+
+// Lists are sorted with ?sort=field or ?sort=-field for DESC, several fields can
+// be combined: ?sort=-rating,price. Only the fields declared in the registry of
+// the resource are accepted, anything else is rejected with a 400.
+
+// SortField describes a field clients can sort a list by
+type SortField struct {
+	Column string // SQL column
+	Field  string // struct field holding the value, used by cursor pagination
+	// Localized fields are sorted by their translation when a language is requested.
+	// The expression takes the language as its only argument.
+	Localized string
+}
+
+// SortRegistry declares the sortable fields of a resource
+type SortRegistry struct {
+	Fields   map[string]SortField
+	Default  []SortKey
+	IDColumn string
+}
+
+var productSortRegistry = SortRegistry{
+	Fields: map[string]SortField{
+		"id":         {Column: "products.id", Field: "ID"},
+		"name":       {Column: "products.name", Field: "Name", Localized: "COALESCE((SELECT pt.name FROM product_translations pt WHERE pt.product_id = products.id AND pt.language = ? AND pt.deleted_at IS NULL LIMIT 1), products.name)"},
+		"price":      {Column: models.EffectivePriceSQL, Field: "EffectivePrice"}, // Sale prices included, converted by priceConverter.sortKeys
+		"stock":      {Column: models.StockSQL, Field: "Stock"},                   // Bundles included
+		"rating":     {Column: "products.rating", Field: "Rating"},
+		"created_at": {Column: "products.created_at", Field: "CreatedAt"},
+		"updated_at": {Column: "products.updated_at", Field: "UpdatedAt"},
+		"featured":   {Column: "products.featured_order", Field: "FeaturedOrder"},
+	},
+	Default:  []SortKey{{Column: "products.created_at", Field: "CreatedAt", Desc: true}},
+	IDColumn: "products.id",
+}
+
+var shopSortRegistry = SortRegistry{
+	Fields: map[string]SortField{
+		"id":         {Column: "shops.id", Field: "ID"},
+		"name":       {Column: "shops.name", Field: "Name"},
+		"created_at": {Column: "shops.created_at", Field: "CreatedAt"},
+		"updated_at": {Column: "shops.updated_at", Field: "UpdatedAt"},
+	},
+	Default:  []SortKey{{Column: "shops.id", Field: "ID"}},
+	IDColumn: "shops.id",
+}
+
+var orderSortRegistry = SortRegistry{
+	Fields: map[string]SortField{
+		"id":           {Column: "orders.id", Field: "ID"},
+		"created_at":   {Column: "orders.created_at", Field: "CreatedAt"},
+		"updated_at":   {Column: "orders.updated_at", Field: "UpdatedAt"},
+		"total_amount": {Column: "orders.total_amount", Field: "TotalAmount"},
+		"status":       {Column: "orders.status", Field: "Status"},
+		"order_number": {Column: "orders.order_number", Field: "OrderNumber"},
+	},
+	Default:  []SortKey{{Column: "orders.created_at", Field: "CreatedAt", Desc: true}},
+	IDColumn: "orders.id",
+}
+
+var userSortRegistry = SortRegistry{
+	Fields: map[string]SortField{
+		"id":         {Column: "users.id", Field: "ID"},
+		"username":   {Column: "users.username", Field: "Username"},
+		"email":      {Column: "users.email", Field: "Email"},
+		"first_name": {Column: "users.first_name", Field: "FirstName"},
+		"last_name":  {Column: "users.last_name", Field: "LastName"},
+		"created_at": {Column: "users.created_at", Field: "CreatedAt"},
+	},
+	Default:  []SortKey{{Column: "users.id", Field: "ID"}},
+	IDColumn: "users.id",
+}
+
+var notificationSortRegistry = SortRegistry{
+	Fields: map[string]SortField{
+		"id":         {Column: "notifications.id", Field: "ID"},
+		"created_at": {Column: "notifications.created_at", Field: "CreatedAt"},
+	},
+	Default:  []SortKey{{Column: "notifications.created_at", Field: "CreatedAt", Desc: true}},
+	IDColumn: "notifications.id",
+}
+
+var questionSortRegistry = SortRegistry{
+	Fields: map[string]SortField{
+		"id":           {Column: "product_questions.id", Field: "ID"},
+		"votes":        {Column: "product_questions.votes", Field: "Votes"},
+		"answer_count": {Column: "product_questions.answer_count", Field: "AnswerCount"},
+		"created_at":   {Column: "product_questions.created_at", Field: "CreatedAt"},
+	},
+	Default: []SortKey{
+		{Column: "product_questions.votes", Field: "Votes", Desc: true},
+		{Column: "product_questions.created_at", Field: "CreatedAt", Desc: true},
+	},
+	IDColumn: "product_questions.id",
+}
+
+// Parse turns a ?sort= value into sort keys. The primary key is always added
+// last so the order is stable between pages.
+func (r SortRegistry) Parse(value, lang string) ([]SortKey, error) {
+	var keys []SortKey
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		desc := false
+		if strings.HasPrefix(part, "-") {
+			desc = true
+			part = strings.TrimPrefix(part, "-")
+		} else {
+			part = strings.TrimPrefix(part, "+")
+		}
+
+		field, ok := r.Fields[part]
+		if !ok {
+			return nil, fmt.Errorf("unknown sort field %q, allowed fields are: %s", part, strings.Join(r.names(), ", "))
+		}
+		if seen[part] {
+			continue
+		}
+		seen[part] = true
+
+		key := SortKey{Column: field.Column, Field: field.Field, Desc: desc}
+		if field.Localized != "" && lang != "" {
+			// Translated values are not stored on the row, they can't be used in a cursor
+			key = SortKey{Column: field.Localized, Args: []interface{}{lang}, Desc: desc}
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		keys = append(keys, r.Default...)
+	}
+	return withIDTiebreaker(keys, r.IDColumn), nil
+}
+
+func (r SortRegistry) names() []string {
+	names := make([]string, 0, len(r.Fields))
+	for name := range r.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"talodu/i18n"
+	"talodu/models"
+	"talodu/translate"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Products, abouts and categories are written in i18n.ContentLanguage.
+// The machine translation endpoints fill the missing translations as drafts
+// (Draft is set), saving a draft through the translation endpoints approves
+// it. The report lists what is still missing per shop and language.
+
+// targetLanguages validates the requested languages, all the target languages when none
+func targetLanguages(requested []string) ([]string, error) {
+	targets := translate.TargetLanguages()
+	if len(requested) == 0 {
+		return targets, nil
+	}
+	var languages []string
+	for _, lang := range requested {
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if !containsString(targets, lang) {
+			return nil, fmt.Errorf("can't translate to %q, expected one of: %s", lang, strings.Join(targets, ", "))
+		}
+		languages = append(languages, lang)
+	}
+	return languages, nil
+}
+
+// POST /products/:id/translations/machine - Machine-translate the missing
+// translations of a product and its abouts as drafts: {"languages": ["en"]}, all when empty
+func MachineTranslateProduct(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if translate.Default == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Machine translation is not configured"})
+			return
+		}
+
+		var input struct {
+			Languages []string `json:"languages"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil && c.Request.ContentLength > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		languages, err := targetLanguages(input.Languages)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		product, _, ok := loadManagedProduct(c, db)
+		if !ok {
+			return
+		}
+
+		summary, err := models.MachineTranslateProduct(c.Request.Context(), db, translate.Default, product, languages)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Machine translation failed: " + err.Error(), "translated": summary})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Missing translations added as drafts", "translated": summary})
+	}
+}
+
+// PUT /categories/:id/translations - Create or update the translation of a category (admins)
+func UpsertCategoryTranslation(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Language    string `json:"language" binding:"required"`
+			Name        string `json:"name" binding:"required"`
+			Description string `json:"description"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		input.Language = strings.ToLower(strings.TrimSpace(input.Language))
+		if !containsString(i18n.Supported, input.Language) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "language must be one of: " + strings.Join(i18n.Supported, ", ")})
+			return
+		}
+
+		var category models.Category
+		if err := db.First(&category, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Category not found")})
+			return
+		}
+
+		// Saving a machine translation draft approves it
+		translation := models.CategoryTranslation{
+			CategoryID:  category.ID,
+			Language:    input.Language,
+			Name:        input.Name,
+			Description: input.Description,
+		}
+		if err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "category_id"}, {Name: "language"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "description", "draft", "updated_at"}),
+		}).Create(&translation).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save translation"})
+			return
+		}
+
+		c.JSON(http.StatusOK, translation)
+	}
+}
+
+// POST /categories/:id/translations/machine - Machine-translate the missing translations of a category as drafts (admins)
+func MachineTranslateCategory(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if translate.Default == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Machine translation is not configured"})
+			return
+		}
+
+		var input struct {
+			Languages []string `json:"languages"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil && c.Request.ContentLength > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		languages, err := targetLanguages(input.Languages)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var category models.Category
+		if err := db.Preload("Translations").First(&category, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "Category not found")})
+			return
+		}
+
+		translated := []string{}
+		for _, lang := range languages {
+			exists := false
+			for _, t := range category.Translations {
+				exists = exists || t.Language == lang
+			}
+			if exists {
+				continue
+			}
+			texts, err := translate.Default.Translate(c.Request.Context(), []string{category.Name, category.Description}, i18n.ContentLanguage, lang)
+			if err != nil {
+				c.JSON(http.StatusBadGateway, gin.H{"error": "Machine translation failed: " + err.Error(), "translated": translated})
+				return
+			}
+			if err := db.Create(&models.CategoryTranslation{
+				CategoryID:  category.ID,
+				Language:    lang,
+				Name:        texts[0],
+				Description: texts[1],
+				Draft:       true,
+			}).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save translation", "translated": translated})
+				return
+			}
+			translated = append(translated, lang)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Missing translations added as drafts", "translated": translated})
+	}
+}
+
+// missingProduct is a product without translation in the report
+type missingProduct struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// languageCompleteness is the translation state of a shop in one language
+type languageCompleteness struct {
+	MissingProducts      []missingProduct `json:"missing_products"`
+	DraftProducts        int64            `json:"draft_products"` // Machine translated, not reviewed yet
+	MissingAbouts        int64            `json:"missing_abouts"`
+	ProductsMissingAbout []uint           `json:"products_missing_about"` // Products with untranslated abouts
+}
+
+// shopCompleteness is the translation report of a shop
+type shopCompleteness struct {
+	ShopID    uint                             `json:"shop_id"`
+	ShopName  string                           `json:"shop_name"`
+	Products  int64                            `json:"products"`
+	Languages map[string]*languageCompleteness `json:"languages"`
+}
+
+// GET /admin/translations/report?shop_id=3&lang=en - Products, abouts and
+// categories missing translations, per shop and language
+func GetTranslationReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		languages := translate.TargetLanguages()
+		if lang := c.Query("lang"); lang != "" {
+			var err error
+			if languages, err = targetLanguages([]string{lang}); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		shopsQuery := db.Model(&models.Shop{}).Select("id", "name").Order("name")
+		if shopID := c.Query("shop_id"); shopID != "" {
+			shopsQuery = shopsQuery.Where("id = ?", shopID)
+		}
+		var shops []models.Shop
+		if err := shopsQuery.Find(&shops).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shops"})
+			return
+		}
+		report := make(map[uint]*shopCompleteness, len(shops))
+		shopIDs := make([]uint, len(shops))
+		for i, shop := range shops {
+			shopIDs[i] = shop.ID
+			report[shop.ID] = &shopCompleteness{ShopID: shop.ID, ShopName: shop.Name, Languages: make(map[string]*languageCompleteness)}
+			for _, lang := range languages {
+				report[shop.ID].Languages[lang] = &languageCompleteness{MissingProducts: []missingProduct{}, ProductsMissingAbout: []uint{}}
+			}
+		}
+
+		failed := func() {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute the translation report"})
+		}
+		products := func() *gorm.DB {
+			return db.Model(&models.Product{}).Where("products.shop_id IN ?", shopIDs)
+		}
+
+		var productCounts []struct {
+			ShopID uint
+			Count  int64
+		}
+		if err := products().Select("shop_id, COUNT(*) AS count").Group("shop_id").Scan(&productCounts).Error; err != nil {
+			failed()
+			return
+		}
+		for _, row := range productCounts {
+			report[row.ShopID].Products = row.Count
+		}
+
+		for _, lang := range languages {
+			var missing []struct {
+				ShopID uint
+				ID     uint
+				Name   string
+			}
+			if err := products().Select("products.shop_id, products.id, products.name").
+				Where("NOT EXISTS (SELECT 1 FROM product_translations t WHERE t.product_id = products.id AND t.language = ? AND t.deleted_at IS NULL)", lang).
+				Order("products.id").
+				Scan(&missing).Error; err != nil {
+				failed()
+				return
+			}
+			for _, row := range missing {
+				entry := report[row.ShopID].Languages[lang]
+				entry.MissingProducts = append(entry.MissingProducts, missingProduct{ID: row.ID, Name: row.Name})
+			}
+
+			var drafts []struct {
+				ShopID uint
+				Count  int64
+			}
+			if err := products().Select("products.shop_id, COUNT(*) AS count").
+				Where("EXISTS (SELECT 1 FROM product_translations t WHERE t.product_id = products.id AND t.language = ? AND t.draft AND t.deleted_at IS NULL)", lang).
+				Group("products.shop_id").
+				Scan(&drafts).Error; err != nil {
+				failed()
+				return
+			}
+			for _, row := range drafts {
+				report[row.ShopID].Languages[lang].DraftProducts = row.Count
+			}
+
+			var abouts []struct {
+				ShopID    uint
+				ProductID uint
+				Count     int64
+			}
+			if err := products().Select("products.shop_id, product_abouts.product_id, COUNT(*) AS count").
+				Joins("JOIN product_abouts ON product_abouts.product_id = products.id").
+				Where("NOT EXISTS (SELECT 1 FROM product_about_translations t WHERE t.product_about_id = product_abouts.id AND t.language = ?)", lang).
+				Group("products.shop_id, product_abouts.product_id").
+				Order("product_abouts.product_id").
+				Scan(&abouts).Error; err != nil {
+				failed()
+				return
+			}
+			for _, row := range abouts {
+				entry := report[row.ShopID].Languages[lang]
+				entry.MissingAbouts += row.Count
+				entry.ProductsMissingAbout = append(entry.ProductsMissingAbout, row.ProductID)
+			}
+		}
+
+		// Categories are shared by the shops
+		categories := make(map[string][]models.Category)
+		for _, lang := range languages {
+			var missing []models.Category
+			if err := db.Select("id", "name").
+				Where("NOT EXISTS (SELECT 1 FROM category_translations t WHERE t.category_id = categories.id AND t.language = ?)", lang).
+				Order("name").
+				Find(&missing).Error; err != nil {
+				failed()
+				return
+			}
+			categories[lang] = missing
+		}
+
+		result := make([]*shopCompleteness, 0, len(report))
+		for _, shop := range report {
+			result = append(result, shop)
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].ShopName < result[j].ShopName })
+
+		c.JSON(http.StatusOK, gin.H{
+			"source_language":    i18n.ContentLanguage,
+			"languages":          languages,
+			"shops":              result,
+			"missing_categories": categories,
+		})
+	}
+}
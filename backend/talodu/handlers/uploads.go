@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"talodu/jobs"
+	"talodu/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GET /admin/uploads/orphans - Report the stored files no record references, nothing is deleted
+func ListOrphanUploads(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := jobs.ReconcileUploads(c.Request.Context(), db, storage.Default, jobs.UploadsGCOptions{
+			DryRun:      true,
+			GracePeriod: jobs.UploadsGracePeriod(),
+		})
+		if errors.Is(err, jobs.ErrUploadsNotMigrated) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reconcile uploads", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// POST /admin/uploads/gc - Delete the orphaned files older than the grace period
+func CollectOrphanUploads(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := jobs.ReconcileUploads(c.Request.Context(), db, storage.Default, jobs.UploadsGCOptions{
+			GracePeriod: jobs.UploadsGracePeriod(),
+		})
+		if errors.Is(err, jobs.ErrUploadsNotMigrated) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to collect orphaned uploads", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -3,11 +3,11 @@ package handlers
 import (
 	"errors"
 	"fmt"
-	"math"
 	"net/http"
 	"strconv"
 	"strings"
 	"talodu/auth"
+	"talodu/i18n"
 	"talodu/models"
 
 	"github.com/gin-gonic/gin"
@@ -88,7 +88,7 @@ func UpdateUser(db *gorm.DB) gin.HandlerFunc {
 		var user models.User
 		if err := tx.Preload("Roles").First(&user, userID).Error; err != nil {
 			tx.Rollback()
-			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "User not found")})
 			return
 		}
 
@@ -163,7 +163,7 @@ func UpdateUserOwnData(db *gorm.DB) gin.HandlerFunc {
 		var user models.User
 		if err := tx.Preload("Roles").First(&user, userID).Error; err != nil {
 			tx.Rollback()
-			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.T(c, "User not found")})
 			return
 		}
 
@@ -205,11 +205,13 @@ func ListUsers(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var users []User
 
-		// Pagination
-		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+		// Pagination (page numbers or keyset cursor)
+		pagination, err := parsePagination(c, 10)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		searchTerm := c.Query("search")
-		offset := (page - 1) * limit
 
 		// Base query
 		query := db.Preload("Roles")
@@ -228,11 +230,22 @@ func ListUsers(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// Execute query with pagination
-		result := query.Offset(offset).Limit(limit).Find(&users)
+		keys, err := userSortRegistry.Parse(c.Query("sort"), "")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query, err = pagination.Apply(query, keys)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		result := query.Find(&users)
 		if result.Error != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 			return
 		}
+		nextCursor, hasMore := pagination.Finish(&users, keys)
 
 		// Total count (with same search conditions)
 		var totalCount int64
@@ -251,8 +264,6 @@ func ListUsers(db *gorm.DB) gin.HandlerFunc {
 		}
 		countQuery.Count(&totalCount)
 
-		totalPages := int(math.Ceil(float64(totalCount) / float64(limit)))
-
 		// Format response (exclude passwords)
 		var userResponses []auth.UserResponse
 		for _, user := range users {
@@ -266,13 +277,11 @@ func ListUsers(db *gorm.DB) gin.HandlerFunc {
 			})
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"users":      userResponses,
-			"page":       page,
-			"limit":      limit,
-			"totalItems": totalCount,
-			"totalPages": totalPages,
-		})
+		response := gin.H{"users": userResponses}
+		for key, value := range pagination.Meta(totalCount, nextCursor, hasMore) {
+			response[key] = value
+		}
+		c.JSON(http.StatusOK, response)
 	}
 }
 
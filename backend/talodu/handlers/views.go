@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"talodu/auth"
+	"talodu/i18n"
+	"talodu/models"
+	"talodu/settings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Product pages record a view of the signed-in user or of the anonymous
+// session of the X-Session-ID header, which moves to the account on login.
+// The recently viewed products follow the customer across devices.
+
+const defaultRecentlyViewedCount = 8
+
+// requestViewer returns the signed-in user of the request, or its anonymous
+// session
+func requestViewer(c *gin.Context) models.Viewer {
+	if c.GetHeader("Authorization") != "" {
+		if authUser, err := auth.GetAuthUser(c); err == nil {
+			return models.Viewer{UserID: &authUser.ID}
+		}
+	}
+	return models.Viewer{SessionID: auth.SessionID(c)}
+}
+
+// recordProductView records a view of the product by the viewer of the
+// request. Failures are only logged, they don't fail the page.
+func recordProductView(c *gin.Context, db *gorm.DB, productID uint) {
+	if err := models.RecordProductView(db, productID, requestViewer(c)); err != nil {
+		log.Printf("Failed to record a view of product %d: %v", productID, err)
+	}
+}
+
+// GET /me/recently-viewed - Products the signed-in user or the anonymous
+// session viewed, the most recent first, as many as the display settings show
+func ListRecentlyViewed(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		display := settings.LoadDisplaySettings(db)
+		if !display.ShowRecentlyViewed {
+			c.JSON(http.StatusOK, gin.H{"products": []models.Product{}, "count": 0})
+			return
+		}
+		limit := display.RecentlyViewedCount
+		if limit <= 0 {
+			limit = defaultRecentlyViewedCount
+		}
+
+		ids, err := models.RecentlyViewedProductIDs(db, requestViewer(c), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recently viewed products"})
+			return
+		}
+		respondWithProducts(c, db, ids, nil)
+	}
+}
+
+// DELETE /me/recently-viewed - Clear the viewing history
+func ClearRecentlyViewed(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		viewer := requestViewer(c)
+		if viewer.IsZero() {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.T(c, "Authentication required")})
+			return
+		}
+		if err := models.ClearProductViews(db, viewer); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear recently viewed products"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Recently viewed products cleared"})
+	}
+}
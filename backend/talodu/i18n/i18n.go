@@ -0,0 +1,226 @@
+// Package i18n resolves the language of a request and picks translations
+// along a fallback chain.
+//
+// The language of a request is, in order: the ?lang= parameter, the
+// preferred language of the signed-in user, the Accept-Language header and
+// DEFAULT_LANGUAGE (en by default). A language falls back to its base
+// language ("fr-cm" to "fr"), to the fallbacks configured for it in
+// I18N_FALLBACKS, e.g. "fr-cm:fr,en;es:fr", and to the default language.
+//
+// Catalogue content is written in CONTENT_LANGUAGE (fr by default) and
+// translated in the other languages, the untranslated fields are used when
+// the chain reaches the content language or runs out.
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contextKey is where the language of the request is kept once resolved
+const contextKey = "i18n.lang"
+
+var (
+	// Supported are the languages the API answers in
+	Supported = []string{"en", "fr", "es"}
+	// DefaultLanguage is the last fallback of every chain
+	DefaultLanguage = "en"
+	// ContentLanguage is the language of the untranslated catalogue fields
+	ContentLanguage = "fr"
+	// Fallbacks are the configured fallbacks of languages, before the default
+	Fallbacks = map[string][]string{}
+)
+
+// UserLanguage returns the preferred language of the signed-in user, "" when
+// there is none. It is set by the application, which knows the users.
+var UserLanguage = func(c *gin.Context) string { return "" }
+
+// Init reads the configuration from the environment
+func Init() error {
+	if value := os.Getenv("I18N_LANGUAGES"); value != "" {
+		Supported = nil
+		for _, lang := range strings.Split(value, ",") {
+			if lang = Normalize(lang); lang != "" {
+				Supported = append(Supported, lang)
+			}
+		}
+	}
+	if value := Normalize(os.Getenv("DEFAULT_LANGUAGE")); value != "" {
+		DefaultLanguage = value
+	}
+	if value := Normalize(os.Getenv("CONTENT_LANGUAGE")); value != "" {
+		ContentLanguage = value
+	}
+	if !IsSupported(DefaultLanguage) {
+		return fmt.Errorf("the default language %q is not supported", DefaultLanguage)
+	}
+
+	Fallbacks = map[string][]string{}
+	for _, rule := range strings.Split(os.Getenv("I18N_FALLBACKS"), ";") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		lang, fallbacks, ok := strings.Cut(rule, ":")
+		if !ok || Normalize(lang) == "" {
+			return fmt.Errorf("invalid I18N_FALLBACKS rule %q, expected lang:fallback,fallback", rule)
+		}
+		for _, fallback := range strings.Split(fallbacks, ",") {
+			if fallback = Normalize(fallback); fallback != "" {
+				Fallbacks[Normalize(lang)] = append(Fallbacks[Normalize(lang)], fallback)
+			}
+		}
+	}
+	return nil
+}
+
+// Normalize lowercases a language tag and uses hyphens: "fr_CM" is "fr-cm"
+func Normalize(tag string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+}
+
+// base returns the language of a tag without its region
+func base(tag string) string {
+	lang, _, _ := strings.Cut(tag, "-")
+	return lang
+}
+
+// IsSupported tells whether the API answers in lang
+func IsSupported(lang string) bool {
+	for _, supported := range Supported {
+		if supported == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// Chain returns the languages to try for lang, in order: the language, its
+// base language, their configured fallbacks and the default language
+func Chain(lang string) []string {
+	lang = Normalize(lang)
+	var chain []string
+	seen := make(map[string]bool)
+	add := func(candidates ...string) {
+		for _, candidate := range candidates {
+			if candidate != "" && !seen[candidate] {
+				seen[candidate] = true
+				chain = append(chain, candidate)
+			}
+		}
+	}
+	add(lang, base(lang))
+	add(Fallbacks[lang]...)
+	add(Fallbacks[base(lang)]...)
+	add(DefaultLanguage)
+	return chain
+}
+
+// resolve returns the first supported language of the chain of tag, "" if none
+func resolve(tag string) string {
+	if tag = Normalize(tag); tag == "" {
+		return ""
+	}
+	for _, lang := range Chain(tag) {
+		if lang == DefaultLanguage && lang != tag && lang != base(tag) {
+			return "" // Reaching the default means the tag itself isn't supported
+		}
+		if IsSupported(lang) {
+			return lang
+		}
+	}
+	return ""
+}
+
+// ParseAcceptLanguage returns the first supported language of an
+// Accept-Language header, by decreasing quality, "" if none
+func ParseAcceptLanguage(header string) string {
+	type weighted struct {
+		tag     string
+		quality float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+		if tag != "" && tag != "*" && quality > 0 {
+			tags = append(tags, weighted{tag, quality})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].quality > tags[j].quality })
+
+	for _, tag := range tags {
+		if lang := resolve(tag.tag); lang != "" {
+			return lang
+		}
+	}
+	return ""
+}
+
+// Language returns the language of the request, see the package documentation
+func Language(c *gin.Context) string {
+	if lang := c.GetString(contextKey); lang != "" {
+		return lang
+	}
+
+	lang := resolve(c.Query("lang"))
+	if lang == "" {
+		lang = resolve(UserLanguage(c))
+	}
+	if lang == "" {
+		lang = ParseAcceptLanguage(c.GetHeader("Accept-Language"))
+	}
+	if lang == "" {
+		lang = DefaultLanguage
+	}
+
+	c.Set(contextKey, lang)
+	c.Header("Content-Language", lang)
+	return lang
+}
+
+// QueryLanguage returns the supported language of the ?lang= parameter, ""
+// when it's absent. Back-office endpoints use it to serve the untranslated
+// content unless a translation is explicitly requested.
+func QueryLanguage(c *gin.Context) string {
+	return resolve(c.Query("lang"))
+}
+
+// Middleware resolves the language of every request and sets the Content-Language header
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Vary", "Accept-Language")
+		Language(c)
+		c.Next()
+	}
+}
+
+// Pick returns the index of the translation to use for lang among n
+// translations, language(i) being the language of the i-th. It returns -1
+// when the untranslated content should be used: the chain reached the
+// content language, or no translation matches.
+func Pick(lang string, n int, language func(i int) string) int {
+	if lang == "" || n == 0 {
+		return -1
+	}
+	for _, candidate := range Chain(lang) {
+		if candidate == ContentLanguage {
+			return -1
+		}
+		for i := 0; i < n; i++ {
+			if Normalize(language(i)) == candidate {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,89 @@
+package i18n
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// messages translates the messages of the API, keyed by their English text.
+// Messages missing from a language fall back along its chain, and to the
+// English text.
+var messages = map[string]map[string]string{
+	"fr": {
+		// Errors
+		"Not authenticated":       "Non authentifié",
+		"Authentication required": "Authentification requise",
+		"Operation not permitted": "Opération non autorisée",
+		"Invalid request":         "Requête invalide",
+		"Unsupported language":    "Langue non prise en charge",
+		"User not found":          "Utilisateur introuvable",
+		"Product not found":       "Produit introuvable",
+		"Shop not found":          "Boutique introuvable",
+		"Category not found":      "Catégorie introuvable",
+		"Image not found":         "Image introuvable",
+		"Question not found":      "Question introuvable",
+		"Answer not found":        "Réponse introuvable",
+		"Attribute not found":     "Attribut introuvable",
+		"Collection not found":    "Collection introuvable",
+
+		// Notifications
+		"Product approved": "Produit approuvé",
+		"Your product \"%s\" was approved and is now published.":        "Votre produit « %s » a été approuvé et est maintenant publié.",
+		"Your product \"%s\" was approved and will be published on %s.": "Votre produit « %s » a été approuvé et sera publié le %s.",
+		"Product rejected":                           "Produit refusé",
+		"Your product \"%s\" was not approved: %s":   "Votre produit « %s » n'a pas été approuvé : %s",
+		"New question about a product":               "Nouvelle question sur un produit",
+		"%s asked about \"%s\": %s":                  "%s a posé une question sur « %s » : %s",
+		"Your question was answered":                 "Vous avez reçu une réponse à votre question",
+		"%s answered your question about \"%s\": %s": "%s a répondu à votre question sur « %s » : %s",
+	},
+	"es": {
+		// Errors
+		"Not authenticated":       "No autenticado",
+		"Authentication required": "Autenticación requerida",
+		"Operation not permitted": "Operación no permitida",
+		"Invalid request":         "Solicitud no válida",
+		"Unsupported language":    "Idioma no admitido",
+		"User not found":          "Usuario no encontrado",
+		"Product not found":       "Producto no encontrado",
+		"Shop not found":          "Tienda no encontrada",
+		"Category not found":      "Categoría no encontrada",
+		"Image not found":         "Imagen no encontrada",
+		"Question not found":      "Pregunta no encontrada",
+		"Answer not found":        "Respuesta no encontrada",
+		"Attribute not found":     "Atributo no encontrado",
+		"Collection not found":    "Colección no encontrada",
+
+		// Notifications
+		"Product approved": "Producto aprobado",
+		"Your product \"%s\" was approved and is now published.":        "Tu producto «%s» fue aprobado y ya está publicado.",
+		"Your product \"%s\" was approved and will be published on %s.": "Tu producto «%s» fue aprobado y se publicará el %s.",
+		"Product rejected":                           "Producto rechazado",
+		"Your product \"%s\" was not approved: %s":   "Tu producto «%s» no fue aprobado: %s",
+		"New question about a product":               "Nueva pregunta sobre un producto",
+		"%s asked about \"%s\": %s":                  "%s preguntó sobre «%s»: %s",
+		"Your question was answered":                 "Respondieron a tu pregunta",
+		"%s answered your question about \"%s\": %s": "%s respondió a tu pregunta sobre «%s»: %s",
+	},
+}
+
+// Translate returns message in lang, formatted with args like fmt.Sprintf
+func Translate(lang, message string, args ...interface{}) string {
+	format := message
+	for _, candidate := range Chain(lang) {
+		if translated, ok := messages[candidate][message]; ok {
+			format = translated
+			break
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// T returns message in the language of the request, see Translate
+func T(c *gin.Context, message string, args ...interface{}) string {
+	return Translate(Language(c), message, args...)
+}
@@ -0,0 +1,223 @@
+// Package imageproc validates uploaded images and generates the renditions
+// served to the web and mobile clients.
+//
+// Every upload is decoded and re-encoded, which drops EXIF, GPS and any other
+// metadata embedded in the original file. The EXIF orientation is applied to
+// the pixels first so photos taken with a phone are not displayed sideways.
+package imageproc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"talodu/storage"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/disintegration/imaging"
+	_ "golang.org/x/image/webp" // registers the WebP decoder
+)
+
+const (
+	MaxUploadSize = 10 << 20 // 10 MB
+	MaxDimension  = 8000     // pixels, width or height
+	MinDimension  = 50
+	jpegQuality   = 85
+)
+
+// Rendition names
+const (
+	Original  = "original"
+	Thumbnail = "thumbnail"
+	Medium    = "medium"
+	Large     = "large"
+	WebP      = "webp"
+)
+
+// AllowedTypes are the MIME types accepted for uploads, detected from the file content
+var AllowedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// renditionSizes are the bounding boxes of the resized renditions. The
+// thumbnail is cropped to a square, the other ones keep the aspect ratio.
+var renditionSizes = map[string]int{
+	Thumbnail: 150,
+	Medium:    600,
+	Large:     1200,
+}
+
+// ValidationError is returned when the uploaded file is rejected, handlers
+// report it to the client with a 400.
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// Rendition is one encoded version of the uploaded image
+type Rendition struct {
+	Name   string
+	Ext    string
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// Result holds the renditions of a processed upload
+type Result struct {
+	MimeType   string // detected type of the uploaded file
+	Width      int    // size of the original image, after orientation
+	Height     int
+	Renditions []Rendition
+}
+
+// Process reads an uploaded image, validates it and builds its renditions
+func Process(r io.Reader) (*Result, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxUploadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if len(data) > MaxUploadSize {
+		return nil, &ValidationError{fmt.Sprintf("image exceeds the maximum size of %d MB", MaxUploadSize>>20)}
+	}
+
+	mimeType := http.DetectContentType(data)
+	if !AllowedTypes[mimeType] {
+		return nil, &ValidationError{fmt.Sprintf("unsupported file type %s, allowed types are JPEG, PNG, GIF and WebP", mimeType)}
+	}
+
+	// Check the dimensions from the header before decoding the whole image
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, &ValidationError{"image could not be decoded"}
+	}
+	if config.Width > MaxDimension || config.Height > MaxDimension {
+		return nil, &ValidationError{fmt.Sprintf("image is %dx%d, the maximum is %dx%d", config.Width, config.Height, MaxDimension, MaxDimension)}
+	}
+	if config.Width < MinDimension || config.Height < MinDimension {
+		return nil, &ValidationError{fmt.Sprintf("image is %dx%d, the minimum is %dx%d", config.Width, config.Height, MinDimension, MinDimension)}
+	}
+
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, &ValidationError{"image could not be decoded"}
+	}
+
+	bounds := img.Bounds()
+	result := &Result{
+		MimeType: mimeType,
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+	}
+
+	// PNG keeps transparency, everything else is stored as JPEG
+	format := imaging.JPEG
+	if mimeType == "image/png" || mimeType == "image/gif" || mimeType == "image/webp" {
+		format = imaging.PNG
+	}
+
+	original, err := encode(Original, img, format)
+	if err != nil {
+		return nil, err
+	}
+	result.Renditions = append(result.Renditions, original)
+
+	var large image.Image
+	for _, name := range []string{Thumbnail, Medium, Large} {
+		size := renditionSizes[name]
+		var resized image.Image
+		if name == Thumbnail {
+			resized = imaging.Fill(img, size, size, imaging.Center, imaging.Lanczos)
+		} else if bounds.Dx() > size || bounds.Dy() > size {
+			resized = imaging.Fit(img, size, size, imaging.Lanczos)
+		} else {
+			resized = img // never upscale
+		}
+		if name == Large {
+			large = resized
+		}
+
+		rendition, err := encode(name, resized, format)
+		if err != nil {
+			return nil, err
+		}
+		result.Renditions = append(result.Renditions, rendition)
+	}
+
+	webp, err := encode(WebP, large, -1)
+	if err != nil {
+		return nil, err
+	}
+	result.Renditions = append(result.Renditions, webp)
+
+	return result, nil
+}
+
+// encode encodes img in the given format, a negative format means WebP
+func encode(name string, img image.Image, format imaging.Format) (Rendition, error) {
+	var buf bytes.Buffer
+	var err error
+	var ext string
+
+	switch format {
+	case imaging.JPEG:
+		ext = ".jpg"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	case imaging.PNG:
+		ext = ".png"
+		err = png.Encode(&buf, img)
+	default:
+		ext = ".webp"
+		err = nativewebp.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		return Rendition{}, fmt.Errorf("failed to encode %s rendition: %w", name, err)
+	}
+
+	bounds := img.Bounds()
+	return Rendition{Name: name, Ext: ext, Width: bounds.Dx(), Height: bounds.Dy(), Data: buf.Bytes()}, nil
+}
+
+// Store puts the renditions in blob as <prefix>/<baseName>_<rendition><ext>,
+// the original keeps the plain <prefix>/<baseName><ext>. It returns the object
+// keys by rendition name and removes the objects already stored when one fails.
+func (r *Result) Store(ctx context.Context, blob storage.Blob, prefix, baseName string) (map[string]string, error) {
+	keys := make(map[string]string, len(r.Renditions))
+	for _, rendition := range r.Renditions {
+		key := prefix + "/" + baseName + "_" + rendition.Name + rendition.Ext
+		if rendition.Name == Original {
+			key = prefix + "/" + baseName + rendition.Ext
+		}
+
+		if err := blob.Put(ctx, key, bytes.NewReader(rendition.Data), int64(len(rendition.Data)), rendition.ContentType()); err != nil {
+			for _, stored := range keys {
+				_ = blob.Delete(ctx, stored)
+			}
+			return nil, fmt.Errorf("failed to store %s rendition: %w", rendition.Name, err)
+		}
+		keys[rendition.Name] = key
+	}
+	return keys, nil
+}
+
+// ContentType returns the MIME type of the encoded rendition
+func (r Rendition) ContentType() string {
+	switch r.Ext {
+	case ".jpg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	default:
+		return "image/webp"
+	}
+}
@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"talodu/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ApplyProductSchedules publishes the approved products whose publish_at
+// date has come and archives the published ones whose unpublish_at date
+// has come. The dates are cleared once applied, so that a product hidden or
+// shown by hand afterwards stays that way.
+func ApplyProductSchedules(ctx context.Context, db *gorm.DB) (published, archived int64, err error) {
+	now := time.Now()
+	db = db.WithContext(ctx)
+
+	result := db.Model(&models.Product{}).
+		Where("status = ? AND publish_at <= ?", models.ProductStatusPublished, now).
+		Updates(map[string]interface{}{"is_visible": true, "publish_at": nil})
+	if result.Error != nil {
+		return 0, 0, fmt.Errorf("failed to publish scheduled products: %w", result.Error)
+	}
+	published = result.RowsAffected
+
+	result = db.Model(&models.Product{}).
+		Where("status = ? AND unpublish_at <= ?", models.ProductStatusPublished, now).
+		Updates(map[string]interface{}{"status": models.ProductStatusArchived, "is_visible": false, "publish_at": nil, "unpublish_at": nil})
+	if result.Error != nil {
+		return published, 0, fmt.Errorf("failed to archive scheduled products: %w", result.Error)
+	}
+	return published, result.RowsAffected, nil
+}
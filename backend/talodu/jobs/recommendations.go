@@ -0,0 +1,88 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"talodu/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// recommendationsPerProduct is how many recommendations of each type are
+	// kept for a product
+	recommendationsPerProduct = 20
+	// recommendationViewWindow is the period of the views "customers also
+	// viewed" is computed from
+	recommendationViewWindow = 90 * 24 * time.Hour
+	// minSharedViewers is how many customers must have viewed two products
+	// for one to be recommended with the other, one visit is noise
+	minSharedViewers = 2
+)
+
+// boughtTogetherSQL counts the orders two products are in, cancelled orders
+// excluded
+const boughtTogetherSQL = `
+	SELECT a.product_id, b.product_id AS recommended_id, COUNT(DISTINCT a.order_id) AS score
+	FROM order_items a
+	JOIN order_items b ON b.order_id = a.order_id AND b.product_id <> a.product_id AND b.deleted_at IS NULL
+	JOIN orders ON orders.id = a.order_id AND orders.deleted_at IS NULL AND orders.status <> 'cancelled'
+	WHERE a.deleted_at IS NULL
+	GROUP BY a.product_id, b.product_id`
+
+// alsoViewedSQL counts the customers, users or anonymous sessions, who
+// viewed two products since the start of the window
+const alsoViewedSQL = `
+	WITH viewers AS (
+		SELECT DISTINCT product_id, COALESCE('u' || user_id, 's' || session_id) AS viewer
+		FROM product_views
+		WHERE viewed_at > @since
+	)
+	SELECT a.product_id, b.product_id AS recommended_id, COUNT(*) AS score
+	FROM viewers a
+	JOIN viewers b ON b.viewer = a.viewer AND b.product_id <> a.product_id
+	GROUP BY a.product_id, b.product_id
+	HAVING COUNT(*) >= @min_viewers`
+
+// RefreshRecommendations recomputes the "frequently bought together" and
+// "customers also viewed" recommendations. Each type is replaced in a
+// transaction, pages keep the previous recommendations until it commits.
+func RefreshRecommendations(ctx context.Context, db *gorm.DB) (counts map[models.RecommendationType]int64, err error) {
+	counts = make(map[models.RecommendationType]int64)
+	sources := []struct {
+		t    models.RecommendationType
+		sql  string
+		args map[string]interface{}
+	}{
+		{models.RecommendationBoughtTogether, boughtTogetherSQL, map[string]interface{}{}},
+		{models.RecommendationAlsoViewed, alsoViewedSQL, map[string]interface{}{
+			"since":       time.Now().Add(-recommendationViewWindow),
+			"min_viewers": minSharedViewers,
+		}},
+	}
+
+	for _, source := range sources {
+		source.args["type"] = string(source.t)
+		source.args["limit"] = recommendationsPerProduct
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("type = ?", source.t).Delete(&models.ProductRecommendation{}).Error; err != nil {
+				return err
+			}
+			// The best scores of each product
+			result := tx.Exec(`INSERT INTO product_recommendations (type, product_id, recommended_id, score, updated_at)
+				SELECT @type, product_id, recommended_id, score, NOW()
+				FROM (
+					SELECT pairs.*, ROW_NUMBER() OVER (PARTITION BY product_id ORDER BY score DESC, recommended_id) AS pair_rank
+					FROM (`+source.sql+`) pairs
+				) ranked
+				WHERE pair_rank <= @limit`, source.args)
+			counts[source.t] = result.RowsAffected
+			return result.Error
+		})
+		if err != nil {
+			return counts, fmt.Errorf("failed to refresh %s recommendations: %w", source.t, err)
+		}
+	}
+	return counts, nil
+}
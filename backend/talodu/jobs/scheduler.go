@@ -0,0 +1,76 @@
+// Package jobs runs the periodic background tasks of the API (garbage
+// collection, scheduled publications, ...). Jobs are registered with Every
+// before Start is called from main.
+package jobs
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+type job struct {
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context) error
+	delayed  bool // The first run waits for an interval
+}
+
+var (
+	mu         sync.Mutex
+	registered []job
+)
+
+// Every registers fn to run every interval, the first run happens at Start
+func Every(name string, interval time.Duration, fn func(ctx context.Context) error) {
+	mu.Lock()
+	defer mu.Unlock()
+	registered = append(registered, job{name: name, interval: interval, run: fn})
+}
+
+// EveryAfter registers fn like Every, but its first run happens one interval
+// after Start, for jobs that shouldn't run at every deployment
+func EveryAfter(name string, interval time.Duration, fn func(ctx context.Context) error) {
+	mu.Lock()
+	defer mu.Unlock()
+	registered = append(registered, job{name: name, interval: interval, run: fn, delayed: true})
+}
+
+// Start runs the registered jobs in the background until ctx is cancelled.
+// A job never overlaps with itself, a run taking longer than the interval
+// delays the next one.
+func Start(ctx context.Context) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, j := range registered {
+		go func(j job) {
+			ticker := time.NewTicker(j.interval)
+			defer ticker.Stop()
+			for first := true; ; first = false {
+				if !first || !j.delayed {
+					runJob(ctx, j)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(j)
+	}
+}
+
+func runJob(ctx context.Context, j job) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("job %s panicked: %v", j.name, r)
+		}
+	}()
+
+	started := time.Now()
+	if err := j.run(ctx); err != nil {
+		log.Printf("job %s failed after %s: %v", j.name, time.Since(started).Round(time.Millisecond), err)
+	}
+}
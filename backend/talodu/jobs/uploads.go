@@ -0,0 +1,185 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"talodu/storage"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultUploadsGracePeriod is how long unreferenced files and soft-deleted
+// image records are kept before the garbage collection removes them. It
+// protects uploads in progress and leaves time to restore deleted rows.
+const DefaultUploadsGracePeriod = 72 * time.Hour
+
+// UploadsGracePeriod returns the grace period set by UPLOADS_GC_GRACE_PERIOD
+// (a Go duration such as "48h"), or the default one
+func UploadsGracePeriod() time.Duration {
+	if period, err := time.ParseDuration(os.Getenv("UPLOADS_GC_GRACE_PERIOD")); err == nil && period > 0 {
+		return period
+	}
+	return DefaultUploadsGracePeriod
+}
+
+// uploadPrefixes are the storage prefixes owned by the image tables
+var uploadPrefixes = []string{"products/", "site/"}
+
+// uploadTables lists the key columns of the tables referencing stored files
+var uploadTables = []struct {
+	table   string
+	columns []string
+}{
+	{"product_images", []string{"key", "thumbnail_key", "medium_key", "large_key", "webp_key"}},
+	{"site_images", []string{"key", "thumbnail_key", "medium_key", "large_key", "webp_key"}},
+	{"site_logos", []string{"key"}},
+}
+
+// ErrUploadsNotMigrated is returned by ReconcileUploads while rows only
+// reference their files by the legacy url columns: these files would be taken
+// for orphans. Run `go run ./cmd/migrate-uploads` to fill the key columns.
+var ErrUploadsNotMigrated = errors.New("uploads are not migrated to storage keys")
+
+// UploadsGCOptions configures ReconcileUploads
+type UploadsGCOptions struct {
+	DryRun      bool
+	GracePeriod time.Duration
+}
+
+// UploadsGCReport is the result of a reconciliation
+type UploadsGCReport struct {
+	DryRun         bool                 `json:"dryRun"`
+	Cutoff         time.Time            `json:"cutoff"`
+	ScannedObjects int                  `json:"scannedObjects"`
+	Orphans        []storage.ObjectInfo `json:"orphans"`
+	OrphanBytes    int64                `json:"orphanBytes"`
+	DeletedObjects int                  `json:"deletedObjects"`
+	PurgedRecords  map[string]int64     `json:"purgedRecords"` // hard-deleted rows by table, or rows that would be
+	Errors         []string             `json:"errors,omitempty"`
+}
+
+// ReconcileUploads compares the stored files with the image tables. Files no
+// row references are orphans: they are reported, and deleted unless DryRun
+// is set, once they are older than the grace period. Rows soft-deleted before
+// the grace period, including the images of deleted products, are purged so
+// their files are collected too.
+func ReconcileUploads(ctx context.Context, db *gorm.DB, blob storage.Blob, opts UploadsGCOptions) (*UploadsGCReport, error) {
+	if opts.GracePeriod <= 0 {
+		opts.GracePeriod = DefaultUploadsGracePeriod
+	}
+	report := &UploadsGCReport{
+		DryRun:        opts.DryRun,
+		Cutoff:        time.Now().Add(-opts.GracePeriod),
+		Orphans:       []storage.ObjectInfo{},
+		PurgedRecords: make(map[string]int64),
+	}
+
+	if err := checkUploadsMigrated(db); err != nil {
+		return nil, err
+	}
+
+	// Files still referenced by a live row, or by a row deleted recently enough to be restored
+	referenced := make(map[string]bool)
+	for _, t := range uploadTables {
+		columns := make([]string, len(t.columns))
+		for i, column := range t.columns {
+			columns[i] = "t." + column
+		}
+
+		var rows []map[string]interface{}
+		query, deletedAt := uploadRows(db, t.table)
+		if err := query.Select(columns).Where("("+deletedAt+" IS NULL OR "+deletedAt+" > ?)", report.Cutoff).Find(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", t.table, err)
+		}
+		for _, row := range rows {
+			for _, column := range t.columns {
+				if key, ok := row[column].(string); ok && key != "" {
+					referenced[key] = true
+				}
+			}
+		}
+
+		var expired int64
+		query, deletedAt = uploadRows(db, t.table)
+		if err := query.Where(deletedAt+" <= ?", report.Cutoff).Count(&expired).Error; err != nil {
+			return nil, fmt.Errorf("failed to count deleted %s: %w", t.table, err)
+		}
+		report.PurgedRecords[t.table] = expired
+	}
+
+	for _, prefix := range uploadPrefixes {
+		objects, err := blob.List(ctx, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+		}
+		report.ScannedObjects += len(objects)
+
+		for _, object := range objects {
+			if referenced[object.Key] || object.LastModified.After(report.Cutoff) {
+				continue
+			}
+			report.Orphans = append(report.Orphans, object)
+			report.OrphanBytes += object.Size
+		}
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+
+	for _, object := range report.Orphans {
+		if err := blob.Delete(ctx, object.Key); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", object.Key, err))
+			continue
+		}
+		report.DeletedObjects++
+	}
+
+	// The files of the expired rows were collected above, the rows can go
+	if err := db.Exec(`UPDATE product_images SET deleted_at = p.deleted_at
+		FROM products p
+		WHERE p.id = product_images.product_id AND p.deleted_at IS NOT NULL AND product_images.deleted_at IS NULL`).Error; err != nil {
+		return report, fmt.Errorf("failed to delete images of deleted products: %w", err)
+	}
+	for _, t := range uploadTables {
+		result := db.Exec("DELETE FROM "+t.table+" WHERE deleted_at IS NOT NULL AND deleted_at <= ?", report.Cutoff)
+		if result.Error != nil {
+			return report, fmt.Errorf("failed to purge %s: %w", t.table, result.Error)
+		}
+		report.PurgedRecords[t.table] = result.RowsAffected
+	}
+
+	return report, nil
+}
+
+// checkUploadsMigrated fails with ErrUploadsNotMigrated while a row, deleted
+// or not, has a legacy url and no key, like those cmd/migrate-uploads copies
+func checkUploadsMigrated(db *gorm.DB) error {
+	for _, t := range uploadTables {
+		if !db.Migrator().HasColumn(t.table, "url") {
+			continue // Dropped once migrated
+		}
+		var legacy int64
+		if err := db.Table(t.table).Where("(key IS NULL OR key = '') AND url IS NOT NULL AND url <> ''").Count(&legacy).Error; err != nil {
+			return fmt.Errorf("failed to count legacy %s: %w", t.table, err)
+		}
+		if legacy > 0 {
+			return fmt.Errorf("%w: %d rows of %s", ErrUploadsNotMigrated, legacy, t.table)
+		}
+	}
+	return nil
+}
+
+// uploadRows queries all the rows of table, soft-deleted ones included, and
+// returns the expression of their deletion date
+func uploadRows(db *gorm.DB, table string) (*gorm.DB, string) {
+	query := db.Table(table + " AS t")
+	if table == "product_images" {
+		// Images of a deleted product are deleted with it
+		return query.Joins("LEFT JOIN products p ON p.id = t.product_id"), "COALESCE(t.deleted_at, p.deleted_at)"
+	}
+	return query, "t.deleted_at"
+}
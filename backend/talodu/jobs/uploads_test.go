@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestCheckUploadsMigrated(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Exec("CREATE TABLE product_images (id INTEGER PRIMARY KEY, url TEXT, key TEXT, deleted_at DATETIME)")
+	db.Exec("INSERT INTO product_images (id, url, key) VALUES (1, '', 'products/new.jpg')")
+	if err := checkUploadsMigrated(db); err != nil {
+		t.Fatalf("migrated rows: %v", err)
+	}
+
+	// A deleted row still references its file until it is purged
+	db.Exec("INSERT INTO product_images (id, url, deleted_at) VALUES (2, '/uploads/products/old.jpg', CURRENT_TIMESTAMP)")
+	if err := checkUploadsMigrated(db); !errors.Is(err, ErrUploadsNotMigrated) {
+		t.Fatalf("legacy row: error = %v, want ErrUploadsNotMigrated", err)
+	}
+
+	db.Exec("UPDATE product_images SET key = 'products/old.jpg' WHERE id = 2")
+	if err := checkUploadsMigrated(db); err != nil {
+		t.Errorf("after migrate-uploads: %v", err)
+	}
+}
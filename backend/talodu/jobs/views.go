@@ -0,0 +1,28 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"talodu/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// productViewRetention is how long the views of users are kept, longer
+	// than the window "customers also viewed" is computed from
+	productViewRetention = 180 * 24 * time.Hour
+	// anonymousViewRetention is how long the views of anonymous sessions are
+	// kept, most sessions are never seen again
+	anonymousViewRetention = 30 * 24 * time.Hour
+)
+
+// PruneProductViews deletes the product views past their retention
+func PruneProductViews(ctx context.Context, db *gorm.DB) (int64, error) {
+	pruned, err := models.PruneProductViews(db.WithContext(ctx), productViewRetention, anonymousViewRetention)
+	if err != nil {
+		return pruned, fmt.Errorf("failed to prune product views: %w", err)
+	}
+	return pruned, nil
+}
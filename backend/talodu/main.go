@@ -1,19 +1,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"strings"
+	"time"
 
 	"talodu/handlers"
+	"talodu/jobs"
 	"talodu/settings"
 	s "talodu/settings"
 
 	//_ "talodu/handlers"
 	"talodu/auth"
+	"talodu/i18n"
 	"talodu/models"
+	"talodu/storage"
+	"talodu/translate"
 
 	//_ "talodu/models"
 
@@ -41,6 +46,21 @@ func main() {
 		log.Fatalf("Error loading .env file: %v", err)
 	}
 
+	if err := storage.Init(); err != nil {
+		log.Fatalf("Failed to initialize file storage: %v", err)
+	}
+	if err := i18n.Init(); err != nil {
+		log.Fatalf("Failed to initialize languages: %v", err)
+	}
+	if err := translate.Init(); err != nil {
+		log.Fatalf("Failed to initialize machine translation: %v", err)
+	}
+
+	// AutoMigrate would cast prices in major units to integers
+	if err := models.CheckPriceColumns(s.DB); err != nil {
+		log.Fatalf("Prices are not converted to minor units: %v", err)
+	}
+
 	s.DB.AutoMigrate(
 		&Shop{},
 		&models.User{},
@@ -48,13 +68,41 @@ func main() {
 		&models.Product{},
 		&models.Category{},
 		&models.ProductImage{},
+		&models.ProductImageTranslation{},
 		&models.ProductTranslation{},
 		&models.ProductAbout{},
 		&settings.GlobalSettings{},
 		&settings.SiteImage{},
 		&settings.SiteLogo{},
+		&models.SearchSynonym{},
+		&models.SearchStopWord{},
+		&models.ImportJob{},
+		&models.Notification{},
+		&models.PriceHistory{},
+		&models.AttributeDefinition{},
+		&models.AttributeDefinitionTranslation{},
+		&models.ProductAttributeValue{},
+		&models.ProductAttributeValueTranslation{},
+		&models.ProductQuestion{},
+		&models.ProductAnswer{},
+		&models.QAVote{},
+		&models.SlugHistory{},
+		&models.CategoryTranslation{},
+		&models.ExchangeRate{},
+		&models.ProductView{},
+		&models.ProductRecommendation{},
+		&models.Collection{},
+		&models.CollectionTranslation{},
+		&models.CollectionItem{},
+		&models.BundleComponent{},
 	)
 
+	// Imports run in the server process, those it was running when it stopped won't finish
+	handlers.FailInterruptedImports(s.DB)
+
+	// Cached product feeds are regenerated once the catalogue changes
+	handlers.RegisterFeedInvalidation(s.DB)
+
 	if err := s.DB.AutoMigrate(&settings.GlobalSettings{}); err != nil {
 		//log.Fatal("Failed to migrate GlobalSettings:", err)
 		log.Println("Failed to migrate GlobalSettings:", err)
@@ -89,7 +137,7 @@ func main() {
 			if origin == allowedOrigin {
 				c.Writer.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
 				c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-				c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+				c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+auth.SessionHeader)
 				c.Writer.Header().Set("Access-Control-Allow-Credentials", "true") // If using cookies
 
 				if c.Request.Method == "OPTIONS" {
@@ -102,6 +150,12 @@ func main() {
 		c.Next()
 	})
 
+	// Language of the responses, see i18n.Language
+	i18n.UserLanguage = handlers.UserLanguage(s.DB)
+	r.Use(i18n.Middleware())
+	r.GET("/languages", handlers.GetLanguages())
+	r.GET("/currencies", handlers.ListCurrencies(s.DB))
+
 	// Auth routes
 	r.POST("/register", auth.RegisterUser(s.DB))
 	r.POST("/user", auth.CreateUser(s.DB))
@@ -132,6 +186,39 @@ func main() {
 		admin.POST("/site-logos", settings.UploadSiteLogos(s.DB))
 		admin.PUT("/site-logos/:id/primary", settings.SetPrimaryLogo(s.DB))
 		admin.DELETE("/site-logos/:id", settings.DeleteSiteLogo(s.DB))
+
+		// Search synonyms and stop words routes
+		admin.GET("/search/synonyms", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.ListSearchSynonyms(s.DB))
+		admin.POST("/search/synonyms", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.CreateSearchSynonym(s.DB))
+		admin.PUT("/search/synonyms/:id", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.UpdateSearchSynonym(s.DB))
+		admin.DELETE("/search/synonyms/:id", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.DeleteSearchSynonym(s.DB))
+		admin.GET("/search/stopwords", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.ListSearchStopWords(s.DB))
+		admin.POST("/search/stopwords", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.CreateSearchStopWords(s.DB))
+		admin.DELETE("/search/stopwords/:id", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.DeleteSearchStopWord(s.DB))
+
+		// Missing translations per shop and language
+		admin.GET("/translations/report", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.GetTranslationReport(s.DB))
+
+		// Exchange rates of the prices shown in other currencies
+		admin.GET("/exchange-rates", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.ListExchangeRates(s.DB))
+		admin.PUT("/exchange-rates", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.UpsertExchangeRate(s.DB))
+		admin.POST("/exchange-rates/import", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.ImportExchangeRates(s.DB))
+		admin.DELETE("/exchange-rates/:id", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.DeleteExchangeRate(s.DB))
+
+		// Uploads garbage collection
+		admin.GET("/uploads/orphans", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.ListOrphanUploads(s.DB))
+		admin.POST("/uploads/gc", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.CollectOrphanUploads(s.DB))
+
+		// Merchandising collections
+		admin.GET("/collections", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.ListCollectionsAdmin(s.DB))
+		admin.POST("/collections", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.CreateCollection(s.DB))
+		admin.PUT("/collections/:id", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.UpdateCollection(s.DB))
+		admin.DELETE("/collections/:id", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.DeleteCollection(s.DB))
+		admin.PUT("/collections/:id/translations", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.UpsertCollectionTranslation(s.DB))
+		admin.GET("/collections/:id/items", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.ListCollectionItems(s.DB))
+		admin.POST("/collections/:id/items", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.AddCollectionItems(s.DB))
+		admin.PUT("/collections/:id/items/order", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.UpdateCollectionItemOrder(s.DB))
+		admin.DELETE("/collections/:id/items/:productId", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.RemoveCollectionItem(s.DB))
 	}
 
 	// Protected routes
@@ -139,6 +226,9 @@ func main() {
 	{
 		products.GET("", handlers.ListProducts(s.DB))
 		products.GET("/admin", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.ListProductsAdmin(s.DB))
+		products.GET("/lookup", auth.AuthMiddleware(), handlers.LookupProduct(s.DB)) // Find products by scanned barcode
+		products.GET("/facets", handlers.GetProductFacets(s.DB))                     // Attribute filters of a category
+		products.GET("/compare", handlers.CompareProducts(s.DB))                     // Side by side comparison
 		products.POST("", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.CreateProduct(s.DB))
 		products.DELETE(":id", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.DeleteProduct(s.DB))
 		products.DELETE("/delete/batch", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.DeleteProductBatch(s.DB))
@@ -151,14 +241,33 @@ func main() {
 		products.PUT("/images/:imageId/primary", auth.AuthMiddleware(), handlers.SetPrimaryImage(s.DB))
 		products.PUT("/images/:imageId/visibility", auth.AuthMiddleware(), handlers.ToggleImageVisibility(s.DB))
 		products.DELETE("/images/:imageId", auth.AuthMiddleware(), handlers.DeleteProductImage(s.DB))
+		products.PUT("/images/order/:id", auth.AuthMiddleware(), handlers.UpdateProductImageOrder(s.DB))
+		products.PUT("/images/:imageId/variant", auth.AuthMiddleware(), handlers.SetImageVariant(s.DB))
+		products.GET("/images/:imageId/translations", handlers.GetProductImageTranslations(s.DB))
+		products.PUT("/images/:imageId/translations", auth.AuthMiddleware(), handlers.UpsertProductImageTranslation(s.DB))
 
 		products.GET(":id", handlers.GetAdminProduct(s.DB))            // Get single product for admin
 		products.GET(":id/related", handlers.GetRelatedProducts(s.DB)) // Get related product
+		products.GET("/:id/recommendations", handlers.GetProductRecommendations(s.DB))
 
 		products.GET("/featured", handlers.GetFeaturedProducts(s.DB))
-		products.PUT("/:id/featured", handlers.ToggleFeaturedProduct(s.DB))
+		products.PUT("/:id/featured", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.ToggleFeaturedProduct(s.DB))
+
+		products.PUT("/:id/visibility", auth.AuthMiddleware(), handlers.ToggleProductVisibility(s.DB)) // Toggle visibilit
 
-		products.PUT("/:id/visibility", handlers.ToggleProductVisibility(s.DB)) // Toggle visibilit
+		// Publication workflow: draft -> pending_review -> published -> archived
+		products.POST("/:id/submit", auth.AuthMiddleware(), handlers.SubmitProduct(s.DB))
+		products.POST("/:id/approve", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.ApproveProduct(s.DB))
+		products.POST("/:id/reject", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.RejectProduct(s.DB))
+		products.POST("/:id/archive", auth.AuthMiddleware(), handlers.ArchiveProduct(s.DB))
+		products.POST("/:id/draft", auth.AuthMiddleware(), handlers.ReturnProductToDraft(s.DB))
+		products.PUT("/:id/schedule", auth.AuthMiddleware(), handlers.ScheduleProduct(s.DB))
+		products.POST("/:id/clone", auth.AuthMiddleware(), handlers.CloneProduct(s.DB))
+		products.POST("/:id/translations/machine", auth.AuthMiddleware(), handlers.MachineTranslateProduct(s.DB))
+
+		products.PUT("/:id/sale", auth.AuthMiddleware(), handlers.SetProductSale(s.DB))
+		products.PUT("/:id/bundle", auth.AuthMiddleware(), handlers.SetProductBundle(s.DB)) // Components of a bundle
+		products.GET("/:id/price-history", handlers.GetProductPriceHistory(s.DB))
 
 		products.GET("/abouts/:productId", handlers.GetProductAbouts(s.DB))
 		products.PUT(":id", auth.AuthMiddleware(), handlers.UpdateProduct(s.DB)) // Update
@@ -172,8 +281,38 @@ func main() {
 		// Update a translation
 		products.PUT("/:id/abouts/:aboutId/translations/:translationId",
 			auth.AuthMiddleware(), handlers.UpdateProductAboutTranslation(s.DB))
+
+		// Questions and answers
+		products.GET("/:id/questions", handlers.ListProductQuestions(s.DB))
+		products.POST("/:id/questions", auth.AuthMiddleware(), handlers.AskProductQuestion(s.DB))
+		products.DELETE("/questions/:questionId", auth.AuthMiddleware(), handlers.DeleteProductQuestion(s.DB))
+		products.POST("/questions/:questionId/answers", auth.AuthMiddleware(), handlers.AnswerProductQuestion(s.DB))
+		products.POST("/questions/:questionId/vote", auth.AuthMiddleware(), handlers.VoteProductQuestion(s.DB))
+		products.PUT("/questions/:questionId/moderation", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.ModerateProductQuestion(s.DB))
+		products.DELETE("/answers/:answerId", auth.AuthMiddleware(), handlers.DeleteProductAnswer(s.DB))
+		products.POST("/answers/:answerId/vote", auth.AuthMiddleware(), handlers.VoteProductAnswer(s.DB))
+		products.PUT("/answers/:answerId/moderation", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.ModerateProductAnswer(s.DB))
+	}
+
+	// Current user routes
+	me := r.Group("/me")
+	me.Use(auth.AuthMiddleware())
+	{
+		me.GET("/notifications", handlers.ListNotifications(s.DB))
+		me.PUT("/notifications/read", handlers.MarkAllNotificationsRead(s.DB))
+		me.PUT("/notifications/:id/read", handlers.MarkNotificationRead(s.DB))
+		me.PUT("/language", handlers.UpdateMyLanguage(s.DB))
 	}
 
+	// Merchandising collections of the storefront slots
+	r.GET("/collections", handlers.ListCollections(s.DB))
+	r.GET("/collections/:slug", handlers.GetCollection(s.DB))
+
+	// Signed-in users or anonymous sessions, see handlers.requestViewer
+	r.GET("/me/recently-viewed", handlers.ListRecentlyViewed(s.DB))
+	r.DELETE("/me/recently-viewed", handlers.ClearRecentlyViewed(s.DB))
+	r.GET("/me/recommendations", handlers.GetMyRecommendations(s.DB))
+
 	// Cart routes
 	cartRoutes := r.Group("/cart")
 	cartRoutes.Use(auth.AuthMiddleware()) // All cart routes require authentication
@@ -205,13 +344,31 @@ func main() {
 	// Get product categories
 	r.GET("/categories", func(c *gin.Context) {
 		var categories []Category
-		if err := s.DB.Find(&categories).Error; err != nil {
+		if err := s.DB.Preload("Translations").Find(&categories).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
 			return
 		}
+		lang := i18n.Language(c)
+		for i := range categories {
+			categories[i].Localize(lang)
+		}
 		c.JSON(http.StatusOK, categories)
 	})
 
+	// Category translations
+	r.PUT("/categories/:id/translations", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.UpsertCategoryTranslation(s.DB))
+	r.POST("/categories/:id/translations/machine", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.MachineTranslateCategory(s.DB))
+
+	// Attributes of the products of a category
+	categories := r.Group("/categories/:id/attributes")
+	{
+		categories.GET("", handlers.ListCategoryAttributes(s.DB))
+		categories.POST("", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.CreateCategoryAttribute(s.DB))
+		categories.PUT("/:attributeId", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.UpdateCategoryAttribute(s.DB))
+		categories.DELETE("/:attributeId", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.DeleteCategoryAttribute(s.DB))
+		categories.PUT("/:attributeId/translations", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.UpsertAttributeTranslation(s.DB))
+	}
+
 	// Initialize WhatsApp service
 	whatsappService := auth.InitWhatsAppService(s.DB)
 
@@ -231,27 +388,8 @@ func main() {
 
 	handlers.SetupProductImageRoutes(r, s.DB)
 
-	// In your routes
-	r.GET("/products/ps/:slug", func(c *gin.Context) {
-		slug := c.Param("slug")
-
-		// Extract ID from slug (last part after last hyphen)
-		parts := strings.Split(slug, "-")
-		productID := parts[len(parts)-1]
-
-		var product Product
-		if err := s.DB.Where("id = ?", productID).First(&product).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
-			return
-		}
-		// Verify the slug matches (redirect if not)
-		if product.Slug != slug {
-			c.Redirect(http.StatusMovedPermanently, "/products/"+product.Slug)
-			return
-		}
-
-		c.JSON(http.StatusOK, product)
-	})
+	// Product and shop pages by slug, former slugs redirect to the current one
+	r.GET("/products/ps/:slug", handlers.GetProductBySlug(s.DB))
 
 	shops := r.Group("/shops")
 	{
@@ -259,13 +397,24 @@ func main() {
 		shops.POST("/:id/employees", auth.AuthMiddleware(), handlers.AddShopEmployee2(s.DB))
 		shops.GET("", auth.AuthMiddleware(), handlers.ListShops(s.DB))
 		shops.GET("/all", auth.AuthMiddleware("Admin", "SuperAdmin"), handlers.ListShops(s.DB))
+		shops.GET("/s/:slug", handlers.GetShopBySlug(s.DB))
 		shops.GET(":id", handlers.GetShop(s.DB))
 		shops.PUT(":id", handlers.UpdateShop(s.DB))
 		shops.GET(":id/products", handlers.GetShopProducts(s.DB))
+		shops.POST(":id/products/import", auth.AuthMiddleware(), handlers.ImportShopProducts(s.DB))
+		shops.GET(":id/products/import/:jobId", auth.AuthMiddleware(), handlers.GetProductImportJob(s.DB))
+		shops.GET(":id/products/export", auth.AuthMiddleware(), handlers.ExportShopProducts(s.DB))
 		shops.DELETE("/:id", auth.AuthMiddleware(), handlers.DeleteShop(s.DB))
 	}
 
-	r.Static("/uploads", "./uploads")
+	// Product feeds for Google Merchant Center and Facebook catalogues
+	r.GET("/feeds/google.xml", handlers.GetGoogleProductFeed(s.DB))
+	r.GET("/feeds/facebook.csv", handlers.GetFacebookProductFeed(s.DB))
+
+	// Files of the local storage driver are served by the API, S3 serves its own
+	if local, ok := storage.Default.(*storage.Local); ok {
+		r.GET("/uploads/*key", gin.WrapH(http.StripPrefix("/uploads", local.Handler())))
+	}
 
 	auth.SetupRolesRoutes(r, s.DB)     // roles route
 	handlers.SetupUsersRoutes(r, s.DB) // users route
@@ -315,6 +464,39 @@ func main() {
 		})
 	})
 
+	// Background jobs
+	// Not at startup: a deployment must not collect files before cmd/migrate-uploads ran
+	jobs.EveryAfter("uploads-gc", 24*time.Hour, func(ctx context.Context) error {
+		report, err := jobs.ReconcileUploads(ctx, s.DB, storage.Default, jobs.UploadsGCOptions{GracePeriod: jobs.UploadsGracePeriod()})
+		if err == nil {
+			log.Printf("uploads-gc: %d orphaned files deleted, purged records: %v", report.DeletedObjects, report.PurgedRecords)
+		}
+		return err
+	})
+	jobs.Every("product-schedule", time.Minute, func(ctx context.Context) error {
+		published, archived, err := jobs.ApplyProductSchedules(ctx, s.DB)
+		if published > 0 || archived > 0 {
+			log.Printf("product-schedule: %d products published, %d archived", published, archived)
+		}
+		return err
+	})
+	jobs.Every("product-views", 24*time.Hour, func(ctx context.Context) error {
+		pruned, err := jobs.PruneProductViews(ctx, s.DB)
+		if pruned > 0 {
+			log.Printf("product-views: %d old views pruned", pruned)
+		}
+		return err
+	})
+	jobs.Every("recommendations", 6*time.Hour, func(ctx context.Context) error {
+		counts, err := jobs.RefreshRecommendations(ctx, s.DB)
+		if err == nil {
+			log.Printf("recommendations: %d bought together, %d also viewed",
+				counts[models.RecommendationBoughtTogether], counts[models.RecommendationAlsoViewed])
+		}
+		return err
+	})
+	jobs.Start(context.Background())
+
 	//r.Run() // listen and serve on 0.0.0.0:8080
 	r.Run(":8888")
 
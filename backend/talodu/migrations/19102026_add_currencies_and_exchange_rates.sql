@@ -0,0 +1,22 @@
+ALTER TABLE shops ADD COLUMN currency VARCHAR(3);
+
+ALTER TABLE orders ADD COLUMN currency VARCHAR(3);
+ALTER TABLE order_items ADD COLUMN shop_currency VARCHAR(3);
+ALTER TABLE order_items ADD COLUMN shop_price DOUBLE PRECISION;
+ALTER TABLE order_items ADD COLUMN exchange_rate DOUBLE PRECISION DEFAULT 1;
+
+-- Orders placed before were in the site currency, at the shop price
+UPDATE orders SET currency = COALESCE((SELECT currency FROM global_settings WHERE deleted_at IS NULL ORDER BY id LIMIT 1), 'USD') WHERE currency IS NULL;
+UPDATE order_items SET shop_currency = orders.currency, shop_price = order_items.price_at_time, exchange_rate = 1
+FROM orders WHERE orders.id = order_items.order_id AND order_items.shop_currency IS NULL;
+
+CREATE TABLE exchange_rates (
+    id SERIAL PRIMARY KEY,
+    from_currency VARCHAR(3) NOT NULL,
+    to_currency VARCHAR(3) NOT NULL,
+    rate DOUBLE PRECISION NOT NULL,
+    updated_by_id INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_exchange_rates_pair ON exchange_rates(from_currency, to_currency);
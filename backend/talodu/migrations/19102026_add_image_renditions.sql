@@ -0,0 +1,15 @@
+-- Renditions generated for uploaded images
+ALTER TABLE product_images ADD COLUMN thumbnail_url VARCHAR(500);
+ALTER TABLE product_images ADD COLUMN medium_url VARCHAR(500);
+ALTER TABLE product_images ADD COLUMN large_url VARCHAR(500);
+ALTER TABLE product_images ADD COLUMN webp_url VARCHAR(500);
+ALTER TABLE product_images ADD COLUMN width INTEGER;
+ALTER TABLE product_images ADD COLUMN height INTEGER;
+ALTER TABLE product_images ADD COLUMN mime_type VARCHAR(50);
+
+ALTER TABLE site_images ADD COLUMN thumbnail_url VARCHAR(500);
+ALTER TABLE site_images ADD COLUMN medium_url VARCHAR(500);
+ALTER TABLE site_images ADD COLUMN large_url VARCHAR(500);
+ALTER TABLE site_images ADD COLUMN webp_url VARCHAR(500);
+ALTER TABLE site_images ADD COLUMN width INTEGER;
+ALTER TABLE site_images ADD COLUMN height INTEGER;
@@ -0,0 +1,49 @@
+CREATE TABLE attribute_definitions (
+    id SERIAL PRIMARY KEY,
+    category_id INTEGER NOT NULL,
+    code VARCHAR(64) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    unit VARCHAR(20) NOT NULL DEFAULT '',
+    options JSONB,
+    required BOOLEAN DEFAULT FALSE,
+    filterable BOOLEAN DEFAULT TRUE,
+    position INTEGER DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_attribute_definitions_category_code ON attribute_definitions(category_id, code);
+
+CREATE TABLE attribute_definition_translations (
+    id SERIAL PRIMARY KEY,
+    attribute_definition_id INTEGER NOT NULL REFERENCES attribute_definitions(id) ON DELETE CASCADE,
+    language VARCHAR(5) NOT NULL,
+    name VARCHAR(100),
+    option_labels JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_attribute_definition_translations_lang ON attribute_definition_translations(attribute_definition_id, language);
+
+CREATE TABLE product_attribute_values (
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    attribute_definition_id INTEGER NOT NULL REFERENCES attribute_definitions(id) ON DELETE CASCADE,
+    value VARCHAR(255) NOT NULL DEFAULT '',
+    number_value DOUBLE PRECISION,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_product_attribute_values_product_attribute ON product_attribute_values(product_id, attribute_definition_id);
+CREATE INDEX idx_product_attribute_values_attribute_definition_id ON product_attribute_values(attribute_definition_id);
+CREATE INDEX idx_product_attribute_values_value ON product_attribute_values(value);
+
+CREATE TABLE product_attribute_value_translations (
+    id SERIAL PRIMARY KEY,
+    product_attribute_value_id INTEGER NOT NULL REFERENCES product_attribute_values(id) ON DELETE CASCADE,
+    language VARCHAR(5) NOT NULL,
+    value VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_product_attribute_value_translations_lang ON product_attribute_value_translations(product_attribute_value_id, language);
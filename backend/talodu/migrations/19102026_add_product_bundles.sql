@@ -0,0 +1,22 @@
+ALTER TABLE products ADD COLUMN type VARCHAR(20) DEFAULT 'simple';
+
+CREATE TABLE bundle_components (
+    id SERIAL PRIMARY KEY,
+    bundle_id INTEGER NOT NULL,
+    component_id INTEGER NOT NULL,
+    quantity INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_bundle_components_component ON bundle_components(bundle_id, component_id);
+CREATE INDEX idx_bundle_components_component_id ON bundle_components(component_id);
+
+-- What the bundles of the orders were made of
+CREATE TABLE order_item_components (
+    id SERIAL PRIMARY KEY,
+    order_item_id INTEGER,
+    product_id INTEGER,
+    name TEXT,
+    sku VARCHAR(64),
+    quantity INTEGER
+);
+CREATE INDEX idx_order_item_components_order_item_id ON order_item_components(order_item_id);
@@ -0,0 +1,9 @@
+-- EAN/UPC barcode of the product, validated by the API
+ALTER TABLE products ADD COLUMN gtin VARCHAR(14);
+CREATE INDEX idx_products_gtin ON products(gtin);
+-- Scanned barcodes are compared as GTIN-14, a UPC-A then matches its EAN-13 form
+CREATE INDEX idx_products_gtin14 ON products(LPAD(gtin, 14, '0'));
+
+-- SKUs are unique within a shop, duplicates must be renamed before running this
+DROP INDEX IF EXISTS idx_products_sku;
+CREATE UNIQUE INDEX idx_products_shop_sku ON products(shop_id, sku) WHERE sku <> '' AND deleted_at IS NULL;
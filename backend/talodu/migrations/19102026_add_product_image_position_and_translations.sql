@@ -0,0 +1,24 @@
+-- Explicit gallery order, existing images keep their upload order
+ALTER TABLE product_images ADD COLUMN position INTEGER DEFAULT 0;
+UPDATE product_images SET position = ranked.position
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY product_id ORDER BY is_primary DESC, created_at ASC) AS position
+    FROM product_images
+) AS ranked
+WHERE ranked.id = product_images.id;
+CREATE INDEX idx_product_images_position ON product_images(position);
+
+-- Images restricted to one variant and/or colour of the product
+ALTER TABLE product_images ADD COLUMN variant VARCHAR(100);
+ALTER TABLE product_images ADD COLUMN color VARCHAR(50);
+
+-- Alt text per language
+CREATE TABLE product_image_translations (
+    id SERIAL PRIMARY KEY,
+    product_image_id INTEGER NOT NULL REFERENCES product_images(id) ON DELETE CASCADE,
+    language VARCHAR(5) NOT NULL,
+    alt_text VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_product_image_translations_image_lang ON product_image_translations(product_image_id, language);
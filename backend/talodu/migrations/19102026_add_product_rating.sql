@@ -0,0 +1,2 @@
+-- Average customer rating, used to sort product lists (?sort=-rating)
+ALTER TABLE products ADD COLUMN rating DOUBLE PRECISION DEFAULT 0;
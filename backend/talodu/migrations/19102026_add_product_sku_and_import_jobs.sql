@@ -0,0 +1,27 @@
+-- Seller's product reference, products are matched by SKU on import
+ALTER TABLE products ADD COLUMN sku VARCHAR(64);
+CREATE INDEX idx_products_sku ON products(sku);
+
+-- Source of the images downloaded by an import, to skip them on re-import
+ALTER TABLE product_images ADD COLUMN source_url VARCHAR(1000);
+
+CREATE TABLE import_jobs (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    shop_id INTEGER NOT NULL,
+    user_id INTEGER,
+    filename VARCHAR(255),
+    status VARCHAR(20) DEFAULT 'pending',
+    total_rows INTEGER DEFAULT 0,
+    processed_rows INTEGER DEFAULT 0,
+    created_count INTEGER DEFAULT 0,
+    updated_count INTEGER DEFAULT 0,
+    failed_count INTEGER DEFAULT 0,
+    errors JSONB,
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX idx_import_jobs_shop_id ON import_jobs(shop_id);
+CREATE INDEX idx_import_jobs_deleted_at ON import_jobs(deleted_at);
@@ -0,0 +1,25 @@
+-- Product lifecycle, the products that already exist are published
+ALTER TABLE products ADD COLUMN status VARCHAR(20) DEFAULT 'published';
+UPDATE products SET status = 'published' WHERE status IS NULL;
+CREATE INDEX idx_products_status ON products(status);
+ALTER TABLE products ADD COLUMN publish_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE products ADD COLUMN unpublish_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE products ADD COLUMN submitted_by_id INTEGER;
+ALTER TABLE products ADD COLUMN reviewed_by_id INTEGER;
+ALTER TABLE products ADD COLUMN reviewed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE products ADD COLUMN rejection_reason VARCHAR(1000);
+
+CREATE TABLE notifications (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    user_id INTEGER NOT NULL,
+    type VARCHAR(50),
+    title VARCHAR(255),
+    message TEXT,
+    link VARCHAR(500),
+    read_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX idx_notifications_user_id ON notifications(user_id);
+CREATE INDEX idx_notifications_deleted_at ON notifications(deleted_at);
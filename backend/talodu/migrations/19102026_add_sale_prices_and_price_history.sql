@@ -0,0 +1,19 @@
+ALTER TABLE products ADD COLUMN sale_price DOUBLE PRECISION;
+ALTER TABLE products ADD COLUMN sale_starts_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE products ADD COLUMN sale_ends_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE price_histories (
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL,
+    price DOUBLE PRECISION NOT NULL,
+    sale_price DOUBLE PRECISION,
+    sale_starts_at TIMESTAMP WITH TIME ZONE,
+    sale_ends_at TIMESTAMP WITH TIME ZONE,
+    changed_by_id INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_price_histories_product_date ON price_histories(product_id, created_at);
+
+-- The current prices start the history of the existing products
+INSERT INTO price_histories (product_id, price, created_at)
+SELECT id, price, created_at FROM products WHERE deleted_at IS NULL;
@@ -0,0 +1,14 @@
+ALTER TABLE product_translations ADD COLUMN draft BOOLEAN DEFAULT FALSE;
+ALTER TABLE product_about_translations ADD COLUMN draft BOOLEAN DEFAULT FALSE;
+
+CREATE TABLE category_translations (
+    id SERIAL PRIMARY KEY,
+    category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    language VARCHAR(5) NOT NULL,
+    name TEXT,
+    description TEXT,
+    draft BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_category_translations_lang ON category_translations(category_id, language);
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN preferred_language VARCHAR(10);
@@ -0,0 +1,62 @@
+-- Prices and totals become integer amounts of minor units of their currency
+-- (cents for EUR, francs for XAF), see package money. Run it before starting
+-- the new version: AutoMigrate would otherwise change the column types
+-- without converting the amounts, the server refuses to start until then
+-- (see models.CheckPriceColumns).
+
+CREATE FUNCTION pg_temp.minor_units(amount NUMERIC, code TEXT) RETURNS BIGINT AS $$
+    SELECT ROUND(amount * (CASE code
+        WHEN 'BHD' THEN 1000 WHEN 'IQD' THEN 1000 WHEN 'JOD' THEN 1000 WHEN 'KWD' THEN 1000
+        WHEN 'LYD' THEN 1000 WHEN 'OMR' THEN 1000 WHEN 'TND' THEN 1000
+        WHEN 'BIF' THEN 1 WHEN 'CLP' THEN 1 WHEN 'DJF' THEN 1 WHEN 'GNF' THEN 1 WHEN 'ISK' THEN 1
+        WHEN 'JPY' THEN 1 WHEN 'KMF' THEN 1 WHEN 'KRW' THEN 1 WHEN 'PYG' THEN 1 WHEN 'RWF' THEN 1
+        WHEN 'UGX' THEN 1 WHEN 'VND' THEN 1 WHEN 'VUV' THEN 1 WHEN 'XAF' THEN 1 WHEN 'XOF' THEN 1
+        WHEN 'XPF' THEN 1 ELSE 100 END))::BIGINT
+$$ LANGUAGE SQL IMMUTABLE;
+
+CREATE FUNCTION pg_temp.site_currency() RETURNS TEXT AS $$
+    SELECT COALESCE((SELECT NULLIF(UPPER(TRIM(currency)), '') FROM global_settings WHERE deleted_at IS NULL ORDER BY id LIMIT 1), 'USD')
+$$ LANGUAGE SQL STABLE;
+
+-- Products keep the currency of their shop, prices were in it until now
+ALTER TABLE products ADD COLUMN currency VARCHAR(3);
+UPDATE products SET currency = COALESCE(
+    (SELECT NULLIF(UPPER(TRIM(shops.currency)), '') FROM shops WHERE shops.id = products.shop_id),
+    pg_temp.site_currency());
+ALTER TABLE products
+    ALTER COLUMN price TYPE BIGINT USING pg_temp.minor_units(price, currency),
+    ALTER COLUMN sale_price TYPE BIGINT USING pg_temp.minor_units(sale_price, currency);
+
+ALTER TABLE price_histories ADD COLUMN currency VARCHAR(3);
+UPDATE price_histories SET currency = COALESCE(
+    (SELECT products.currency FROM products WHERE products.id = price_histories.product_id),
+    pg_temp.site_currency());
+ALTER TABLE price_histories
+    ALTER COLUMN price TYPE BIGINT USING pg_temp.minor_units(price, currency),
+    ALTER COLUMN sale_price TYPE BIGINT USING pg_temp.minor_units(sale_price, currency);
+
+-- Cart snapshots were in the currency of the product, or the site currency for deleted products
+ALTER TABLE cart_items ADD COLUMN currency VARCHAR(3);
+UPDATE cart_items SET currency = COALESCE(
+    (SELECT products.currency FROM products WHERE products.id = cart_items.product_id),
+    pg_temp.site_currency());
+ALTER TABLE cart_items ALTER COLUMN price TYPE BIGINT USING pg_temp.minor_units(price, currency);
+
+ALTER TABLE shared_cart_items ADD COLUMN currency VARCHAR(3);
+UPDATE shared_cart_items SET currency = COALESCE(
+    (SELECT products.currency FROM products WHERE products.id = shared_cart_items.product_id),
+    pg_temp.site_currency());
+ALTER TABLE shared_cart_items ALTER COLUMN price_at_share TYPE BIGINT USING pg_temp.minor_units(price_at_share, currency);
+
+-- Order amounts are in the currency of the order
+UPDATE orders SET currency = pg_temp.site_currency() WHERE currency IS NULL OR currency = '';
+ALTER TABLE orders
+    ALTER COLUMN total_amount TYPE BIGINT USING pg_temp.minor_units(total_amount, currency),
+    ALTER COLUMN payment_amount TYPE BIGINT USING pg_temp.minor_units(payment_amount, currency);
+
+ALTER TABLE order_items ADD COLUMN currency VARCHAR(3);
+UPDATE order_items SET currency = orders.currency FROM orders WHERE orders.id = order_items.order_id;
+UPDATE order_items SET shop_currency = currency WHERE shop_currency IS NULL OR shop_currency = '';
+ALTER TABLE order_items
+    ALTER COLUMN price_at_time TYPE BIGINT USING pg_temp.minor_units(price_at_time, currency),
+    ALTER COLUMN shop_price TYPE BIGINT USING pg_temp.minor_units(shop_price, shop_currency);
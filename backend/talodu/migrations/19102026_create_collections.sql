@@ -0,0 +1,45 @@
+CREATE TABLE collections (
+    id SERIAL PRIMARY KEY,
+    slug VARCHAR(100) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    slot VARCHAR(30),
+    category_id INTEGER,
+    mode VARCHAR(10) DEFAULT 'manual',
+    rule JSONB,
+    position INTEGER DEFAULT 0,
+    is_active BOOLEAN DEFAULT TRUE,
+    starts_at TIMESTAMP WITH TIME ZONE,
+    ends_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_collections_slot ON collections(slot, category_id);
+
+CREATE TABLE collection_translations (
+    id SERIAL PRIMARY KEY,
+    collection_id INTEGER REFERENCES collections(id) ON DELETE CASCADE,
+    language VARCHAR(5),
+    name VARCHAR(255),
+    description TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_collection_translations_lang ON collection_translations(collection_id, language);
+
+CREATE TABLE collection_items (
+    id SERIAL PRIMARY KEY,
+    collection_id INTEGER NOT NULL,
+    product_id INTEGER NOT NULL,
+    position INTEGER DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_collection_items_product ON collection_items(collection_id, product_id);
+
+-- The featured products become the homepage hero, in their order
+INSERT INTO collections (slug, name, slot, mode, rule, is_active)
+VALUES ('homepage-hero', 'Featured Products You''ll Love', 'homepage_hero', 'manual', '{}', TRUE);
+INSERT INTO collection_items (collection_id, product_id, position)
+SELECT c.id, p.id, ROW_NUMBER() OVER (ORDER BY p.featured_order ASC, p.created_at DESC)
+FROM products p, collections c
+WHERE c.slug = 'homepage-hero' AND p.is_featured AND p.deleted_at IS NULL;
@@ -0,0 +1,48 @@
+CREATE TABLE product_questions (
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL,
+    author_name VARCHAR(255),
+    body VARCHAR(1000) NOT NULL,
+    status VARCHAR(20) DEFAULT 'visible',
+    moderation_reason VARCHAR(500),
+    votes INTEGER DEFAULT 0,
+    answer_count INTEGER DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX idx_product_questions_product_id ON product_questions(product_id);
+CREATE INDEX idx_product_questions_user_id ON product_questions(user_id);
+CREATE INDEX idx_product_questions_status ON product_questions(status);
+CREATE INDEX idx_product_questions_deleted_at ON product_questions(deleted_at);
+
+CREATE TABLE product_answers (
+    id SERIAL PRIMARY KEY,
+    question_id INTEGER NOT NULL REFERENCES product_questions(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL,
+    author_name VARCHAR(255),
+    body VARCHAR(2000) NOT NULL,
+    is_seller BOOLEAN DEFAULT FALSE,
+    status VARCHAR(20) DEFAULT 'visible',
+    moderation_reason VARCHAR(500),
+    votes INTEGER DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX idx_product_answers_question_id ON product_answers(question_id);
+CREATE INDEX idx_product_answers_user_id ON product_answers(user_id);
+CREATE INDEX idx_product_answers_status ON product_answers(status);
+CREATE INDEX idx_product_answers_deleted_at ON product_answers(deleted_at);
+
+CREATE TABLE qa_votes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    target_type VARCHAR(20) NOT NULL,
+    target_id INTEGER NOT NULL,
+    value INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_qa_votes_user_target ON qa_votes(user_id, target_type, target_id);
@@ -0,0 +1,9 @@
+CREATE TABLE product_recommendations (
+    id SERIAL PRIMARY KEY,
+    type VARCHAR(20) NOT NULL,
+    product_id INTEGER NOT NULL,
+    recommended_id INTEGER NOT NULL,
+    score DOUBLE PRECISION,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_product_recommendations_pair ON product_recommendations(type, product_id, recommended_id);
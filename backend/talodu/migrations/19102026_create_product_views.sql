@@ -0,0 +1,10 @@
+CREATE TABLE product_views (
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL,
+    user_id INTEGER,
+    session_id VARCHAR(64),
+    viewed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_product_views_product_id ON product_views(product_id);
+CREATE INDEX idx_product_views_user ON product_views(user_id, viewed_at);
+CREATE INDEX idx_product_views_session ON product_views(session_id, viewed_at);
@@ -0,0 +1,25 @@
+-- Synonym sets and stop words used to expand product searches
+CREATE TABLE search_synonyms (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    language VARCHAR(5) NOT NULL,
+    terms JSONB NOT NULL DEFAULT '[]'::jsonb
+);
+
+CREATE INDEX idx_search_synonyms_language ON search_synonyms (language);
+CREATE INDEX idx_search_synonyms_deleted_at ON search_synonyms (deleted_at);
+
+CREATE TABLE search_stop_words (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    language VARCHAR(5) NOT NULL,
+    word VARCHAR(100) NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_search_stop_words_lang_word ON search_stop_words (language, word);
+
+-- Example data
+-- INSERT INTO search_synonyms (language, terms) VALUES ('fr', '["smartphone", "téléphone", "portable"]');
+-- INSERT INTO search_stop_words (language, word) VALUES ('fr', 'le'), ('fr', 'la'), ('fr', 'les'), ('fr', 'de'), ('fr', 'des');
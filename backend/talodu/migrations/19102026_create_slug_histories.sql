@@ -0,0 +1,9 @@
+CREATE TABLE slug_histories (
+    id SERIAL PRIMARY KEY,
+    entity_type VARCHAR(20) NOT NULL,
+    entity_id INTEGER NOT NULL,
+    slug VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_slug_histories_type_slug ON slug_histories(entity_type, slug);
+CREATE INDEX idx_slug_histories_entity_id ON slug_histories(entity_id);
@@ -0,0 +1,12 @@
+-- One row per viewer and product, the latest view is kept
+DELETE FROM product_views a USING product_views b
+WHERE a.product_id = b.product_id AND a.user_id = b.user_id
+    AND (a.viewed_at, a.id) < (b.viewed_at, b.id);
+DELETE FROM product_views a USING product_views b
+WHERE a.product_id = b.product_id AND a.user_id IS NULL AND b.user_id IS NULL AND a.session_id = b.session_id
+    AND (a.viewed_at, a.id) < (b.viewed_at, b.id);
+
+CREATE UNIQUE INDEX idx_product_views_user_product ON product_views(user_id, product_id) WHERE user_id IS NOT NULL;
+CREATE UNIQUE INDEX idx_product_views_session_product ON product_views(session_id, product_id) WHERE user_id IS NULL;
+-- Pruning of old views
+CREATE INDEX idx_product_views_viewed_at ON product_views(viewed_at);
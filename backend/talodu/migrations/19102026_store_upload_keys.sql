@@ -0,0 +1,23 @@
+-- Uploaded files are addressed by their storage object key, the URLs are
+-- computed by the storage backend. Run `go run ./cmd/migrate-uploads` after
+-- this migration to copy the existing files and fill the key columns.
+ALTER TABLE product_images ADD COLUMN key VARCHAR(500);
+ALTER TABLE product_images ADD COLUMN thumbnail_key VARCHAR(500);
+ALTER TABLE product_images ADD COLUMN medium_key VARCHAR(500);
+ALTER TABLE product_images ADD COLUMN large_key VARCHAR(500);
+ALTER TABLE product_images ADD COLUMN webp_key VARCHAR(500);
+
+ALTER TABLE site_images ADD COLUMN key VARCHAR(500);
+ALTER TABLE site_images ADD COLUMN thumbnail_key VARCHAR(500);
+ALTER TABLE site_images ADD COLUMN medium_key VARCHAR(500);
+ALTER TABLE site_images ADD COLUMN large_key VARCHAR(500);
+ALTER TABLE site_images ADD COLUMN webp_key VARCHAR(500);
+ALTER TABLE site_images ALTER COLUMN url DROP NOT NULL;
+
+ALTER TABLE site_logos ADD COLUMN key VARCHAR(500);
+ALTER TABLE site_logos ALTER COLUMN url DROP NOT NULL;
+
+-- Once migrate-uploads reported no errors, the legacy columns can be dropped:
+-- ALTER TABLE product_images DROP COLUMN url, DROP COLUMN thumbnail_url, DROP COLUMN medium_url, DROP COLUMN large_url, DROP COLUMN webp_url;
+-- ALTER TABLE site_images DROP COLUMN url, DROP COLUMN thumbnail_url, DROP COLUMN medium_url, DROP COLUMN large_url, DROP COLUMN webp_url;
+-- ALTER TABLE site_logos DROP COLUMN url;
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"strconv"
+	"talodu/i18n"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// AttributeType is the kind of value of a product attribute
+type AttributeType string
+
+const (
+	AttributeTypeText    AttributeType = "text"
+	AttributeTypeNumber  AttributeType = "number" // Stored in NumberValue, in the unit of the definition
+	AttributeTypeBoolean AttributeType = "boolean"
+	AttributeTypeEnum    AttributeType = "enum" // One of the options of the definition
+)
+
+// AttributeDefinition is a specification the products of a category can
+// have, e.g. the screen size of phones. Codes are unique in a category, the
+// same code in several categories is filtered on as one attribute.
+type AttributeDefinition struct {
+	ID           uint                             `json:"id" gorm:"primaryKey"`
+	CategoryID   uint                             `json:"category_id" gorm:"uniqueIndex:idx_attribute_definitions_category_code,priority:1"`
+	Code         string                           `json:"code" gorm:"size:64;uniqueIndex:idx_attribute_definitions_category_code,priority:2"`
+	Name         string                           `json:"name" gorm:"size:100"`
+	Type         AttributeType                    `json:"type" gorm:"size:20"`
+	Unit         string                           `json:"unit" gorm:"size:20"` // e.g. "in", "GB"
+	Options      datatypes.JSONSlice[string]      `json:"options" gorm:"type:jsonb"`
+	Required     bool                             `json:"required" gorm:"default:false"`
+	Filterable   bool                             `json:"filterable" gorm:"default:true"` // Offered as a facet
+	Position     int                              `json:"position" gorm:"default:0"`
+	Translations []AttributeDefinitionTranslation `json:"translations,omitempty" gorm:"foreignKey:AttributeDefinitionID;constraint:OnDelete:CASCADE"`
+	OptionLabels map[string]string                `json:"option_labels,omitempty" gorm:"-"` // Labels of the options in the requested language
+	CreatedAt    time.Time                        `json:"created_at"`
+	UpdatedAt    time.Time                        `json:"updated_at"`
+}
+
+// AttributeDefinitionTranslation translates the name and the enum options of an attribute
+type AttributeDefinitionTranslation struct {
+	ID                    uint                                  `json:"id" gorm:"primaryKey"`
+	AttributeDefinitionID uint                                  `json:"attribute_definition_id" gorm:"uniqueIndex:idx_attribute_definition_translations_lang"`
+	Language              string                                `json:"language" gorm:"size:5;uniqueIndex:idx_attribute_definition_translations_lang"` // en, fr, es
+	Name                  string                                `json:"name" gorm:"size:100"`
+	OptionLabels          datatypes.JSONType[map[string]string] `json:"option_labels"` // Option -> label
+	CreatedAt             time.Time                             `json:"created_at"`
+	UpdatedAt             time.Time                             `json:"updated_at"`
+}
+
+// Localize applies the translation of the attribute for lang, or for the
+// first language of its fallback chain that has one
+func (a *AttributeDefinition) Localize(lang string) {
+	i := i18n.Pick(lang, len(a.Translations), func(i int) string { return a.Translations[i].Language })
+	if i < 0 {
+		return
+	}
+	if t := a.Translations[i]; t.Name != "" {
+		a.Name = t.Name
+	}
+	a.OptionLabels = a.Translations[i].OptionLabels.Data()
+}
+
+// ProductAttributeValue is the value of an attribute for a product. Value
+// holds the text, the enum option or "true"/"false", and numbers are in
+// NumberValue so they can be filtered by range.
+type ProductAttributeValue struct {
+	ID                    uint                               `json:"id" gorm:"primaryKey"`
+	ProductID             uint                               `json:"product_id" gorm:"uniqueIndex:idx_product_attribute_values_product_attribute"`
+	AttributeDefinitionID uint                               `json:"attribute_id" gorm:"uniqueIndex:idx_product_attribute_values_product_attribute;index"`
+	Attribute             AttributeDefinition                `json:"attribute" gorm:"foreignKey:AttributeDefinitionID;constraint:OnDelete:CASCADE"`
+	Value                 string                             `json:"value" gorm:"size:255;index"`
+	NumberValue           *float64                           `json:"number_value"`
+	Translations          []ProductAttributeValueTranslation `json:"translations,omitempty" gorm:"foreignKey:ProductAttributeValueID;constraint:OnDelete:CASCADE"`
+	Label                 string                             `json:"label" gorm:"-"` // Value to display, translated and with its unit
+	CreatedAt             time.Time                          `json:"created_at"`
+	UpdatedAt             time.Time                          `json:"updated_at"`
+}
+
+// ProductAttributeValueTranslation translates a text attribute value
+type ProductAttributeValueTranslation struct {
+	ID                      uint      `json:"id" gorm:"primaryKey"`
+	ProductAttributeValueID uint      `json:"product_attribute_value_id" gorm:"uniqueIndex:idx_product_attribute_value_translations_lang"`
+	Language                string    `json:"language" gorm:"size:5;uniqueIndex:idx_product_attribute_value_translations_lang"`
+	Value                   string    `json:"value" gorm:"size:255"`
+	CreatedAt               time.Time `json:"created_at"`
+	UpdatedAt               time.Time `json:"updated_at"`
+}
+
+// Localize translates the attribute and sets the label of the value for
+// lang, Attribute and the translations must be preloaded
+func (v *ProductAttributeValue) Localize(lang string) {
+	v.Attribute.Localize(lang)
+
+	switch v.Attribute.Type {
+	case AttributeTypeNumber:
+		if v.NumberValue != nil {
+			v.Label = strconv.FormatFloat(*v.NumberValue, 'f', -1, 64)
+		}
+	case AttributeTypeEnum:
+		v.Label = v.Value
+		if label := v.Attribute.OptionLabels[v.Value]; label != "" {
+			v.Label = label
+		}
+	default:
+		v.Label = v.Value
+		i := i18n.Pick(lang, len(v.Translations), func(i int) string {
+			if v.Translations[i].Value == "" {
+				return ""
+			}
+			return v.Translations[i].Language
+		})
+		if i >= 0 {
+			v.Label = v.Translations[i].Value
+		}
+	}
+	if v.Label != "" && v.Attribute.Unit != "" {
+		v.Label += " " + v.Attribute.Unit
+	}
+}
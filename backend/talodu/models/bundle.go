@@ -0,0 +1,80 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProductType tells how a product is stocked
+type ProductType string
+
+const (
+	ProductTypeSimple ProductType = "simple"
+	// ProductTypeBundle products are sold at their own price but made of
+	// components, their stock is the number of bundles the stock of the
+	// components can make
+	ProductTypeBundle ProductType = "bundle"
+)
+
+// BundleComponent is Quantity units of a product in each unit of a bundle
+type BundleComponent struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	BundleID    uint      `json:"bundle_id" gorm:"not null;uniqueIndex:idx_bundle_components_component,priority:1"`
+	ComponentID uint      `json:"component_id" gorm:"not null;index;uniqueIndex:idx_bundle_components_component,priority:2"`
+	Component   *Product  `json:"component,omitempty" gorm:"foreignKey:ComponentID"`
+	Quantity    int       `json:"quantity" gorm:"not null;default:1"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// bundleStockSQL computes the stock of a bundle from its components, the
+// bundle ID is appended. A deleted component makes the bundle unavailable.
+const bundleStockSQL = `SELECT COALESCE(MIN(GREATEST(COALESCE(components.stock, 0), 0) / bundle_components.quantity), 0)
+	FROM bundle_components
+	LEFT JOIN products components ON components.id = bundle_components.component_id AND components.deleted_at IS NULL
+	WHERE bundle_components.bundle_id = `
+
+// StockSQL is the stock customers can buy, computed in SQL like Product.Stock
+// so listings can be filtered and sorted by it
+const StockSQL = `(CASE WHEN products.type = 'bundle' THEN (` + bundleStockSQL + `products.id) ELSE products.stock END)`
+
+// IsBundle tells whether the product is a bundle
+func (p *Product) IsBundle() bool {
+	return p.Type == ProductTypeBundle
+}
+
+// loadBundleStock sets the stock of a bundle from the stock of its components
+func (p *Product) loadBundleStock(tx *gorm.DB) error {
+	return tx.Session(&gorm.Session{NewDB: true}).Raw(bundleStockSQL+"?", p.ID).Scan(&p.Stock).Error
+}
+
+// ErrInsufficientStock is returned when there aren't enough units in stock
+var ErrInsufficientStock = errors.New("not enough stock")
+
+// DecrementStock takes quantity units out of the stock of a product. The
+// check and the update are one statement, so concurrent orders can't sell
+// the same units twice.
+func DecrementStock(tx *gorm.DB, productID uint, quantity int) error {
+	result := tx.Model(&Product{}).
+		Where("id = ? AND stock >= ?", productID, quantity).
+		Update("stock", gorm.Expr("stock - ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+	return nil
+}
+
+// OrderItemComponent is a component shipped for a bundle of an order, with
+// the name and SKU it had when the order was placed
+type OrderItemComponent struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	OrderItemID uint   `json:"order_item_id" gorm:"index"`
+	ProductID   uint   `json:"product_id"`
+	Name        string `json:"name"`
+	SKU         string `json:"sku" gorm:"column:sku;size:64"`
+	Quantity    int    `json:"quantity"` // Units for all the bundles of the item
+}
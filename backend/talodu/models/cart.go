@@ -1,6 +1,7 @@
 package models
 
 import (
+	"talodu/money"
 	"time"
 
 	"gorm.io/gorm"
@@ -20,11 +21,26 @@ type SharedCart struct {
 // SharedCartItem represents an item in a shared cart
 type SharedCartItem struct {
 	gorm.Model
-	SharedCartID uint    `json:"shared_cart_id"`
-	ProductID    uint    `json:"product_id"`
-	Product      Product `json:"product" gorm:"foreignKey:ProductID"`
-	Quantity     int     `json:"quantity" gorm:"default:1"`
-	PriceAtShare float64 `json:"price_at_share"` // Snapshot of price when shared
+	SharedCartID uint        `json:"shared_cart_id"`
+	ProductID    uint        `json:"product_id"`
+	Product      Product     `json:"product" gorm:"foreignKey:ProductID"`
+	Quantity     int         `json:"quantity" gorm:"default:1"`
+	PriceAtShare money.Money `json:"price_at_share"` // Snapshot of price when shared
+	Currency     string      `json:"currency" gorm:"size:3"`
+}
+
+// BeforeSave stores the currency of the price
+func (i *SharedCartItem) BeforeSave(tx *gorm.DB) error {
+	if i.PriceAtShare.Currency != "" {
+		i.Currency = i.PriceAtShare.Currency
+	}
+	return nil
+}
+
+// AfterFind sets the currency of the price
+func (i *SharedCartItem) AfterFind(tx *gorm.DB) error {
+	i.PriceAtShare = i.PriceAtShare.In(i.Currency)
+	return nil
 }
 
 // SharedCartView represents when someone views a shared cart
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"talodu/i18n"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// CollectionSlot is the place of the storefront a collection is shown in
+type CollectionSlot string
+
+const (
+	CollectionSlotHomepageHero      CollectionSlot = "homepage_hero"
+	CollectionSlotDealsOfTheDay     CollectionSlot = "deals_of_the_day"
+	CollectionSlotCategorySpotlight CollectionSlot = "category_spotlight" // Shown on the page of CategoryID
+)
+
+// ValidCollectionSlot tells whether s is a known slot
+func ValidCollectionSlot(s CollectionSlot) bool {
+	switch s {
+	case CollectionSlotHomepageHero, CollectionSlotDealsOfTheDay, CollectionSlotCategorySpotlight:
+		return true
+	}
+	return false
+}
+
+// CollectionMode is how the products of a collection are chosen
+type CollectionMode string
+
+const (
+	CollectionModeManual CollectionMode = "manual" // The items, in their order
+	CollectionModeRule   CollectionMode = "rule"   // The visible products matching the rule
+)
+
+// CollectionRule selects the products of a rule-based collection. Empty
+// fields don't filter.
+type CollectionRule struct {
+	CategoryIDs []uint  `json:"category_ids,omitempty"`
+	ShopID      *uint   `json:"shop_id,omitempty"`
+	Featured    bool    `json:"featured,omitempty"` // Products flagged with ToggleFeaturedProduct
+	OnSale      bool    `json:"on_sale,omitempty"`
+	InStock     bool    `json:"in_stock,omitempty"`
+	MinRating   float64 `json:"min_rating,omitempty"`
+	Sort        string  `json:"sort,omitempty"` // Same syntax as ?sort= of the product listings, e.g. "-rating"
+}
+
+// Collection is a named list of products merchandised in a slot of the
+// storefront, e.g. the homepage hero or the deals of the day. It is live
+// while active and between StartsAt and EndsAt, several collections of a slot
+// can be scheduled one after the other.
+type Collection struct {
+	ID           uint                               `json:"id" gorm:"primaryKey"`
+	Slug         string                             `json:"slug" gorm:"size:100;uniqueIndex;not null"`
+	Name         string                             `json:"name" gorm:"size:255;not null"`
+	Description  string                             `json:"description"`
+	Slot         CollectionSlot                     `json:"slot" gorm:"size:30;index:idx_collections_slot,priority:1"`
+	CategoryID   *uint                              `json:"category_id" gorm:"index:idx_collections_slot,priority:2"`
+	Mode         CollectionMode                     `json:"mode" gorm:"size:10;default:'manual'"`
+	Rule         datatypes.JSONType[CollectionRule] `json:"rule"`
+	Position     int                                `json:"position" gorm:"default:0"` // Order of the live collections of a slot
+	IsActive     bool                               `json:"is_active"`
+	StartsAt     *time.Time                         `json:"starts_at"` // Live from the start, when nil
+	EndsAt       *time.Time                         `json:"ends_at"`   // Never ends, when nil
+	Translations []CollectionTranslation            `json:"translations,omitempty" gorm:"foreignKey:CollectionID;constraint:OnDelete:CASCADE"`
+	CreatedAt    time.Time                          `json:"created_at"`
+	UpdatedAt    time.Time                          `json:"updated_at"`
+}
+
+// IsLive tells whether the collection is shown at t
+func (c *Collection) IsLive(t time.Time) bool {
+	return c.IsActive && (c.StartsAt == nil || !c.StartsAt.After(t)) && (c.EndsAt == nil || c.EndsAt.After(t))
+}
+
+// Localize replaces the name and description by their translation in lang,
+// or in the first language of its fallback chain that has one
+func (c *Collection) Localize(lang string) {
+	if i := i18n.Pick(lang, len(c.Translations), func(i int) string { return c.Translations[i].Language }); i >= 0 {
+		if t := c.Translations[i]; t.Name != "" {
+			c.Name = t.Name
+			c.Description = t.Description
+		}
+	}
+}
+
+// CollectionTranslation is the name and description of a collection in one language
+type CollectionTranslation struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	CollectionID uint      `json:"collection_id" gorm:"uniqueIndex:idx_collection_translations_lang"`
+	Language     string    `json:"language" gorm:"size:5;uniqueIndex:idx_collection_translations_lang"` // en, fr, es
+	Name         string    `json:"name" gorm:"size:255"`
+	Description  string    `json:"description"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// CollectionItem is a product of a manual collection
+type CollectionItem struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	CollectionID uint      `json:"collection_id" gorm:"not null;uniqueIndex:idx_collection_items_product,priority:1"`
+	ProductID    uint      `json:"product_id" gorm:"not null;uniqueIndex:idx_collection_items_product,priority:2"`
+	Position     int       `json:"position" gorm:"default:0"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// LiveCollections restricts a collections query to the collections live at t
+func LiveCollections(db *gorm.DB, t time.Time) *gorm.DB {
+	return db.Where("collections.is_active = ?", true).
+		Where("collections.starts_at IS NULL OR collections.starts_at <= ?", t).
+		Where("collections.ends_at IS NULL OR collections.ends_at > ?", t)
+}
+
+// CollectionProductIDs returns the visible products of a manual collection in
+// their order
+func CollectionProductIDs(db *gorm.DB, collectionID uint, limit int) ([]uint, error) {
+	ids := []uint{}
+	err := db.Model(&CollectionItem{}).
+		Joins("JOIN products ON products.id = collection_items.product_id AND products.deleted_at IS NULL AND products.is_visible").
+		Where("collection_items.collection_id = ?", collectionID).
+		Order("collection_items.position ASC, collection_items.id ASC").
+		Limit(limit).
+		Pluck("collection_items.product_id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"talodu/currency"
+	"talodu/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ExchangeRate is the number of units of To one unit of From buys. Rates
+// are managed by admins, the inverse rate is used when only the opposite
+// pair is known.
+type ExchangeRate struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	From        string    `json:"from" gorm:"column:from_currency;size:3;uniqueIndex:idx_exchange_rates_pair"`
+	To          string    `json:"to" gorm:"column:to_currency;size:3;uniqueIndex:idx_exchange_rates_pair"`
+	Rate        float64   `json:"rate"`
+	UpdatedByID *uint     `json:"updated_by_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ExchangeRates is the rate table, by source then target currency
+type ExchangeRates map[string]map[string]float64
+
+// LoadExchangeRates returns the rate table
+func LoadExchangeRates(db *gorm.DB) (ExchangeRates, error) {
+	var records []ExchangeRate
+	if err := db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	rates := make(ExchangeRates)
+	for _, record := range records {
+		if record.Rate <= 0 {
+			continue
+		}
+		rates.set(record.From, record.To, record.Rate)
+	}
+	// Inverse pairs don't override rates that were entered
+	for _, record := range records {
+		if record.Rate > 0 {
+			if _, ok := rates[record.To][record.From]; !ok {
+				rates.set(record.To, record.From, 1/record.Rate)
+			}
+		}
+	}
+	return rates, nil
+}
+
+func (r ExchangeRates) set(from, to string, rate float64) {
+	if r[from] == nil {
+		r[from] = make(map[string]float64)
+	}
+	r[from][to] = rate
+}
+
+// Rate returns the rate from one currency to another, directly or through
+// a currency both have a rate with. ok is false when there is none.
+func (r ExchangeRates) Rate(from, to string) (rate float64, ok bool) {
+	from, to = currency.Normalize(from), currency.Normalize(to)
+	if from == to {
+		return 1, true
+	}
+	if rate, ok := r[from][to]; ok {
+		return rate, true
+	}
+	// Pivots are tried in alphabetical order for the result to be stable
+	pivots := make([]string, 0, len(r[from]))
+	for pivot := range r[from] {
+		pivots = append(pivots, pivot)
+	}
+	sort.Strings(pivots)
+	for _, pivot := range pivots {
+		if second, ok := r[pivot][to]; ok {
+			return r[from][pivot] * second, true
+		}
+	}
+	return 0, false
+}
+
+// Convert converts amount to another currency, rounded to its minor unit
+func (r ExchangeRates) Convert(amount money.Money, to string) (money.Money, error) {
+	rate, ok := r.Rate(amount.Currency, to)
+	if !ok {
+		return money.Money{}, fmt.Errorf("no exchange rate from %s to %s", amount.Currency, currency.Normalize(to))
+	}
+	return amount.Convert(rate, to), nil
+}
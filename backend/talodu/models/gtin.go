@@ -0,0 +1,52 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// GTIN lengths: GTIN-8 (EAN-8), GTIN-12 (UPC-A), GTIN-13 (EAN-13) and GTIN-14
+var gtinLengths = map[int]bool{8: true, 12: true, 13: true, 14: true}
+
+var (
+	ErrGTINDigits     = errors.New("a barcode must only contain digits")
+	ErrGTINLength     = errors.New("a barcode must have 8, 12, 13 or 14 digits")
+	ErrGTINCheckDigit = errors.New("the check digit of the barcode is invalid")
+)
+
+// NormalizeGTIN removes the spaces and dashes of a barcode and checks it is
+// a valid EAN, UPC or GTIN-14, check digit included
+func NormalizeGTIN(code string) (string, error) {
+	code = strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code))
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return "", ErrGTINDigits
+		}
+	}
+	if !gtinLengths[len(code)] {
+		return "", ErrGTINLength
+	}
+
+	// From the right, skipping the check digit, digits are weighted 3, 1, 3, ...
+	sum := 0
+	for i := len(code) - 2; i >= 0; i-- {
+		digit := int(code[i] - '0')
+		if (len(code)-2-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	if check := int(code[len(code)-1] - '0'); check != (10-sum%10)%10 {
+		return "", ErrGTINCheckDigit
+	}
+	return code, nil
+}
+
+// GTIN14 pads a normalized GTIN with leading zeros. Barcodes are compared in
+// this form, a UPC-A scanned as EAN-13 then finds the same product.
+func GTIN14(gtin string) string {
+	if len(gtin) >= 14 {
+		return gtin
+	}
+	return strings.Repeat("0", 14-len(gtin)) + gtin
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeGTIN(t *testing.T) {
+	tests := []struct {
+		code    string
+		want    string
+		wantErr error
+	}{
+		{"96385074", "96385074", nil},               // EAN-8
+		{"036000291452", "036000291452", nil},       // UPC-A
+		{"4006381333931", "4006381333931", nil},     // EAN-13
+		{"10012345678902", "10012345678902", nil},   // GTIN-14
+		{" 400-6381 333931 ", "4006381333931", nil}, // Spaces and dashes
+		{"96385075", "", ErrGTINCheckDigit},
+		{"036000291453", "", ErrGTINCheckDigit},
+		{"4006381333932", "", ErrGTINCheckDigit},
+		{"10012345678903", "", ErrGTINCheckDigit},
+		{"0123456789", "", ErrGTINLength},
+		{"", "", ErrGTINLength},
+		{"40063813339A1", "", ErrGTINDigits},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeGTIN(tt.code)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("NormalizeGTIN(%q) = %q, %v, want %q, %v", tt.code, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestGTIN14(t *testing.T) {
+	tests := []struct{ gtin, want string }{
+		{"96385074", "00000096385074"},
+		{"036000291452", "00036000291452"},
+		{"4006381333931", "04006381333931"},
+		{"10012345678902", "10012345678902"},
+	}
+	for _, tt := range tests {
+		if got := GTIN14(tt.gtin); got != tt.want {
+			t.Errorf("GTIN14(%q) = %q, want %q", tt.gtin, got, tt.want)
+		}
+	}
+}
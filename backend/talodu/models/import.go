@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type ImportStatus string
+
+const (
+	ImportStatusPending   ImportStatus = "pending"
+	ImportStatusRunning   ImportStatus = "running"
+	ImportStatusCompleted ImportStatus = "completed"
+	ImportStatusFailed    ImportStatus = "failed"
+)
+
+// ImportRowError is a problem found on one row of an imported file
+type ImportRowError struct {
+	Row     int    `json:"row"` // Line number in the file, the header is row 1
+	SKU     string `json:"sku,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportJob tracks a bulk product import running in the background
+type ImportJob struct {
+	gorm.Model
+	ShopID        uint                                `json:"shop_id" gorm:"index"`
+	UserID        uint                                `json:"user_id"`
+	Filename      string                              `json:"filename" gorm:"size:255"`
+	Status        ImportStatus                        `json:"status" gorm:"size:20;default:'pending'"`
+	TotalRows     int                                 `json:"total_rows"`
+	ProcessedRows int                                 `json:"processed_rows"`
+	CreatedCount  int                                 `json:"created_count"`
+	UpdatedCount  int                                 `json:"updated_count"`
+	FailedCount   int                                 `json:"failed_count"`
+	Errors        datatypes.JSONSlice[ImportRowError] `json:"errors" gorm:"type:jsonb"`
+	StartedAt     *time.Time                          `json:"started_at"`
+	FinishedAt    *time.Time                          `json:"finished_at"`
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"fmt"
+	"talodu/i18n"
+	"talodu/storage"
 	"time"
 
 	"gorm.io/gorm"
@@ -42,6 +44,8 @@ type User struct {
 	WhatsAppVerificationCode   string    `gorm:"size:6" json:"-"`
 	WhatsAppVerificationExpiry time.Time `json:"-"`
 	IsWhatsAppVerified         bool      `gorm:"default:false"`
+
+	PreferredLanguage string `json:"preferred_language" gorm:"size:10"` // Language of the API responses and messages, see i18n
 }
 
 type FrontendUserResponse struct {
@@ -101,18 +105,126 @@ type UpdateUserRequest struct {
 
 type Category struct {
 	gorm.Model
-	Name        string    `json:"name" gorm:"unique"`
+	Name         string                `json:"name" gorm:"unique"`
+	Description  string                `json:"description"`
+	Products     []Product             `json:"products" gorm:"many2many:product_categories;"`
+	Translations []CategoryTranslation `json:"translations,omitempty" gorm:"foreignKey:CategoryID;constraint:OnDelete:CASCADE"`
+}
+
+// Localize replaces the name and description by their translation in lang,
+// or in the first language of its fallback chain that has one. Drafts are
+// left out, see Product.Localize.
+func (c *Category) Localize(lang string) {
+	c.localize(lang, false)
+}
+
+func (c *Category) localize(lang string, drafts bool) {
+	if !drafts {
+		reviewed := c.Translations[:0:0]
+		for _, t := range c.Translations {
+			if !t.Draft {
+				reviewed = append(reviewed, t)
+			}
+		}
+		c.Translations = reviewed
+	}
+	if i := i18n.Pick(lang, len(c.Translations), func(i int) string { return c.Translations[i].Language }); i >= 0 {
+		c.Name = c.Translations[i].Name
+		c.Description = c.Translations[i].Description
+	}
+}
+
+// CategoryTranslation is the name and description of a category in one language
+type CategoryTranslation struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	CategoryID  uint      `json:"category_id" gorm:"uniqueIndex:idx_category_translations_lang"`
+	Language    string    `json:"language" gorm:"size:5;uniqueIndex:idx_category_translations_lang"` // en, fr, es
+	Name        string    `json:"name"`
 	Description string    `json:"description"`
-	Products    []Product `json:"products" gorm:"many2many:product_categories;"`
+	Draft       bool      `json:"draft" gorm:"default:false"` // Machine translation waiting for review
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 type ProductImage struct {
 	gorm.Model
-	ProductID uint   `json:"product_id"`
-	URL       string `json:"url" gorm:"size:500"`
-	AltText   string `json:"alt_text" gorm:"size:100"`
-	IsPrimary bool   `json:"is_primary" gorm:"default:false"`
-	IsVisible bool   `json:"is_visible"`
+	ProductID    uint   `json:"product_id"`
+	Key          string `json:"-" gorm:"size:500"` // Storage key of the original, metadata stripped
+	ThumbnailKey string `json:"-" gorm:"size:500"`
+	MediumKey    string `json:"-" gorm:"size:500"`
+	LargeKey     string `json:"-" gorm:"size:500"`
+	WebPKey      string `json:"-" gorm:"column:webp_key;size:500"`
+	URL          string `json:"url" gorm:"-"` // URLs are computed from the keys by the storage backend
+	ThumbnailURL string `json:"thumbnail_url" gorm:"-"`
+	MediumURL    string `json:"medium_url" gorm:"-"`
+	LargeURL     string `json:"large_url" gorm:"-"`
+	WebPURL      string `json:"webp_url" gorm:"-"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	MimeType     string `json:"mime_type" gorm:"size:50"` // Type of the uploaded file
+	AltText      string `json:"alt_text" gorm:"size:100"`
+	IsPrimary    bool   `json:"is_primary" gorm:"default:false"`
+	IsVisible    bool   `json:"is_visible"`
+	Position     int    `json:"position" gorm:"default:0;index"` // Gallery order, ascending
+	// Images can be restricted to one variant (e.g. "128GB") and/or colour of
+	// the product, images with neither are shown for all of them
+	Variant      string                    `json:"variant" gorm:"size:100"`
+	Color        string                    `json:"color" gorm:"size:50"`
+	SourceURL    string                    `json:"-" gorm:"size:1000"` // URL the image was downloaded from by an import
+	Translations []ProductImageTranslation `json:"translations,omitempty" gorm:"foreignKey:ProductImageID;constraint:OnDelete:CASCADE"`
+}
+
+// ProductImageTranslation is the alt text of an image in one language
+type ProductImageTranslation struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	ProductImageID uint      `json:"product_image_id" gorm:"uniqueIndex:idx_product_image_translations_image_lang"`
+	Language       string    `json:"language" gorm:"size:5;uniqueIndex:idx_product_image_translations_image_lang"` // en, fr, es
+	AltText        string    `json:"alt_text" gorm:"size:255"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Localize replaces the alt text by its translation in lang, or in the
+// first language of its fallback chain that has one
+func (i *ProductImage) Localize(lang string) {
+	j := i18n.Pick(lang, len(i.Translations), func(j int) string {
+		if i.Translations[j].AltText == "" {
+			return ""
+		}
+		return i.Translations[j].Language
+	})
+	if j >= 0 {
+		i.AltText = i.Translations[j].AltText
+	}
+}
+
+// ObjectKeys returns the storage keys of the original file and of all its renditions
+func (i *ProductImage) ObjectKeys() []string {
+	var keys []string
+	for _, key := range []string{i.Key, i.ThumbnailKey, i.MediumKey, i.LargeKey, i.WebPKey} {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (i *ProductImage) setURLs() {
+	i.URL = storage.URL(i.Key)
+	i.ThumbnailURL = storage.URL(i.ThumbnailKey)
+	i.MediumURL = storage.URL(i.MediumKey)
+	i.LargeURL = storage.URL(i.LargeKey)
+	i.WebPURL = storage.URL(i.WebPKey)
+}
+
+func (i *ProductImage) AfterFind(tx *gorm.DB) error {
+	i.setURLs()
+	return nil
+}
+
+func (i *ProductImage) AfterSave(tx *gorm.DB) error {
+	i.setURLs()
+	return nil
 }
 
 type SiteImage struct {
@@ -132,6 +244,7 @@ type Shop struct {
 	Owner       User      `json:"owner" gorm:"foreignKey:OwnerID"`
 	Employees   []User    `json:"employees" gorm:"many2many:shop_employees;"`
 	Products    []Product `json:"products" gorm:"foreignKey:ShopID"`
+	Currency    string    `json:"currency" gorm:"size:3"` // Currency of the product prices, the site currency when empty
 }
 
 // Generate slug after the record is created
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Notification types
+const (
+	NotificationProductApproved = "product_approved"
+	NotificationProductRejected = "product_rejected"
+)
+
+// Notification is a message shown to a user in the app, and sent by email
+// when email notifications are enabled in the global settings
+type Notification struct {
+	gorm.Model
+	UserID  uint       `json:"user_id" gorm:"index"`
+	Type    string     `json:"type" gorm:"size:50"`
+	Title   string     `json:"title" gorm:"size:255"`
+	Message string     `json:"message"`
+	Link    string     `json:"link,omitempty" gorm:"size:500"` // Path of the page the notification is about
+	ReadAt  *time.Time `json:"read_at"`
+}
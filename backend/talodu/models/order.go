@@ -2,6 +2,7 @@
 package models
 
 import (
+	"talodu/money"
 	"time"
 
 	"gorm.io/gorm"
@@ -15,7 +16,8 @@ type Order struct {
 	OrderNumber string       `json:"order_number" gorm:"uniqueIndex;size:32"`
 	Status      OrderStatus  `json:"status" gorm:"type:order_status;default:'pending'"`
 	Items       []OrderItem  `json:"items" gorm:"foreignKey:OrderID"`
-	TotalAmount float64      `json:"total_amount"`
+	TotalAmount money.Money  `json:"total_amount"`
+	Currency    string       `json:"currency" gorm:"size:3"` // Currency of the amounts of the order and its items
 	Shipping    ShippingInfo `json:"shipping" gorm:"embedded;embeddedPrefix:shipping_"`
 	Payment     PaymentInfo  `json:"payment" gorm:"embedded;embeddedPrefix:payment_"`
 }
@@ -35,21 +37,29 @@ const (
 // OrderItem represents an item in an order
 type OrderItem struct {
 	gorm.Model
-	OrderID     uint    `json:"order_id"`
-	ProductID   uint    `json:"product_id"`
-	Product     Product `json:"product" gorm:"foreignKey:ProductID"`
-	Quantity    int     `json:"quantity"`
-	PriceAtTime float64 `json:"price_at_time"` // Snapshot of price when ordered
+	OrderID     uint        `json:"order_id"`
+	ProductID   uint        `json:"product_id"`
+	Product     Product     `json:"product" gorm:"foreignKey:ProductID"`
+	Quantity    int         `json:"quantity"`
+	PriceAtTime money.Money `json:"price_at_time"` // Snapshot of price when ordered, in the currency of the order
+	Currency    string      `json:"currency" gorm:"size:3"`
+	// The price in the currency of the product and the rate it was converted with
+	ShopCurrency string      `json:"shop_currency" gorm:"size:3"`
+	ShopPrice    money.Money `json:"shop_price"`
+	ExchangeRate float64     `json:"exchange_rate" gorm:"default:1"`
+	// What a bundle was made of when ordered
+	Components []OrderItemComponent `json:"components,omitempty" gorm:"foreignKey:OrderItemID"`
 }
 
 // CartItem represents an item in a user's shopping cart
 type CartItem struct {
 	gorm.Model
-	UserID    uint    `json:"user_id"`
-	ProductID uint    `json:"product_id"`
-	Product   Product `json:"product" gorm:"foreignKey:ProductID"`
-	Quantity  int     `json:"quantity" gorm:"default:1"`
-	Price     float64 `json:"price"` // Snapshot of price when added to cart
+	UserID    uint        `json:"user_id"`
+	ProductID uint        `json:"product_id"`
+	Product   Product     `json:"product" gorm:"foreignKey:ProductID"`
+	Quantity  int         `json:"quantity" gorm:"default:1"`
+	Price     money.Money `json:"price"` // Snapshot of price when added to cart
+	Currency  string      `json:"currency" gorm:"size:3"`
 }
 
 // ShippingInfo contains shipping details
@@ -66,9 +76,58 @@ type ShippingInfo struct {
 
 // PaymentInfo contains payment details
 type PaymentInfo struct {
-	Method        string    `json:"method" gorm:"size:50"` // stripe, paypal, etc.
-	Amount        float64   `json:"amount"`
-	TransactionID string    `json:"transaction_id" gorm:"size:100"` // Transaction ID from payment processor
-	Status        string    `json:"status" gorm:"size:50"`          // pending, completed, failed, refunded
-	PaidAt        time.Time `json:"paid_at"`
+	Method        string      `json:"method" gorm:"size:50"`          // stripe, paypal, etc.
+	Amount        money.Money `json:"amount"`                         // In the currency of the order
+	TransactionID string      `json:"transaction_id" gorm:"size:100"` // Transaction ID from payment processor
+	Status        string      `json:"status" gorm:"size:50"`          // pending, completed, failed, refunded
+	PaidAt        time.Time   `json:"paid_at"`
+}
+
+// The currencies of the amounts are stored next to them, see package money
+
+// BeforeSave stores the currency of the amounts
+func (o *Order) BeforeSave(tx *gorm.DB) error {
+	if o.TotalAmount.Currency != "" {
+		o.Currency = o.TotalAmount.Currency
+	}
+	return nil
+}
+
+// AfterFind sets the currency of the amounts
+func (o *Order) AfterFind(tx *gorm.DB) error {
+	o.TotalAmount = o.TotalAmount.In(o.Currency)
+	o.Payment.Amount = o.Payment.Amount.In(o.Currency)
+	return nil
+}
+
+// BeforeSave stores the currency of the prices
+func (i *OrderItem) BeforeSave(tx *gorm.DB) error {
+	if i.PriceAtTime.Currency != "" {
+		i.Currency = i.PriceAtTime.Currency
+	}
+	if i.ShopPrice.Currency != "" {
+		i.ShopCurrency = i.ShopPrice.Currency
+	}
+	return nil
+}
+
+// AfterFind sets the currency of the prices
+func (i *OrderItem) AfterFind(tx *gorm.DB) error {
+	i.PriceAtTime = i.PriceAtTime.In(i.Currency)
+	i.ShopPrice = i.ShopPrice.In(i.ShopCurrency)
+	return nil
+}
+
+// BeforeSave stores the currency of the price
+func (i *CartItem) BeforeSave(tx *gorm.DB) error {
+	if i.Price.Currency != "" {
+		i.Currency = i.Price.Currency
+	}
+	return nil
+}
+
+// AfterFind sets the currency of the price
+func (i *CartItem) AfterFind(tx *gorm.DB) error {
+	i.Price = i.Price.In(i.Currency)
+	return nil
 }
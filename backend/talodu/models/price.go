@@ -0,0 +1,211 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"talodu/currency"
+	"talodu/money"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EffectivePriceSQL is the price customers pay, computed in SQL like
+// Product.EffectivePriceAt so that filters and sorts agree with the API. It
+// is in minor units of the product currency, see MajorUnitsSQL.
+const EffectivePriceSQL = `(CASE WHEN products.sale_price IS NOT NULL
+	AND (products.sale_starts_at IS NULL OR products.sale_starts_at <= NOW())
+	AND (products.sale_ends_at IS NULL OR products.sale_ends_at > NOW())
+	THEN products.sale_price ELSE products.price END)`
+
+// PriceScaleSQL is the number of minor units in a major unit of the product
+// currency, amounts in major units like ?min_price= are multiplied by it
+var PriceScaleSQL = currency.ScaleSQL("products.currency")
+
+// moneyColumns are the columns of amounts, in minor units since the
+// migration 19102026_convert_prices_to_minor_units.sql
+var moneyColumns = map[string][]string{
+	"products":          {"price", "sale_price"},
+	"price_histories":   {"price", "sale_price"},
+	"cart_items":        {"price"},
+	"shared_cart_items": {"price_at_share"},
+	"orders":            {"total_amount", "payment_amount"},
+	"order_items":       {"price_at_time", "shop_price"},
+}
+
+// CheckPriceColumns fails while an amount column still has a decimal type,
+// amounts in major units that AutoMigrate would cast to BIGINT without
+// converting them, 12.50 EUR becoming 13 cents. The server refuses to start
+// until the migration converting prices to minor units has run.
+func CheckPriceColumns(db *gorm.DB) error {
+	for table, columns := range moneyColumns {
+		if !db.Migrator().HasTable(table) {
+			continue
+		}
+		types, err := db.Migrator().ColumnTypes(table)
+		if err != nil {
+			return err
+		}
+		for _, columnType := range types {
+			if !containsString(columns, columnType.Name()) {
+				continue
+			}
+			name := strings.ToLower(columnType.DatabaseTypeName())
+			for _, decimal := range []string{"float", "double", "real", "numeric", "decimal"} {
+				if strings.Contains(name, decimal) {
+					return fmt.Errorf("%s.%s is still a %s column of amounts in major units, run migrations/19102026_convert_prices_to_minor_units.sql first",
+						table, columnType.Name(), columnType.DatabaseTypeName())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// PriceHistory is the pricing of a product from CreatedAt until the next
+// record of the product. A record is added every time the price or the sale
+// changes, see RecordPriceHistory.
+type PriceHistory struct {
+	ID           uint         `json:"id" gorm:"primaryKey"`
+	ProductID    uint         `json:"product_id" gorm:"index:idx_price_histories_product_date,priority:1"`
+	Price        money.Money  `json:"price"`
+	SalePrice    *money.Money `json:"sale_price"`
+	Currency     string       `json:"currency" gorm:"size:3"` // Currency of the prices
+	SaleStartsAt *time.Time   `json:"sale_starts_at"`
+	SaleEndsAt   *time.Time   `json:"sale_ends_at"`
+	ChangedByID  *uint        `json:"changed_by_id"`
+	CreatedAt    time.Time    `json:"created_at" gorm:"index:idx_price_histories_product_date,priority:2"`
+}
+
+// AfterFind sets the currency of the prices
+func (h *PriceHistory) AfterFind(tx *gorm.DB) error {
+	h.Price = h.Price.In(h.Currency)
+	if h.SalePrice != nil {
+		salePrice := h.SalePrice.In(h.Currency)
+		h.SalePrice = &salePrice
+	}
+	return nil
+}
+
+// OnSaleAt tells whether the sale price applies at t
+func (p *Product) OnSaleAt(t time.Time) bool {
+	return saleApplies(p.SalePrice, p.SaleStartsAt, p.SaleEndsAt, t)
+}
+
+// EffectivePriceAt is the price customers pay at t: the sale price during
+// the sale, the regular price otherwise
+func (p *Product) EffectivePriceAt(t time.Time) money.Money {
+	if p.OnSaleAt(t) {
+		return *p.SalePrice
+	}
+	return p.Price
+}
+
+// AfterFind sets the currency of the prices, resolves the current price of
+// the product and the stock of a bundle
+func (p *Product) AfterFind(tx *gorm.DB) error {
+	p.Price = p.Price.In(p.Currency)
+	if p.SalePrice != nil {
+		salePrice := p.SalePrice.In(p.Currency)
+		p.SalePrice = &salePrice
+	}
+	now := time.Now()
+	p.OnSale = p.OnSaleAt(now)
+	p.EffectivePrice = p.EffectivePriceAt(now)
+	if p.IsBundle() {
+		return p.loadBundleStock(tx)
+	}
+	return nil
+}
+
+func saleApplies(salePrice *money.Money, startsAt, endsAt *time.Time, t time.Time) bool {
+	return salePrice != nil &&
+		(startsAt == nil || !startsAt.After(t)) &&
+		(endsAt == nil || endsAt.After(t))
+}
+
+// RecordPriceHistory adds a history record with the current pricing of the
+// product, unless it is the same as the last record
+func RecordPriceHistory(tx *gorm.DB, productID uint, changedByID *uint) error {
+	var product Product
+	if err := tx.Select("id", "price", "sale_price", "currency", "sale_starts_at", "sale_ends_at").First(&product, productID).Error; err != nil {
+		return err
+	}
+
+	var last PriceHistory
+	result := tx.Where("product_id = ?", productID).Order("created_at DESC, id DESC").Limit(1).Find(&last)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 && last.Price == product.Price &&
+		equalMoneyPtr(last.SalePrice, product.SalePrice) &&
+		equalTimePtr(last.SaleStartsAt, product.SaleStartsAt) &&
+		equalTimePtr(last.SaleEndsAt, product.SaleEndsAt) {
+		return nil
+	}
+
+	return tx.Create(&PriceHistory{
+		ProductID:    productID,
+		Price:        product.Price,
+		SalePrice:    product.SalePrice,
+		Currency:     product.Currency,
+		SaleStartsAt: product.SaleStartsAt,
+		SaleEndsAt:   product.SaleEndsAt,
+		ChangedByID:  changedByID,
+	}).Error
+}
+
+// LowestPrice returns the lowest price customers paid between from and to,
+// history must be ordered by date and start with the record in force at from.
+// ok is false when no record covers the period.
+func LowestPrice(history []PriceHistory, from, to time.Time) (lowest money.Money, ok bool) {
+	for i, record := range history {
+		start := record.CreatedAt
+		end := to
+		if i+1 < len(history) {
+			end = history[i+1].CreatedAt
+		}
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !start.Before(end) {
+			continue
+		}
+
+		// The regular price applies unless the sale covers the whole interval
+		regular := !(saleApplies(record.SalePrice, record.SaleStartsAt, record.SaleEndsAt, start) &&
+			(record.SaleEndsAt == nil || !record.SaleEndsAt.Before(end)))
+		// The sale price applies if the sale overlaps the interval
+		sale := record.SalePrice != nil &&
+			(record.SaleStartsAt == nil || record.SaleStartsAt.Before(end)) &&
+			(record.SaleEndsAt == nil || record.SaleEndsAt.After(start))
+
+		if regular && (!ok || record.Price.Amount < lowest.Amount) {
+			lowest, ok = record.Price, true
+		}
+		if sale && (!ok || record.SalePrice.Amount < lowest.Amount) {
+			lowest, ok = *record.SalePrice, true
+		}
+	}
+	return lowest, ok
+}
+
+func equalMoneyPtr(a, b *money.Money) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func equalTimePtr(a, b *time.Time) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && a.Equal(*b))
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"strings"
+	"talodu/money"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestCheckPriceColumns(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckPriceColumns(db); err != nil {
+		t.Errorf("empty database: %v", err)
+	}
+
+	db.Exec("CREATE TABLE orders (id INTEGER PRIMARY KEY, total_amount BIGINT, payment_amount BIGINT, currency VARCHAR(3))")
+	if err := CheckPriceColumns(db); err != nil {
+		t.Errorf("converted amounts: %v", err)
+	}
+
+	db.Exec("CREATE TABLE products (id INTEGER PRIMARY KEY, price DOUBLE PRECISION, sale_price DOUBLE PRECISION)")
+	if err := CheckPriceColumns(db); err == nil || !strings.Contains(err.Error(), "products.") {
+		t.Errorf("amounts in major units: error = %v, want one naming products", err)
+	}
+}
+
+func TestLowestPrice(t *testing.T) {
+	from := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 30)
+	day := func(n int) time.Time { return from.AddDate(0, 0, n) }
+	at := func(n int) *time.Time { d := day(n); return &d }
+	eur := func(amount int64) money.Money { return money.New(amount, "EUR") }
+	sale := func(amount int64) *money.Money { m := eur(amount); return &m }
+
+	tests := []struct {
+		name    string
+		history []PriceHistory
+		want    int64
+		wantOK  bool
+	}{
+		{"no history", nil, 0, false},
+		{"history after the period", []PriceHistory{
+			{Price: eur(1000), CreatedAt: day(31)},
+		}, 0, false},
+		{"regular price in force at from", []PriceHistory{
+			{Price: eur(1000), CreatedAt: day(-40)},
+		}, 1000, true},
+		{"records replaced before from are left out", []PriceHistory{
+			{Price: eur(500), CreatedAt: day(-20)},
+			{Price: eur(1000), CreatedAt: day(-5)},
+		}, 1000, true},
+		{"history starting after from", []PriceHistory{
+			{Price: eur(1200), CreatedAt: day(10)},
+			{Price: eur(1100), CreatedAt: day(20)},
+		}, 1100, true},
+		{"record starting at to", []PriceHistory{
+			{Price: eur(1000), CreatedAt: day(-1)},
+			{Price: eur(100), CreatedAt: day(30)},
+		}, 1000, true},
+		{"open-ended sale", []PriceHistory{
+			{Price: eur(1000), SalePrice: sale(800), CreatedAt: day(-10)},
+		}, 800, true},
+		{"sale starting mid-interval", []PriceHistory{
+			{Price: eur(1000), SalePrice: sale(800), SaleStartsAt: at(15), CreatedAt: day(-10)},
+		}, 800, true},
+		{"sale starting after to", []PriceHistory{
+			{Price: eur(1000), SalePrice: sale(800), SaleStartsAt: at(31), CreatedAt: day(-10)},
+		}, 1000, true},
+		{"sale ending mid-interval", []PriceHistory{
+			{Price: eur(1000), SalePrice: sale(700), SaleEndsAt: at(5), CreatedAt: day(-10)},
+		}, 700, true},
+		{"sale ended before from", []PriceHistory{
+			{Price: eur(1000), SalePrice: sale(700), SaleStartsAt: at(-20), SaleEndsAt: at(-1), CreatedAt: day(-30)},
+		}, 1000, true},
+		{"sale of a replaced record", []PriceHistory{
+			{Price: eur(1000), SalePrice: sale(600), CreatedAt: day(-30)},
+			{Price: eur(900), CreatedAt: day(-1)},
+		}, 900, true},
+		{"sale during the period only", []PriceHistory{
+			{Price: eur(1000), CreatedAt: day(-30)},
+			{Price: eur(1000), SalePrice: sale(750), CreatedAt: day(10)},
+			{Price: eur(1000), CreatedAt: day(12)},
+		}, 750, true},
+	}
+	for _, tt := range tests {
+		got, ok := LowestPrice(tt.history, from, to)
+		if ok != tt.wantOK || (ok && got != eur(tt.want)) {
+			t.Errorf("%s: LowestPrice = %v, %v, want %d, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
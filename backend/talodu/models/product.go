@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"talodu/i18n"
+	"talodu/money"
 	"time"
 
 	"gorm.io/gorm"
@@ -15,6 +17,7 @@ type ProductTranslation struct {
 	Language    string `json:"language" gorm:"size:5"` // en, fr, es
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	Draft       bool   `json:"draft" gorm:"default:false"` // Machine translation waiting for review
 }
 
 // Add this struct for API responses
@@ -32,6 +35,7 @@ type ProductAboutTranslation struct {
 	ProductAboutID uint      `json:"product_about_id"`
 	Language       string    `json:"language" gorm:"size:5"` // en, fr, es
 	AboutText      string    `json:"about_text" binding:"required,max=255"`
+	Draft          bool      `json:"draft" gorm:"default:false"` // Machine translation waiting for review
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 }
@@ -46,35 +50,194 @@ type ProductAbout struct {
 	UpdatedAt    time.Time                 `json:"updated_at"`
 }
 
+// Localize replaces the text by its translation in lang, or in the first
+// language of its fallback chain that has one. Drafts are left out, see
+// Product.Localize.
+func (a *ProductAbout) Localize(lang string) {
+	a.localize(lang, false)
+}
+
+// LocalizeWithDrafts localizes the text like Localize, drafts included
+func (a *ProductAbout) LocalizeWithDrafts(lang string) {
+	a.localize(lang, true)
+}
+
+func (a *ProductAbout) localize(lang string, drafts bool) {
+	if !drafts {
+		reviewed := a.Translations[:0:0]
+		for _, t := range a.Translations {
+			if !t.Draft {
+				reviewed = append(reviewed, t)
+			}
+		}
+		a.Translations = reviewed
+	}
+	i := i18n.Pick(lang, len(a.Translations), func(i int) string {
+		if a.Translations[i].AboutText == "" {
+			return ""
+		}
+		return a.Translations[i].Language
+	})
+	if i >= 0 {
+		a.AboutText = a.Translations[i].AboutText
+	}
+}
+
 type Product struct {
 	gorm.Model
-	Name                  string               `json:"name" gorm:"not null"`
-	Description           string               `json:"description"`
-	Slug                  string               `gorm:"unique"`
-	Price                 float64              `json:"price"`
-	Stock                 int                  `json:"stock"`
-	ShopID                uint                 `json:"ShopID" gorm:"column:shop_id"`
-	Shop                  Shop                 `json:"shop" gorm:"foreignKey:ShopID"`
-	Categories            []Category           `json:"categories" gorm:"many2many:product_categories;"`
-	Images                []ProductImage       `json:"images" gorm:"foreignKey:ProductID"`
-	Translations          []ProductTranslation `json:"translations" gorm:"foreignKey:ProductID"`
-	Abouts                []ProductAbout       `json:"abouts" gorm:"foreignKey:ProductID"`
-	AboutsWithTranlations []ProductAbout       `json:"aboutst" gorm:"foreignKey:ProductID"`
-	IsFeatured            bool                 `json:"isFeatured" gorm:"default:false"`
-	FeaturedOrder         int                  `json:"featuredOrder" gorm:"default:0"`
-	IsVisible             bool                 `json:"isVisible" gorm:"default:true"`
+	Name                  string                  `json:"name" gorm:"not null"`
+	Description           string                  `json:"description"`
+	Slug                  string                  `gorm:"unique"`
+	SKU                   string                  `json:"sku" gorm:"column:sku;size:64;uniqueIndex:idx_products_shop_sku,priority:2,where:sku <> '' AND deleted_at IS NULL"` // Seller's reference, unique in the shop
+	GTIN                  string                  `json:"gtin" gorm:"column:gtin;size:14;index"`                                                                             // EAN/UPC barcode, see NormalizeGTIN
+	Price                 money.Money             `json:"price"`                                                                                                             // Regular price, shown as the compare-at price during a sale
+	SalePrice             *money.Money            `json:"sale_price"`
+	SaleStartsAt          *time.Time              `json:"sale_starts_at"` // The sale has no start or end when nil
+	SaleEndsAt            *time.Time              `json:"sale_ends_at"`
+	EffectivePrice        money.Money             `json:"effective_price" gorm:"-"` // Price to pay now, see EffectivePriceAt
+	OnSale                bool                    `json:"on_sale" gorm:"-"`
+	Currency              string                  `json:"currency" gorm:"size:3"` // Currency of the prices, the one of the shop when the product was created
+	Stock                 int                     `json:"stock"`                  // Derived from the components of a bundle, see StockSQL
+	Type                  ProductType             `json:"type" gorm:"size:20;default:'simple'"`
+	BundleComponents      []BundleComponent       `json:"bundle_components,omitempty" gorm:"foreignKey:BundleID"`
+	Rating                float64                 `json:"rating" gorm:"default:0"` // Average customer rating, 0 to 5
+	ShopID                uint                    `json:"ShopID" gorm:"column:shop_id;uniqueIndex:idx_products_shop_sku,priority:1,where:sku <> '' AND deleted_at IS NULL"`
+	Shop                  Shop                    `json:"shop" gorm:"foreignKey:ShopID"`
+	Categories            []Category              `json:"categories" gorm:"many2many:product_categories;"`
+	Images                []ProductImage          `json:"images" gorm:"foreignKey:ProductID"`
+	Translations          []ProductTranslation    `json:"translations" gorm:"foreignKey:ProductID"`
+	Abouts                []ProductAbout          `json:"abouts" gorm:"foreignKey:ProductID"`
+	AboutsWithTranlations []ProductAbout          `json:"aboutst" gorm:"foreignKey:ProductID"`
+	Attributes            []ProductAttributeValue `json:"attributes,omitempty" gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE"`
+	IsFeatured            bool                    `json:"isFeatured" gorm:"default:false"`
+	FeaturedOrder         int                     `json:"featuredOrder" gorm:"default:0"`
+	IsVisible             bool                    `json:"isVisible" gorm:"default:true"`
+	// Lifecycle, customers only see published products, see ProductStatus
+	Status          ProductStatus `json:"status" gorm:"size:20;default:'published';index"`
+	PublishAt       *time.Time    `json:"publish_at"`   // Scheduled publication of an approved product
+	UnpublishAt     *time.Time    `json:"unpublish_at"` // Scheduled archiving of a published product
+	SubmittedByID   *uint         `json:"submitted_by_id"`
+	ReviewedByID    *uint         `json:"reviewed_by_id"`
+	ReviewedAt      *time.Time    `json:"reviewed_at"`
+	RejectionReason string        `json:"rejection_reason" gorm:"size:1000"`
+}
+
+// Localize replaces the name and description by their translation in lang,
+// or in the first language of its fallback chain that has one, and
+// localizes the loaded images, categories, abouts, attributes and bundle
+// components. Drafts, machine translations waiting for review, are left out
+// of the translations: customers only see reviewed texts.
+func (p *Product) Localize(lang string) {
+	p.localize(lang, false)
+}
+
+// LocalizeWithDrafts localizes the product like Localize, drafts included,
+// for the back office where they are reviewed
+func (p *Product) LocalizeWithDrafts(lang string) {
+	p.localize(lang, true)
+}
+
+func (p *Product) localize(lang string, drafts bool) {
+	if !drafts {
+		reviewed := p.Translations[:0:0]
+		for _, t := range p.Translations {
+			if !t.Draft {
+				reviewed = append(reviewed, t)
+			}
+		}
+		p.Translations = reviewed
+	}
+	if i := i18n.Pick(lang, len(p.Translations), func(i int) string { return p.Translations[i].Language }); i >= 0 {
+		p.Name = p.Translations[i].Name
+		p.Description = p.Translations[i].Description
+	}
+	for i := range p.Images {
+		p.Images[i].Localize(lang)
+	}
+	for i := range p.Categories {
+		p.Categories[i].localize(lang, drafts)
+	}
+	for i := range p.Abouts {
+		p.Abouts[i].localize(lang, drafts)
+	}
+	for i := range p.Attributes {
+		p.Attributes[i].Localize(lang)
+	}
+	for i := range p.BundleComponents {
+		if p.BundleComponents[i].Component != nil {
+			p.BundleComponents[i].Component.localize(lang, drafts)
+		}
+	}
+}
+
+// ProductStatus is the step of a product in its lifecycle: shops write
+// drafts and submit them for review, admins approve or reject them, and
+// published products are eventually archived.
+type ProductStatus string
+
+const (
+	ProductStatusDraft         ProductStatus = "draft"
+	ProductStatusPendingReview ProductStatus = "pending_review"
+	ProductStatusPublished     ProductStatus = "published"
+	ProductStatusArchived      ProductStatus = "archived"
+)
+
+// productTransitions lists the statuses a product can move to from each status
+var productTransitions = map[ProductStatus][]ProductStatus{
+	ProductStatusDraft:         {ProductStatusPendingReview},
+	ProductStatusPendingReview: {ProductStatusPublished, ProductStatusDraft},
+	ProductStatusPublished:     {ProductStatusArchived, ProductStatusDraft},
+	ProductStatusArchived:      {ProductStatusDraft},
+}
+
+// CanTransitionTo tells whether the product can move to status
+func (p *Product) CanTransitionTo(status ProductStatus) bool {
+	for _, next := range productTransitions[p.Status] {
+		if next == status {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLive tells whether a product with this status and publication date is
+// shown to customers at now
+func IsLive(status ProductStatus, publishAt *time.Time, now time.Time) bool {
+	return status == ProductStatusPublished && (publishAt == nil || !publishAt.After(now))
+}
+
+// Orderable tells whether customers can buy the product at now: it is
+// visible and live
+func (p *Product) Orderable(now time.Time) bool {
+	return p.IsVisible && IsLive(p.Status, p.PublishAt, now)
 }
 
 func (p *Product) BeforeCreate(tx *gorm.DB) (err error) {
-    if p.Name == "" {
-        return fmt.Errorf("product name cannot be empty")
-    }
-    return nil
+	if p.Name == "" {
+		return fmt.Errorf("product name cannot be empty")
+	}
+	// New products start as drafts, the column default publishes the products created before the workflow
+	if p.Status == "" {
+		p.Status = ProductStatusDraft
+	}
+	if p.Currency == "" {
+		p.Currency = p.Price.Currency
+	}
+	if p.Currency == "" {
+		return fmt.Errorf("product currency cannot be empty")
+	}
+	p.Price = p.Price.In(p.Currency)
+	return nil
 }
 
 // Generate slug after the record is created
 func (p *Product) AfterCreate(tx *gorm.DB) (err error) {
 	p.Slug = generateSlug(p.Name) + "-" + fmt.Sprint(p.ID)
+	// The is_visible default applied on insert only holds for live products
+	p.IsVisible = IsLive(p.Status, p.PublishAt, time.Now())
+	if err := RecordPriceHistory(tx, p.ID, nil); err != nil {
+		return err
+	}
 	return tx.Save(p).Error
 }
 
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Notification types of the product questions
+const (
+	NotificationProductQuestion  = "product_question"
+	NotificationQuestionAnswered = "question_answered"
+)
+
+// ModerationStatus tells whether a question or an answer is shown on the product page
+type ModerationStatus string
+
+const (
+	ModerationVisible ModerationStatus = "visible"
+	ModerationHidden  ModerationStatus = "hidden" // Hidden by an admin
+)
+
+// ProductQuestion is a question a customer asks about a product, answered
+// by the shop or by customers who ordered the product
+type ProductQuestion struct {
+	gorm.Model
+	ProductID        uint             `json:"product_id" gorm:"index"`
+	UserID           uint             `json:"user_id" gorm:"index"`
+	AuthorName       string           `json:"author_name" gorm:"size:255"` // Username when the question was asked
+	Body             string           `json:"body" gorm:"size:1000"`
+	Status           ModerationStatus `json:"status" gorm:"size:20;default:'visible';index"`
+	ModerationReason string           `json:"moderation_reason,omitempty" gorm:"size:500"`
+	Votes            int              `json:"votes" gorm:"default:0"` // Upvotes minus downvotes
+	AnswerCount      int              `json:"answer_count" gorm:"default:0"`
+	Answers          []ProductAnswer  `json:"answers" gorm:"foreignKey:QuestionID"`
+}
+
+// ProductAnswer is an answer to a product question. IsSeller is set when the
+// owner or an employee of the shop of the product answered.
+type ProductAnswer struct {
+	gorm.Model
+	QuestionID       uint             `json:"question_id" gorm:"index"`
+	UserID           uint             `json:"user_id" gorm:"index"`
+	AuthorName       string           `json:"author_name" gorm:"size:255"`
+	Body             string           `json:"body" gorm:"size:2000"`
+	IsSeller         bool             `json:"is_seller" gorm:"default:false"`
+	Status           ModerationStatus `json:"status" gorm:"size:20;default:'visible';index"`
+	ModerationReason string           `json:"moderation_reason,omitempty" gorm:"size:500"`
+	Votes            int              `json:"votes" gorm:"default:0"`
+}
+
+// QAVote is the vote of a user on a question or an answer, Value is 1 or -1
+type QAVote struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	UserID     uint      `json:"user_id" gorm:"uniqueIndex:idx_qa_votes_user_target"`
+	TargetType string    `json:"target_type" gorm:"size:20;uniqueIndex:idx_qa_votes_user_target"` // question or answer
+	TargetID   uint      `json:"target_id" gorm:"uniqueIndex:idx_qa_votes_user_target"`
+	Value      int       `json:"value"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
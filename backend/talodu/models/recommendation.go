@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecommendationType is how a recommendation was computed
+type RecommendationType string
+
+const (
+	// RecommendationBoughtTogether products are in the same orders
+	RecommendationBoughtTogether RecommendationType = "bought_together"
+	// RecommendationAlsoViewed products are viewed by the same customers
+	RecommendationAlsoViewed RecommendationType = "also_viewed"
+)
+
+// ProductRecommendation recommends RecommendedID on the page of ProductID.
+// The table is recomputed by a background job, see jobs.RefreshRecommendations.
+type ProductRecommendation struct {
+	ID            uint               `json:"id" gorm:"primaryKey"`
+	Type          RecommendationType `json:"type" gorm:"size:20;not null;uniqueIndex:idx_product_recommendations_pair,priority:1"`
+	ProductID     uint               `json:"product_id" gorm:"not null;uniqueIndex:idx_product_recommendations_pair,priority:2"`
+	RecommendedID uint               `json:"recommended_id" gorm:"not null;uniqueIndex:idx_product_recommendations_pair,priority:3"`
+	Score         float64            `json:"score"` // Number of orders or customers the products share
+	UpdatedAt     time.Time          `json:"updated_at"`
+}
+
+// ValidRecommendationType tells whether t is a computed recommendation type
+func ValidRecommendationType(t RecommendationType) bool {
+	return t == RecommendationBoughtTogether || t == RecommendationAlsoViewed
+}
+
+// RecommendedProductIDs returns the visible products recommended for any of
+// productIDs, the best scores first. An empty type takes every type, the
+// excluded products are left out.
+func RecommendedProductIDs(db *gorm.DB, t RecommendationType, productIDs, exclude []uint, limit int) ([]uint, error) {
+	ids := []uint{}
+	if len(productIDs) == 0 {
+		return ids, nil
+	}
+	query := db.Model(&ProductRecommendation{}).
+		Joins("JOIN products ON products.id = product_recommendations.recommended_id AND products.deleted_at IS NULL AND products.is_visible").
+		Where("product_recommendations.product_id IN ?", productIDs)
+	if t != "" {
+		query = query.Where("product_recommendations.type = ?", t)
+	}
+	if len(exclude) > 0 {
+		query = query.Where("product_recommendations.recommended_id NOT IN ?", exclude)
+	}
+	err := query.Group("product_recommendations.recommended_id").
+		Order("SUM(product_recommendations.score) DESC, product_recommendations.recommended_id").
+		Limit(limit).
+		Pluck("product_recommendations.recommended_id", &ids).Error
+	return ids, err
+}
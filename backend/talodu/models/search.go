@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// SearchSynonym is a set of interchangeable search terms for one language,
+// e.g. ["smartphone", "téléphone", "portable"]. Searching for any term of the
+// set also matches products described with the other ones.
+type SearchSynonym struct {
+	gorm.Model
+	Language string                      `json:"language" gorm:"size:5;index"` // en, fr, es
+	Terms    datatypes.JSONSlice[string] `json:"terms" gorm:"type:jsonb"`
+}
+
+// SearchStopWord is a word that is ignored when building product search queries
+type SearchStopWord struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Language  string    `json:"language" gorm:"size:5;uniqueIndex:idx_search_stop_words_lang_word"`
+	Word      string    `json:"word" gorm:"size:100;uniqueIndex:idx_search_stop_words_lang_word"`
+	CreatedAt time.Time `json:"created_at"`
+}
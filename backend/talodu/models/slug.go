@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Entities whose slugs are kept in the history
+const (
+	SlugEntityProduct = "product"
+	SlugEntityShop    = "shop"
+)
+
+// SlugHistory is a former slug of a product or a shop. Links using it are
+// permanently redirected to the current slug, so shared links and search
+// engines keep working after a rename.
+type SlugHistory struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	EntityType string    `json:"entity_type" gorm:"size:20;uniqueIndex:idx_slug_histories_type_slug,priority:1"`
+	EntityID   uint      `json:"entity_id" gorm:"index"`
+	Slug       string    `json:"slug" gorm:"size:255;uniqueIndex:idx_slug_histories_type_slug,priority:2"`
+	CreatedAt  time.Time `json:"created_at"` // When the slug was replaced
+}
+
+// RecordSlugChange keeps oldSlug in the history of the entity. A slug taken
+// back by a rename leaves the history, and a slug used by several entities
+// over time redirects to the last one.
+func RecordSlugChange(tx *gorm.DB, entityType string, entityID uint, oldSlug, newSlug string) error {
+	if oldSlug == newSlug {
+		return nil
+	}
+	if err := tx.Where("entity_type = ? AND slug = ?", entityType, newSlug).Delete(&SlugHistory{}).Error; err != nil {
+		return err
+	}
+	if oldSlug == "" {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "entity_type"}, {Name: "slug"}},
+		DoUpdates: clause.AssignmentColumns([]string{"entity_id", "created_at"}),
+	}).Create(&SlugHistory{EntityType: entityType, EntityID: entityID, Slug: oldSlug}).Error
+}
+
+// FindSlugOwner returns the ID of the entity a former slug belongs to
+func FindSlugOwner(db *gorm.DB, entityType, slug string) (uint, bool) {
+	var history SlugHistory
+	result := db.Where("entity_type = ? AND slug = ?", entityType, slug).Limit(1).Find(&history)
+	return history.EntityID, result.Error == nil && result.RowsAffected > 0
+}
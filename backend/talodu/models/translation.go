@@ -0,0 +1,84 @@
+package models
+
+import (
+	"context"
+	"talodu/i18n"
+	"talodu/translate"
+
+	"gorm.io/gorm"
+)
+
+// TranslationSummary tells what a machine translation created, per language
+type TranslationSummary struct {
+	Product bool `json:"product"`
+	Abouts  int  `json:"abouts"`
+}
+
+// MachineTranslateProduct creates draft translations of the product and of
+// its abouts for the languages they are missing in
+func MachineTranslateProduct(ctx context.Context, db *gorm.DB, translator translate.Translator, product *Product, languages []string) (map[string]TranslationSummary, error) {
+	var abouts []ProductAbout
+	if err := db.Preload("Translations").Where("product_id = ?", product.ID).Order("item_order").Find(&abouts).Error; err != nil {
+		return nil, err
+	}
+	var translations []ProductTranslation
+	if err := db.Where("product_id = ?", product.ID).Find(&translations).Error; err != nil {
+		return nil, err
+	}
+
+	summary := make(map[string]TranslationSummary)
+	for _, lang := range languages {
+		var result TranslationSummary
+
+		exists := false
+		for _, t := range translations {
+			exists = exists || t.Language == lang
+		}
+		if !exists {
+			texts, err := translator.Translate(ctx, []string{product.Name, product.Description}, i18n.ContentLanguage, lang)
+			if err != nil {
+				return summary, err
+			}
+			if err := db.Create(&ProductTranslation{
+				ProductID:   product.ID,
+				Language:    lang,
+				Name:        texts[0],
+				Description: texts[1],
+				Draft:       true,
+			}).Error; err != nil {
+				return summary, err
+			}
+			result.Product = true
+		}
+
+		var missing []ProductAbout
+		var texts []string
+		for _, about := range abouts {
+			translated := false
+			for _, t := range about.Translations {
+				translated = translated || t.Language == lang
+			}
+			if !translated {
+				missing = append(missing, about)
+				texts = append(texts, about.AboutText)
+			}
+		}
+		if len(missing) > 0 {
+			translatedTexts, err := translator.Translate(ctx, texts, i18n.ContentLanguage, lang)
+			if err != nil {
+				return summary, err
+			}
+			drafts := make([]ProductAboutTranslation, len(missing))
+			for i, about := range missing {
+				drafts[i] = ProductAboutTranslation{ProductAboutID: about.ID, Language: lang, AboutText: translatedTexts[i], Draft: true}
+			}
+			if err := db.Create(&drafts).Error; err != nil {
+				return summary, err
+			}
+			result.Abouts = len(drafts)
+		}
+
+		summary[lang] = result
+	}
+	return summary, nil
+}
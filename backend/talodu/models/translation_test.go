@@ -0,0 +1,110 @@
+package models
+
+import (
+	"context"
+	"talodu/translate"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTranslationTestDB returns an in-memory database with the translation tables
+func newTranslationTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&ProductTranslation{}, &ProductAbout{}, &ProductAboutTranslation{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestMachineTranslateProduct(t *testing.T) {
+	db := newTranslationTestDB(t)
+	product := Product{Name: "Chaise", Description: "En chêne"}
+	product.ID = 1
+
+	// The English name was written by the shop, one about is already in Spanish
+	db.Create(&ProductTranslation{ProductID: 1, Language: "en", Name: "Chair", Description: "Oak"})
+	abouts := []ProductAbout{
+		{ProductID: 1, ItemOrder: 1, AboutText: "Massif"},
+		{ProductID: 1, ItemOrder: 2, AboutText: "Fait main"},
+	}
+	db.Create(&abouts)
+	db.Create(&ProductAboutTranslation{ProductAboutID: abouts[0].ID, Language: "es", AboutText: "Maciza"})
+
+	summary, err := MachineTranslateProduct(context.Background(), db, translate.Fake{}, &product, []string{"en", "es"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]TranslationSummary{
+		"en": {Product: false, Abouts: 2},
+		"es": {Product: true, Abouts: 1},
+	}
+	for lang, w := range want {
+		if summary[lang] != w {
+			t.Errorf("summary[%s] = %+v, want %+v", lang, summary[lang], w)
+		}
+	}
+
+	var translations []ProductTranslation
+	db.Where("product_id = ?", 1).Order("language").Find(&translations)
+	if len(translations) != 2 {
+		t.Fatalf("got %d product translations, want 2", len(translations))
+	}
+	if en := translations[0]; en.Name != "Chair" || en.Draft {
+		t.Errorf("the reviewed translation changed: %+v", en)
+	}
+	if es := translations[1]; es.Name != "[es] Chaise" || es.Description != "[es] En chêne" || !es.Draft {
+		t.Errorf("es translation = %+v, want a draft of the machine translation", es)
+	}
+
+	var aboutTranslations []ProductAboutTranslation
+	db.Where("language = ?", "es").Order("product_about_id").Find(&aboutTranslations)
+	if len(aboutTranslations) != 2 {
+		t.Fatalf("got %d es about translations, want 2", len(aboutTranslations))
+	}
+	if first := aboutTranslations[0]; first.AboutText != "Maciza" || first.Draft {
+		t.Errorf("the reviewed about translation changed: %+v", first)
+	}
+	if second := aboutTranslations[1]; second.AboutText != "[es] Fait main" || !second.Draft {
+		t.Errorf("es about translation = %+v, want a draft of the machine translation", second)
+	}
+
+	// Everything is translated now, a second run adds nothing
+	summary, err = MachineTranslateProduct(context.Background(), db, translate.Fake{}, &product, []string{"en", "es"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for lang, s := range summary {
+		if s.Product || s.Abouts != 0 {
+			t.Errorf("second run summary[%s] = %+v, want nothing translated", lang, s)
+		}
+	}
+}
+
+func TestDraftTranslationsAreNotPublic(t *testing.T) {
+	db := newTranslationTestDB(t)
+	product := Product{Name: "Chaise", Description: "En chêne"}
+	product.ID = 1
+	if _, err := MachineTranslateProduct(context.Background(), db, translate.Fake{}, &product, []string{"es"}); err != nil {
+		t.Fatal(err)
+	}
+	db.Where("product_id = ?", 1).Find(&product.Translations)
+
+	public := product
+	public.Localize("es")
+	if public.Name != "Chaise" || len(public.Translations) != 0 {
+		t.Errorf("Localize used or exposed a draft: name %q, %d translations", public.Name, len(public.Translations))
+	}
+
+	backOffice := product
+	backOffice.LocalizeWithDrafts("es")
+	if backOffice.Name != "[es] Chaise" || len(backOffice.Translations) != 1 {
+		t.Errorf("LocalizeWithDrafts = name %q, %d translations, want the draft", backOffice.Name, len(backOffice.Translations))
+	}
+}
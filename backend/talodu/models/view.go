@@ -0,0 +1,113 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ProductView is the last visit of a product page by a signed-in user or by
+// an anonymous session, see auth.SessionID: there is one row per viewer and
+// product. The views of a session move to the account when it signs in, see
+// MergeProductViews, and old views are pruned, see PruneProductViews.
+type ProductView struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ProductID uint      `json:"product_id" gorm:"not null;index;uniqueIndex:idx_product_views_user_product,priority:2,where:user_id IS NOT NULL;uniqueIndex:idx_product_views_session_product,priority:2,where:user_id IS NULL"`
+	UserID    *uint     `json:"user_id" gorm:"index:idx_product_views_user,priority:1;uniqueIndex:idx_product_views_user_product,priority:1"`
+	SessionID string    `json:"-" gorm:"size:64;index:idx_product_views_session,priority:1;uniqueIndex:idx_product_views_session_product,priority:1"`
+	ViewedAt  time.Time `json:"viewed_at" gorm:"index:idx_product_views_user,priority:2;index:idx_product_views_session,priority:2;index"`
+}
+
+// Viewer is who views products: a user, or an anonymous session when UserID
+// is nil
+type Viewer struct {
+	UserID    *uint
+	SessionID string
+}
+
+// IsZero tells whether the viewer can't be identified
+func (v Viewer) IsZero() bool {
+	return v.UserID == nil && v.SessionID == ""
+}
+
+// scope restricts a product_views query to the views of v
+func (v Viewer) scope(db *gorm.DB) *gorm.DB {
+	if v.UserID != nil {
+		return db.Where("product_views.user_id = ?", *v.UserID)
+	}
+	return db.Where("product_views.session_id = ? AND product_views.user_id IS NULL", v.SessionID)
+}
+
+// RecordProductView records that v viewed the product now
+func RecordProductView(db *gorm.DB, productID uint, v Viewer) error {
+	if v.IsZero() {
+		return nil
+	}
+	conflict := clause.OnConflict{
+		Columns:     []clause.Column{{Name: "user_id"}, {Name: "product_id"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "user_id IS NOT NULL"}}},
+		DoUpdates:   clause.AssignmentColumns([]string{"viewed_at"}),
+	}
+	if v.UserID == nil {
+		conflict.Columns = []clause.Column{{Name: "session_id"}, {Name: "product_id"}}
+		conflict.TargetWhere = clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "user_id IS NULL"}}}
+	}
+	return db.Clauses(conflict).Create(&ProductView{ProductID: productID, UserID: v.UserID, SessionID: v.SessionID, ViewedAt: time.Now()}).Error
+}
+
+// MergeProductViews gives the views of an anonymous session to the user who
+// signed in from it, the products both viewed keep the latest view
+func MergeProductViews(db *gorm.DB, sessionID string, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`UPDATE product_views SET viewed_at = session_views.viewed_at
+			FROM product_views session_views
+			WHERE product_views.user_id = ? AND session_views.session_id = ? AND session_views.user_id IS NULL
+				AND session_views.product_id = product_views.product_id AND session_views.viewed_at > product_views.viewed_at`,
+			userID, sessionID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("session_id = ? AND user_id IS NULL", sessionID).
+			Where("product_id IN (SELECT product_id FROM product_views WHERE user_id = ?)", userID).
+			Delete(&ProductView{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&ProductView{}).
+			Where("session_id = ? AND user_id IS NULL", sessionID).
+			Update("user_id", userID).Error
+	})
+}
+
+// PruneProductViews deletes the views of users older than retention and the
+// views of anonymous sessions older than anonymousRetention
+func PruneProductViews(db *gorm.DB, retention, anonymousRetention time.Duration) (int64, error) {
+	now := time.Now()
+	result := db.Where("(user_id IS NOT NULL AND viewed_at < ?) OR (user_id IS NULL AND viewed_at < ?)",
+		now.Add(-retention), now.Add(-anonymousRetention)).
+		Delete(&ProductView{})
+	return result.RowsAffected, result.Error
+}
+
+// RecentlyViewedProductIDs returns the visible products v viewed, the most
+// recently viewed first
+func RecentlyViewedProductIDs(db *gorm.DB, v Viewer, limit int) ([]uint, error) {
+	ids := []uint{}
+	if v.IsZero() {
+		return ids, nil
+	}
+	err := v.scope(db.Model(&ProductView{})).
+		Joins("JOIN products ON products.id = product_views.product_id AND products.deleted_at IS NULL AND products.is_visible").
+		Group("product_views.product_id").
+		Order("MAX(product_views.viewed_at) DESC").
+		Limit(limit).
+		Pluck("product_views.product_id", &ids).Error
+	return ids, err
+}
+
+// ClearProductViews deletes the views of v
+func ClearProductViews(db *gorm.DB, v Viewer) error {
+	if v.IsZero() {
+		return nil
+	}
+	return v.scope(db).Delete(&ProductView{}).Error
+}
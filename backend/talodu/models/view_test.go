@@ -0,0 +1,92 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newViewTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&ProductView{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestRecordProductViewKeepsOneRowPerViewer(t *testing.T) {
+	db := newViewTestDB(t)
+	userID := uint(7)
+	user, session := Viewer{UserID: &userID}, Viewer{SessionID: "abc"}
+
+	for i := 0; i < 3; i++ {
+		for _, v := range []Viewer{user, session} {
+			if err := RecordProductView(db, 1, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := RecordProductView(db, 2, session); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	db.Model(&ProductView{}).Count(&count)
+	if count != 3 {
+		t.Errorf("got %d views, want one per viewer and product: 3", count)
+	}
+}
+
+func TestMergeProductViews(t *testing.T) {
+	db := newViewTestDB(t)
+	userID := uint(7)
+	old, recent := time.Now().Add(-time.Hour), time.Now()
+	db.Create(&[]ProductView{
+		{ProductID: 1, UserID: &userID, ViewedAt: old},
+		{ProductID: 1, SessionID: "abc", ViewedAt: recent},
+		{ProductID: 2, SessionID: "abc", ViewedAt: recent},
+	})
+
+	if err := MergeProductViews(db, "abc", userID); err != nil {
+		t.Fatal(err)
+	}
+
+	var views []ProductView
+	db.Order("product_id").Find(&views)
+	if len(views) != 2 {
+		t.Fatalf("got %d views, want 2", len(views))
+	}
+	for _, view := range views {
+		if view.UserID == nil || *view.UserID != userID {
+			t.Errorf("view of product %d wasn't given to the user", view.ProductID)
+		}
+	}
+	if !views[0].ViewedAt.Equal(recent) {
+		t.Errorf("product 1 viewed at %v, want the latest view %v", views[0].ViewedAt, recent)
+	}
+}
+
+func TestPruneProductViews(t *testing.T) {
+	db := newViewTestDB(t)
+	userID := uint(7)
+	db.Create(&[]ProductView{
+		{ProductID: 1, UserID: &userID, ViewedAt: time.Now().Add(-10 * 24 * time.Hour)},
+		{ProductID: 1, SessionID: "abc", ViewedAt: time.Now().Add(-10 * 24 * time.Hour)},
+		{ProductID: 2, SessionID: "abc", ViewedAt: time.Now()},
+	})
+
+	pruned, err := PruneProductViews(db, 30*24*time.Hour, 7*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 1 {
+		t.Errorf("pruned %d views, want the old anonymous one", pruned)
+	}
+}
@@ -0,0 +1,227 @@
+// Package money has the Money type of prices and totals: an integer amount of
+// minor units of a currency, e.g. 1250 EUR cents for 12.50 EUR, so that sums
+// and comparisons are exact.
+//
+// The database stores the amount alone, in a BIGINT column; the currency is a
+// sibling column of the row that models copy into the Money after loading it.
+// In JSON a Money is a number in major units, 12.50 for 1250 EUR cents, the
+// currency being a sibling field like in the database.
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"talodu/currency"
+)
+
+// ErrCurrencyMismatch is returned by operations on amounts of two currencies
+var ErrCurrencyMismatch = errors.New("money: currencies differ")
+
+// Money is an amount in minor units of a currency
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// New returns amount minor units of code
+func New(amount int64, code string) Money {
+	return Money{Amount: amount, Currency: currency.Normalize(code)}
+}
+
+// FromMajor converts an amount in major units, rounded to the minor unit of
+// code, halves away from zero, see currency.Round
+func FromMajor(amount float64, code string) Money {
+	return New(int64(math.Round(currency.Round(amount, code)*float64(scale(code)))), code)
+}
+
+// Parse reads a decimal amount in major units, e.g. "12.50" or "-3". It is
+// exact and fails when the amount has more decimals than the currency.
+func Parse(s, code string) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, fraction, _ := strings.Cut(digits, ".")
+	decimals := currency.Decimals(code)
+	if whole == "" && fraction == "" || !isDigits(whole) || !isDigits(fraction) {
+		return Money{}, fmt.Errorf("money: invalid amount %q", s)
+	}
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > decimals {
+		return Money{}, fmt.Errorf("money: %q has more than %d decimals", s, decimals)
+	}
+	fraction += strings.Repeat("0", decimals-len(fraction))
+
+	amount, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if whole+fraction == "" {
+		amount, err = 0, nil
+	}
+	if err != nil {
+		return Money{}, fmt.Errorf("money: amount %q out of range", s)
+	}
+	if negative {
+		amount = -amount
+	}
+	return New(amount, code), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// scale is the number of minor units in a major unit of code
+func scale(code string) int64 {
+	s := int64(1)
+	for i := 0; i < currency.Decimals(code); i++ {
+		s *= 10
+	}
+	return s
+}
+
+// Major returns the amount in major units, for display and rates only
+func (m Money) Major() float64 {
+	return float64(m.Amount) / float64(scale(m.Currency))
+}
+
+// Decimal formats the amount in major units with the decimals of the
+// currency: "12.50" for 1250 EUR cents, "1500" for 1500 XAF
+func (m Money) Decimal() string {
+	decimals := currency.Decimals(m.Currency)
+	sign, amount := "", uint64(m.Amount)
+	if m.Amount < 0 {
+		sign, amount = "-", uint64(-m.Amount)
+	}
+	digits := strconv.FormatUint(amount, 10)
+	if decimals == 0 {
+		return sign + digits
+	}
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-decimals] + "." + digits[len(digits)-decimals:]
+}
+
+// String formats the amount with its currency, "12.50 EUR"
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.Decimal()
+	}
+	return m.Decimal() + " " + m.Currency
+}
+
+// IsZero tells whether the amount is zero
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// In returns the amount in code, without conversion; models use it to set
+// the currency of the amounts they load
+func (m Money) In(code string) Money {
+	return New(m.Amount, code)
+}
+
+// Add returns m + other, both must be in the same currency
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// Sub returns m - other, both must be in the same currency
+func (m Money) Sub(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return Money{Amount: m.Amount - other.Amount, Currency: m.Currency}, nil
+}
+
+// Mul returns m times a quantity
+func (m Money) Mul(quantity int) Money {
+	return Money{Amount: m.Amount * int64(quantity), Currency: m.Currency}
+}
+
+// Cmp returns -1, 0 or +1 when m is lower than, equal to or greater than
+// other, both must be in the same currency
+func (m Money) Cmp(other Money) (int, error) {
+	if m.Currency != other.Currency {
+		return 0, ErrCurrencyMismatch
+	}
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Convert converts m to code with rate, the value of one major unit of m in
+// major units of code, rounded to the minor unit of code
+func (m Money) Convert(rate float64, code string) Money {
+	return FromMajor(m.Major()*rate, code)
+}
+
+// Value stores the amount in minor units, see the package documentation
+func (m Money) Value() (driver.Value, error) {
+	return m.Amount, nil
+}
+
+// Scan reads an amount in minor units, the currency is set by the model
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		m.Amount = 0
+	case int64:
+		m.Amount = v
+	case float64:
+		m.Amount = int64(math.Round(v))
+	case []byte:
+		return m.Scan(string(v))
+	case string:
+		amount, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("money: cannot scan %q", v)
+		}
+		m.Amount = amount
+	default:
+		return fmt.Errorf("money: cannot scan %T", value)
+	}
+	return nil
+}
+
+// GormDataType is the column type of Money fields
+func (Money) GormDataType() string {
+	return "bigint"
+}
+
+// MarshalJSON writes the amount as a number in major units with the decimals
+// of the currency, 12.50 for 1250 EUR cents
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.Decimal()), nil
+}
+
+// UnmarshalJSON reads a number in major units, or a decimal string, in the
+// currency already set on m, the sibling currency field being unknown yet
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var amount json.Number
+	if err := json.Unmarshal(data, &amount); err != nil {
+		return err
+	}
+	parsed, err := Parse(amount.String(), m.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
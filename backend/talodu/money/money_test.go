@@ -0,0 +1,203 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"testing/quick"
+)
+
+// Currencies with 0, 2 and 3 decimals
+var testCurrencies = []string{"XAF", "EUR", "KWD"}
+
+func TestAddSubProperties(t *testing.T) {
+	for _, code := range testCurrencies {
+		commutative := func(a, b int64) bool {
+			x, y := New(a, code), New(b, code)
+			xy, err1 := x.Add(y)
+			yx, err2 := y.Add(x)
+			return err1 == nil && err2 == nil && xy == yx
+		}
+		if err := quick.Check(commutative, nil); err != nil {
+			t.Errorf("%s: Add is not commutative: %v", code, err)
+		}
+
+		inverse := func(a, b int64) bool {
+			x, y := New(a, code), New(b, code)
+			sum, err := x.Add(y)
+			if err != nil {
+				return false
+			}
+			back, err := sum.Sub(y)
+			return err == nil && back == x
+		}
+		if err := quick.Check(inverse, nil); err != nil {
+			t.Errorf("%s: Sub doesn't undo Add: %v", code, err)
+		}
+	}
+}
+
+func TestMulIsRepeatedAdd(t *testing.T) {
+	for _, code := range testCurrencies {
+		property := func(a int32, n uint8) bool {
+			m, quantity := New(int64(a), code), int(n%50)
+			sum := New(0, code)
+			for i := 0; i < quantity; i++ {
+				var err error
+				if sum, err = sum.Add(m); err != nil {
+					return false
+				}
+			}
+			return m.Mul(quantity) == sum
+		}
+		if err := quick.Check(property, nil); err != nil {
+			t.Errorf("%s: Mul differs from repeated Add: %v", code, err)
+		}
+	}
+}
+
+func TestParseDecimalRoundTrip(t *testing.T) {
+	for _, code := range testCurrencies {
+		property := func(a int64) bool {
+			if a == -a && a != 0 {
+				return true // math.MinInt64 has no positive counterpart
+			}
+			m := New(a, code)
+			parsed, err := Parse(m.Decimal(), code)
+			return err == nil && parsed == m
+		}
+		if err := quick.Check(property, nil); err != nil {
+			t.Errorf("%s: Parse(Decimal()) doesn't round trip: %v", code, err)
+		}
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{New(0, "XAF"), "0"},
+		{New(1500, "XAF"), "1500"},
+		{New(0, "EUR"), "0.00"},
+		{New(5, "EUR"), "0.05"},
+		{New(-1250, "EUR"), "-12.50"},
+		{New(1, "KWD"), "0.001"},
+		{New(12345, "KWD"), "12.345"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Decimal(); got != tt.want {
+			t.Errorf("%d %s: Decimal() = %q, want %q", tt.m.Amount, tt.m.Currency, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s, code string
+		want    int64
+		wantErr bool
+	}{
+		{"12.50", "EUR", 1250, false},
+		{"-3", "EUR", -300, false},
+		{".5", "EUR", 50, false},
+		{"12.500", "EUR", 1250, false}, // Trailing zeros aren't extra decimals
+		{"12.505", "EUR", 0, true},
+		{"1500", "XAF", 1500, false},
+		{"1500.5", "XAF", 0, true},
+		{"1.234", "KWD", 1234, false},
+		{"", "EUR", 0, true},
+		{"1,50", "EUR", 0, true},
+		{"99999999999999999999", "EUR", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.s, tt.code)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q, %s) error = %v, wantErr %v", tt.s, tt.code, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != New(tt.want, tt.code) {
+			t.Errorf("Parse(%q, %s) = %v, want %d", tt.s, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestFromMajorRoundsHalvesAwayFromZero(t *testing.T) {
+	tests := []struct {
+		amount float64
+		code   string
+		want   int64
+	}{
+		{0.5, "XAF", 1},
+		{-0.5, "XAF", -1},
+		{2.5, "XAF", 3},
+		{0.125, "EUR", 13},
+		{-0.125, "EUR", -13},
+		{0.0625, "KWD", 63},
+		{-0.0625, "KWD", -63},
+		{12.5, "EUR", 1250},
+		{12.345, "EUR", 1235}, // 1234.4999... once multiplied in binary
+		{1.005, "EUR", 101},
+		{1.0005, "KWD", 1001},
+	}
+	for _, tt := range tests {
+		if got := FromMajor(tt.amount, tt.code); got != New(tt.want, tt.code) {
+			t.Errorf("FromMajor(%v, %s) = %d, want %d", tt.amount, tt.code, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestCurrencyMismatch(t *testing.T) {
+	eur, xaf := New(100, "EUR"), New(100, "XAF")
+	if _, err := eur.Add(xaf); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Add: error = %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := eur.Sub(xaf); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Sub: error = %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := eur.Cmp(xaf); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Cmp: error = %v, want ErrCurrencyMismatch", err)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, code := range testCurrencies {
+		property := func(a int64) bool {
+			if a == -a && a != 0 {
+				return true
+			}
+			m := New(a, code)
+			data, err := json.Marshal(m)
+			if err != nil {
+				return false
+			}
+			back := Money{Currency: m.Currency}
+			return json.Unmarshal(data, &back) == nil && back == m
+		}
+		if err := quick.Check(property, nil); err != nil {
+			t.Errorf("%s: JSON doesn't round trip: %v", code, err)
+		}
+	}
+
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{New(1250, "eur"), `12.50`},
+		{New(1500, "XAF"), `1500`},
+		{New(-5, "KWD"), `-0.005`},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.m)
+		if err != nil || string(data) != tt.want {
+			t.Errorf("Marshal(%v) = %s, %v, want %s", tt.m, data, err, tt.want)
+		}
+	}
+	m := Money{Currency: "EUR"}
+	if err := json.Unmarshal([]byte(`"12.5"`), &m); err != nil || m != New(1250, "EUR") {
+		t.Errorf("Unmarshal of a string = %v, %v", m, err)
+	}
+	if err := json.Unmarshal([]byte(`{"amount":12.5}`), &m); err == nil {
+		t.Errorf("Unmarshal of an object succeeded")
+	}
+}
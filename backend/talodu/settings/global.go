@@ -2,29 +2,88 @@ package settings
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
+	"path/filepath"
+	"strings"
+	"talodu/imageproc"
+	"talodu/storage"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 type SiteImage struct {
 	gorm.Model
-	URL       string `json:"url" gorm:"size:500"`
-	AltText   string `json:"altText" gorm:"size:100"`
-	IsVisible bool   `json:"isVisible" gorm:"default:true"`
-	IsPrimary bool   `json:"isPrimary" gorm:"default:false"`
+	Key          string `json:"-" gorm:"size:500"` // Storage keys of the original and its renditions
+	ThumbnailKey string `json:"-" gorm:"size:500"`
+	MediumKey    string `json:"-" gorm:"size:500"`
+	LargeKey     string `json:"-" gorm:"size:500"`
+	WebPKey      string `json:"-" gorm:"column:webp_key;size:500"`
+	URL          string `json:"url" gorm:"-"`
+	ThumbnailURL string `json:"thumbnailUrl" gorm:"-"`
+	MediumURL    string `json:"mediumUrl" gorm:"-"`
+	LargeURL     string `json:"largeUrl" gorm:"-"`
+	WebPURL      string `json:"webpUrl" gorm:"-"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	AltText      string `json:"altText" gorm:"size:100"`
+	IsVisible    bool   `json:"isVisible" gorm:"default:true"`
+	IsPrimary    bool   `json:"isPrimary" gorm:"default:false"`
+}
+
+// ObjectKeys returns the storage keys of the original file and of all its renditions
+func (i *SiteImage) ObjectKeys() []string {
+	var keys []string
+	for _, key := range []string{i.Key, i.ThumbnailKey, i.MediumKey, i.LargeKey, i.WebPKey} {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (i *SiteImage) setURLs() {
+	i.URL = storage.URL(i.Key)
+	i.ThumbnailURL = storage.URL(i.ThumbnailKey)
+	i.MediumURL = storage.URL(i.MediumKey)
+	i.LargeURL = storage.URL(i.LargeKey)
+	i.WebPURL = storage.URL(i.WebPKey)
+}
+
+func (i *SiteImage) AfterFind(tx *gorm.DB) error {
+	i.setURLs()
+	return nil
+}
+
+func (i *SiteImage) AfterSave(tx *gorm.DB) error {
+	i.setURLs()
+	return nil
 }
 
 type SiteLogo struct {
 	gorm.Model
-	URL       string `json:"url" gorm:"size:500"`
+	Key       string `json:"-" gorm:"size:500"` // Storage key of the logo file
+	URL       string `json:"url" gorm:"-"`
 	AltText   string `json:"altText" gorm:"size:100"`
 	IsPrimary bool   `json:"isPrimary" gorm:"default:false"`
 }
 
+func (l *SiteLogo) AfterFind(tx *gorm.DB) error {
+	l.URL = storage.URL(l.Key)
+	return nil
+}
+
+func (l *SiteLogo) AfterSave(tx *gorm.DB) error {
+	l.URL = storage.URL(l.Key)
+	return nil
+}
+
 type DisplaySettings1 struct {
 	ShowFeaturedProducts  bool   `json:"showFeaturedProducts"`
 	ShowCarousel          bool   `json:"showCarousel"` // To show images carousel
@@ -51,6 +110,17 @@ type DisplaySettings struct {
 	FeaturedProductsTitle      string `json:"featuredProductsTitle"`
 	FeaturedProductsCount      int    `json:"featuredProductsCount"`
 	RecentlyViewedCount        int    `json:"recentlyViewedCount"`
+	// Products shown by the collections of each merchandising slot, e.g.
+	// {"homepage_hero": 4}. Slots not listed show FeaturedProductsCount.
+	SlotProductCounts map[string]int `json:"slotProductCounts,omitempty"`
+}
+
+// SlotProductCount is the number of products the collections of a slot show
+func (d DisplaySettings) SlotProductCount(slot string) int {
+	if count := d.SlotProductCounts[slot]; count > 0 {
+		return count
+	}
+	return d.FeaturedProductsCount
 }
 
 type GlobalSettings struct {
@@ -264,34 +334,69 @@ func UploadSiteImages(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var uploadedImages []SiteImage
-
-		for _, file := range files {
-			// Generate unique filename
-			filename := file.Filename
-			// In production, you'd want to generate a unique name and save the file
-			// For now, we'll just store the filename as the URL
-			filePath := "/uploads/site/images/" + filename
-
-			// Save the file (you'll need to implement this based on your file storage)
-			if err := c.SaveUploadedFile(file, "."+filePath); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		// Every file is validated before any is stored, a batch is uploaded whole or not at all
+		results := make([]*imageproc.Result, len(files))
+		for i, file := range files {
+			if file.Size > imageproc.MaxUploadSize {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s exceeds the maximum size of %d MB", file.Filename, imageproc.MaxUploadSize>>20)})
 				return
 			}
 
-			image := SiteImage{
-				URL:       filePath,
-				AltText:   filename,
-				IsVisible: true,
-				IsPrimary: false,
+			src, err := file.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+				return
+			}
+			results[i], err = imageproc.Process(src)
+			src.Close()
+			if err != nil {
+				var invalid *imageproc.ValidationError
+				if errors.As(err, &invalid) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": file.Filename + ": " + invalid.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process image"})
+				return
 			}
+		}
 
-			if err := db.Create(&image).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create image record"})
+		var uploadedImages []SiteImage
+		var storedKeys []string
+		deleteStored := func() {
+			for _, key := range storedKeys {
+				_ = storage.Default.Delete(c.Request.Context(), key)
+			}
+		}
+		for i, result := range results {
+			// Renditions are stored under a generated name, the client's name is only kept as alt text
+			keys, err := result.Store(c.Request.Context(), storage.Default, "site/images", uuid.New().String())
+			if err != nil {
+				deleteStored()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
 				return
 			}
 
-			uploadedImages = append(uploadedImages, image)
+			for _, key := range keys {
+				storedKeys = append(storedKeys, key)
+			}
+			uploadedImages = append(uploadedImages, SiteImage{
+				Key:          keys[imageproc.Original],
+				ThumbnailKey: keys[imageproc.Thumbnail],
+				MediumKey:    keys[imageproc.Medium],
+				LargeKey:     keys[imageproc.Large],
+				WebPKey:      keys[imageproc.WebP],
+				Width:        result.Width,
+				Height:       result.Height,
+				AltText:      files[i].Filename,
+				IsVisible:    true,
+				IsPrimary:    false,
+			})
+		}
+
+		if err := db.Create(&uploadedImages).Error; err != nil {
+			deleteStored()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create image records"})
+			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
@@ -379,21 +484,29 @@ func UploadSiteLogos(db *gorm.DB) gin.HandlerFunc {
 		for _, file := range files {
 			// Generate unique filename
 			filename := file.Filename
-			filePath := "/uploads/site/logos/" + filename
+			ext := strings.ToLower(filepath.Ext(filename))
+			key := "site/logos/" + uuid.New().String() + ext
 
-			// Save the file
-			if err := c.SaveUploadedFile(file, "."+filePath); err != nil {
+			src, err := file.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+				return
+			}
+			err = storage.Default.Put(c.Request.Context(), key, src, file.Size, mime.TypeByExtension(ext))
+			src.Close()
+			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
 				return
 			}
 
 			logo := SiteLogo{
-				URL:       filePath,
+				Key:       key,
 				AltText:   filename,
 				IsPrimary: false,
 			}
 
 			if err := db.Create(&logo).Error; err != nil {
+				_ = storage.Default.Delete(c.Request.Context(), key)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create logo record"})
 				return
 			}
@@ -476,6 +589,18 @@ func DeleteSiteLogo(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// LoadDisplaySettings returns the display settings, the defaults when
+// there are no settings yet
+func LoadDisplaySettings(db *gorm.DB) DisplaySettings {
+	var settings GlobalSettings
+	if err := db.First(&settings).Error; err != nil {
+		settings = createDefaultSettings()
+	}
+	var displaySettings DisplaySettings
+	json.Unmarshal(settings.DisplaySettings, &displaySettings)
+	return displaySettings
+}
+
 // Helper function to create default settings
 func createDefaultSettings() GlobalSettings {
 	defaultDisplaySettings := DisplaySettings{
@@ -494,6 +619,10 @@ func createDefaultSettings() GlobalSettings {
 		CarouselShowControls:       true,
 		CarouselTransitionType:     "fade",
 		CarouselTransitionDuration: 600,
+		SlotProductCounts: map[string]int{
+			"homepage_hero":    4,
+			"deals_of_the_day": 8,
+		},
 	}
 
 	displaySettingsJSON, _ := json.Marshal(defaultDisplaySettings)
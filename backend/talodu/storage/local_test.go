@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocal(t *testing.T) {
+	local := NewLocal(t.TempDir(), "/uploads/", "secret")
+	ctx := context.Background()
+	content := "Hello, disk"
+
+	for _, key := range []string{"products/1/a.jpg", "products/1/b.jpg", "site/logo.png"} {
+		if err := local.Put(ctx, key, strings.NewReader(content), int64(len(content)), "image/jpeg"); err != nil {
+			t.Fatalf("Put(%q): %v", key, err)
+		}
+	}
+	// Overwriting replaces the object
+	if err := local.Put(ctx, "products/1/a.jpg", strings.NewReader("new"), 3, "image/jpeg"); err != nil {
+		t.Fatalf("Put over an object: %v", err)
+	}
+
+	object, err := local.Get(ctx, "/products/1/a.jpg")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, err := io.ReadAll(object)
+	object.Close()
+	if err != nil || string(data) != "new" {
+		t.Errorf("Get = %q, %v, want %q", data, err, "new")
+	}
+
+	objects, err := local.List(ctx, "products/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(objects) != 2 || objects[0].Key != "products/1/a.jpg" || objects[1].Key != "products/1/b.jpg" || objects[1].Size != int64(len(content)) {
+		t.Errorf("List(products/) = %+v, want a.jpg and b.jpg", objects)
+	}
+
+	if got := local.URL("site/logo.png"); got != "/uploads/site/logo.png" {
+		t.Errorf("URL = %q", got)
+	}
+
+	if err := local.Delete(ctx, "products/1/a.jpg"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := local.Get(ctx, "products/1/a.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: error = %v, want ErrNotFound", err)
+	}
+	if err := local.Delete(ctx, "products/1/a.jpg"); err != nil {
+		t.Errorf("Delete of a missing object: %v", err)
+	}
+}
+
+func TestLocalListOfAMissingRoot(t *testing.T) {
+	local := NewLocal(filepath.Join(t.TempDir(), "missing"), "/uploads", "")
+	objects, err := local.List(context.Background(), "products/")
+	if err != nil || len(objects) != 0 {
+		t.Errorf("List = %v, %v, want nothing", objects, err)
+	}
+}
+
+func TestLocalRejectsUnsafeKeys(t *testing.T) {
+	dir := t.TempDir()
+	local := NewLocal(filepath.Join(dir, "root"), "/uploads", "secret")
+	ctx := context.Background()
+	os.WriteFile(filepath.Join(dir, "outside.txt"), []byte("keep"), 0644)
+
+	for _, key := range []string{"", "../x", "products/../../x", `..\x`, "products//x", "./x", "../outside.txt"} {
+		if err := local.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded, want an error", key)
+		}
+		if _, err := local.Get(ctx, key); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q): error = %v, want an invalid key", key, err)
+		}
+		if err := local.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) succeeded, want an error", key)
+		}
+		if _, err := local.SignedURL(ctx, key, time.Minute); err == nil {
+			t.Errorf("SignedURL(%q) succeeded, want an error", key)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "x")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a file was written outside the root: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "outside.txt")); string(data) != "keep" {
+		t.Errorf("a file outside the root was changed: %q", data)
+	}
+}
+
+func TestLocalSignedURL(t *testing.T) {
+	local := NewLocal(t.TempDir(), "/uploads", "secret")
+	ctx := context.Background()
+	if err := local.Put(ctx, "private/a.txt", strings.NewReader("signed"), 6, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.StripPrefix("/uploads", local.Handler()))
+	defer server.Close()
+
+	get := func(link string) int {
+		resp, err := http.Get(server.URL + link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	signed, err := local.SignedURL(ctx, "private/a.txt", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := get(signed); status != http.StatusOK {
+		t.Errorf("GET of the signed URL = %d, want 200", status)
+	}
+
+	u, _ := url.Parse(signed)
+	query := u.Query()
+	query.Set("signature", strings.Repeat("0", 64))
+	u.RawQuery = query.Encode()
+	if status := get(u.String()); status != http.StatusForbidden {
+		t.Errorf("GET with a wrong signature = %d, want 403", status)
+	}
+
+	expired, _ := local.SignedURL(ctx, "private/a.txt", -time.Minute)
+	if status := get(expired); status != http.StatusForbidden {
+		t.Errorf("GET of an expired URL = %d, want 403", status)
+	}
+
+	if status := get("/uploads/private/"); status != http.StatusNotFound {
+		t.Errorf("GET of a directory = %d, want 404", status)
+	}
+
+	if _, err := NewLocal(t.TempDir(), "/uploads", "").SignedURL(ctx, "private/a.txt", time.Minute); err == nil {
+		t.Error("SignedURL without signing key succeeded")
+	}
+}
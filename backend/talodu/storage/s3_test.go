@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// newTestS3 connects to the MinIO server of MINIO_ENDPOINT (e.g.
+// localhost:9000) with MINIO_ACCESS_KEY and MINIO_SECRET_KEY, the test is
+// skipped when it isn't set. Objects go to MINIO_BUCKET, "talodu-test" by
+// default, which is created when missing.
+func newTestS3(t *testing.T) *S3 {
+	t.Helper()
+	endpoint := os.Getenv("MINIO_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("MINIO_ENDPOINT is not set")
+	}
+	bucket := os.Getenv("MINIO_BUCKET")
+	if bucket == "" {
+		bucket = "talodu-test"
+	}
+	s3, err := NewS3(S3Config{
+		Endpoint:  endpoint,
+		AccessKey: os.Getenv("MINIO_ACCESS_KEY"),
+		SecretKey: os.Getenv("MINIO_SECRET_KEY"),
+		Bucket:    bucket,
+		UseSSL:    os.Getenv("MINIO_USE_SSL") == "true",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s3
+}
+
+func TestS3(t *testing.T) {
+	s3 := newTestS3(t)
+	ctx := context.Background()
+	prefix := "test/" + uuid.New().String() + "/"
+	key := prefix + "hello.txt"
+	content := "Hello, MinIO"
+	t.Cleanup(func() { s3.Delete(ctx, key) })
+
+	if err := s3.Put(ctx, key, strings.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	object, err := s3.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, err := io.ReadAll(object)
+	object.Close()
+	if err != nil || string(data) != content {
+		t.Errorf("Get = %q, %v, want %q", data, err, content)
+	}
+
+	objects, err := s3.List(ctx, prefix)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(objects) != 1 || objects[0].Key != key || objects[0].Size != int64(len(content)) {
+		t.Errorf("List = %+v, want the object", objects)
+	}
+
+	if got, want := s3.URL("/"+key), s3.publicURL+"/"+key; got != want {
+		t.Errorf("URL = %q, want %q", got, want)
+	}
+	signed, err := s3.SignedURL(ctx, key, time.Minute)
+	if err != nil {
+		t.Fatalf("SignedURL: %v", err)
+	}
+	resp, err := http.Get(signed)
+	if err != nil {
+		t.Fatalf("GET of the signed URL: %v", err)
+	}
+	data, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(data) != content {
+		t.Errorf("GET of the signed URL = %d %q, want 200 %q", resp.StatusCode, data, content)
+	}
+
+	if err := s3.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s3.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: error = %v, want ErrNotFound", err)
+	}
+	if err := s3.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of a missing object: %v", err)
+	}
+}
+
+func TestS3RejectsUnsafeKeys(t *testing.T) {
+	s3 := newTestS3(t)
+	ctx := context.Background()
+	for _, key := range []string{"", "../escape.txt", "products/../../escape.txt"} {
+		if err := s3.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded, want an error", key)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package storage stores uploaded files behind a Blob interface so the API
+// can run on several servers. Files are addressed by an object key such as
+// "products/80/679d3551-7857-4b85-b648-cc84335e61a1.jpg", never by a path.
+//
+// The driver is chosen with STORAGE_DRIVER:
+//   - local (default): files are kept under STORAGE_LOCAL_ROOT (./uploads)
+//     and served by the API under /uploads
+//   - s3: any S3-compatible service (AWS S3, MinIO, ...) configured with
+//     S3_ENDPOINT, S3_ACCESS_KEY, S3_SECRET_KEY, S3_BUCKET, S3_REGION,
+//     S3_USE_SSL and optionally S3_PUBLIC_URL (CDN or public bucket URL)
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when no object exists for a key
+var ErrNotFound = errors.New("object not found")
+
+// Blob is an object store
+type Blob interface {
+	// Put stores the content of r under key, replacing any existing object
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object stored under key, the caller must close it
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object, deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL giving temporary read access to the object
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+	// URL returns the public URL of the object
+	URL(key string) string
+	// List returns the objects whose key starts with prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// Default is the store used by the handlers, set by Init
+var Default Blob = NewLocal("uploads", "/uploads", "")
+
+// Init configures Default from the environment
+func Init() error {
+	blob, err := FromEnv()
+	if err != nil {
+		return err
+	}
+	Default = blob
+	return nil
+}
+
+// FromEnv builds the store selected by STORAGE_DRIVER
+func FromEnv() (Blob, error) {
+	switch driver := strings.ToLower(os.Getenv("STORAGE_DRIVER")); driver {
+	case "", "local":
+		return NewLocal(
+			getEnv("STORAGE_LOCAL_ROOT", "uploads"),
+			getEnv("STORAGE_LOCAL_URL", "/uploads"),
+			os.Getenv("STORAGE_SIGNING_KEY"),
+		), nil
+	case "s3", "minio":
+		return NewS3(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			UseSSL:    os.Getenv("S3_USE_SSL") != "false",
+			PublicURL: os.Getenv("S3_PUBLIC_URL"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
+}
+
+// URL returns the public URL of a key in the default store, or "" for an empty key
+func URL(key string) string {
+	if key == "" {
+		return ""
+	}
+	return Default.URL(key)
+}
+
+// DeleteKeys removes objects from the default store, failures are logged as
+// the garbage collection will retry them
+func DeleteKeys(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := Default.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete file %s: %v", key, err)
+		}
+	}
+}
+
+// CleanKey normalizes a key and rejects keys escaping the store
+func CleanKey(key string) (string, error) {
+	key = strings.TrimPrefix(strings.ReplaceAll(key, "\\", "/"), "/")
+	if key == "" {
+		return "", errors.New("empty object key")
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("invalid object key %q", key)
+		}
+	}
+	return key, nil
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,17 @@
+package translate
+
+import "context"
+
+// Fake is a deterministic translator: "Bonjour" to en is "[en] Bonjour".
+// Empty texts stay empty.
+type Fake struct{}
+
+func (Fake) Translate(ctx context.Context, texts []string, from, to string) ([]string, error) {
+	translations := make([]string, len(texts))
+	for i, text := range texts {
+		if text != "" {
+			translations[i] = "[" + to + "] " + text
+		}
+	}
+	return translations, nil
+}
@@ -0,0 +1,91 @@
+package translate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTP translates with a LibreTranslate-compatible service:
+// POST <url>/translate {"q": [...], "source": "fr", "target": "en", "format": "text", "api_key": "..."}
+// answers {"translatedText": [...]}
+type HTTP struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// NewHTTP returns a translator calling the service at baseURL
+func NewHTTP(baseURL, apiKey string, timeout time.Duration) (*HTTP, error) {
+	if baseURL == "" {
+		return nil, errors.New("TRANSLATE_URL is required")
+	}
+	return &HTTP{
+		url:    strings.TrimSuffix(baseURL, "/") + "/translate",
+		apiKey: apiKey,
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (h *HTTP) Translate(ctx context.Context, texts []string, from, to string) ([]string, error) {
+	translations := make([]string, len(texts))
+
+	// Empty texts are not sent
+	var queries []string
+	var indexes []int
+	for i, text := range texts {
+		if strings.TrimSpace(text) != "" {
+			queries = append(queries, text)
+			indexes = append(indexes, i)
+		}
+	}
+	if len(queries) == 0 {
+		return translations, nil
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"q":       queries,
+		"source":  from,
+		"target":  to,
+		"format":  "text",
+		"api_key": h.apiKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("translation request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("translation service answered %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	var result struct {
+		TranslatedText []string `json:"translatedText"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid translation response: %w", err)
+	}
+	if len(result.TranslatedText) != len(queries) {
+		return nil, fmt.Errorf("translation service returned %d texts for %d", len(result.TranslatedText), len(queries))
+	}
+	for i, translation := range result.TranslatedText {
+		translations[indexes[i]] = translation
+	}
+	return translations, nil
+}
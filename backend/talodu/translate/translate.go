@@ -0,0 +1,73 @@
+// Package translate machine-translates catalogue content behind a Translator
+// interface. Machine translations are saved as drafts that a person reviews.
+//
+// The backend is chosen with TRANSLATE_DRIVER:
+//   - none (default): machine translation is disabled, Default is nil
+//   - http: a LibreTranslate-compatible service at TRANSLATE_URL, with the
+//     optional TRANSLATE_API_KEY and TRANSLATE_TIMEOUT (e.g. 30s)
+//   - fake: prefixes texts with the target language, for tests and demos
+//
+// Content is translated from i18n.ContentLanguage to the other languages of
+// i18n.Supported.
+package translate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"talodu/i18n"
+	"time"
+)
+
+// Translator translates texts from one language to another
+type Translator interface {
+	// Translate returns the translations of texts in the same order
+	Translate(ctx context.Context, texts []string, from, to string) ([]string, error)
+}
+
+// Default is the translator used by the handlers, nil when machine translation is disabled
+var Default Translator
+
+// Init configures Default from the environment
+func Init() error {
+	translator, err := FromEnv()
+	if err != nil {
+		return err
+	}
+	Default = translator
+	return nil
+}
+
+// FromEnv builds the translator selected by TRANSLATE_DRIVER
+func FromEnv() (Translator, error) {
+	switch driver := strings.ToLower(os.Getenv("TRANSLATE_DRIVER")); driver {
+	case "", "none":
+		return nil, nil
+	case "fake":
+		return Fake{}, nil
+	case "http", "libretranslate":
+		timeout := 30 * time.Second
+		if value := os.Getenv("TRANSLATE_TIMEOUT"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid TRANSLATE_TIMEOUT: %w", err)
+			}
+			timeout = parsed
+		}
+		return NewHTTP(os.Getenv("TRANSLATE_URL"), os.Getenv("TRANSLATE_API_KEY"), timeout)
+	default:
+		return nil, fmt.Errorf("unknown translation driver %q", driver)
+	}
+}
+
+// TargetLanguages are the languages content in i18n.ContentLanguage is translated to
+func TargetLanguages() []string {
+	var targets []string
+	for _, lang := range i18n.Supported {
+		if lang != i18n.ContentLanguage {
+			targets = append(targets, lang)
+		}
+	}
+	return targets
+}
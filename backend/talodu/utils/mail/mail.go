@@ -0,0 +1,37 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Send emails an HTML message through the local sendmail, from MAIL_FROM
+func Send(to, subject, htmlBody string) error {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "localhost"
+		}
+		from = "no-reply@" + hostname
+	}
+
+	message := fmt.Sprintf(`From: %s
+To: %s
+Subject: %s
+MIME-Version: 1.0
+Content-Type: text/html; charset=UTF-8
+
+%s`, from, to, subject, htmlBody)
+
+	cmd := exec.Command("/usr/sbin/sendmail", "-t", "-i")
+	cmd.Stdin = strings.NewReader(message)
+	if err := cmd.Run(); err != nil {
+		log.Printf("Sendmail error: %v", err)
+		return err
+	}
+	return nil
+}